@@ -0,0 +1,26 @@
+package golm
+
+const (
+	// AlgorithmOlmV1 is the Matrix name of the Olm algorithm.
+	AlgorithmOlmV1 = "m.olm.v1.curve25519-aes-sha2"
+	// AlgorithmMegolmV1 is the Matrix name of the Megolm algorithm.
+	AlgorithmMegolmV1 = "m.megolm.v1.aes-sha2"
+	// AlgorithmMegolmBackupV1 is the Matrix name of the key backup
+	// algorithm.
+	AlgorithmMegolmBackupV1 = "m.megolm_backup.v1.curve25519-aes-sha2"
+	// AlgorithmSecretStorageV1 is the Matrix name of the secret storage
+	// algorithm.
+	AlgorithmSecretStorageV1 = "m.secret_storage.v1.aes-hmac-sha2"
+	// AlgorithmPBKDF2 is the Matrix name of the passphrase algorithm of
+	// secret storage keys.
+	AlgorithmPBKDF2 = "m.pbkdf2"
+)
+
+const (
+	// KeyAlgorithmCurve25519 is the algorithm of Curve25519 keys.
+	KeyAlgorithmCurve25519 = "curve25519"
+	// KeyAlgorithmED25519 is the algorithm of ed25519 keys.
+	KeyAlgorithmED25519 = "ed25519"
+	// KeyAlgorithmSignedCurve25519 is the algorithm of signed one time keys.
+	KeyAlgorithmSignedCurve25519 = "signed_curve25519"
+)
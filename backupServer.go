@@ -0,0 +1,151 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// BackupVersion is a version of the key backup on the server.
+type BackupVersion struct {
+	Version   string          `json:"version"`
+	Algorithm string          `json:"algorithm"`
+	AuthData  json.RawMessage `json:"auth_data"`
+}
+
+// BackupServer is the part of the server API used by key backups.
+type BackupServer interface {
+	// CreateBackupVersion creates a new backup version, which becomes the
+	// latest version, and returns its version.
+	CreateBackupVersion(algorithm string, authData json.RawMessage) (string, error)
+	// LatestBackupVersion returns the latest backup version or nil if
+	// there is none.
+	LatestBackupVersion() (*BackupVersion, error)
+	// PutBackupSession stores the backup of a session in the version.
+	PutBackupSession(version, roomID, sessionID string, data *KeyBackupData) error
+	// BackupSessions returns the backed up sessions of the version by
+	// room ID and session ID.
+	BackupSessions(version string) (map[string]map[string]*KeyBackupData, error)
+}
+
+// ErrWrongBackupVersion is returned by MemoryBackupServer if sessions are
+// stored in a version that is not the latest.
+var ErrWrongBackupVersion = errors.New("backup version is not the latest version")
+
+// MemoryBackupServer is a BackupServer keeping everything in memory, to
+// stand in for a server in tests. It is safe for concurrent use.
+//
+// Like a server it only accepts sessions for the latest version and keeps
+// the better of two backups of a session: a verified one over an
+// unverified one, then the one with the lower first message index, then
+// the one forwarded less often.
+type MemoryBackupServer struct {
+	mutex    sync.Mutex
+	versions []*BackupVersion
+	sessions map[string]map[string]map[string]*KeyBackupData
+}
+
+// NewMemoryBackupServer creates a MemoryBackupServer without any backup.
+func NewMemoryBackupServer() *MemoryBackupServer {
+	return &MemoryBackupServer{
+		sessions: make(map[string]map[string]map[string]*KeyBackupData),
+	}
+}
+
+// CreateBackupVersion creates a new backup version, which becomes the
+// latest version, and returns its version.
+func (s *MemoryBackupServer) CreateBackupVersion(algorithm string, authData json.RawMessage) (string, error) {
+	if algorithm == "" {
+		return "", errors.New("algorithm must not be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	version := &BackupVersion{
+		Version:   strconv.Itoa(len(s.versions) + 1),
+		Algorithm: algorithm,
+		AuthData:  append(json.RawMessage(nil), authData...),
+	}
+	s.versions = append(s.versions, version)
+	s.sessions[version.Version] = make(map[string]map[string]*KeyBackupData)
+
+	return version.Version, nil
+}
+
+// LatestBackupVersion returns the latest backup version or nil if there is
+// none.
+func (s *MemoryBackupServer) LatestBackupVersion() (*BackupVersion, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.versions) == 0 {
+		return nil, nil
+	}
+	copied := *s.versions[len(s.versions)-1]
+	return &copied, nil
+}
+
+// PutBackupSession stores the backup of a session in the version, unless
+// a better backup of the session is stored already.
+func (s *MemoryBackupServer) PutBackupSession(version, roomID, sessionID string, data *KeyBackupData) error {
+	if roomID == "" || sessionID == "" {
+		return errors.New("roomID and sessionID must not be empty")
+	}
+	if data == nil {
+		return errors.New("data must not be nil")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.versions) == 0 || s.versions[len(s.versions)-1].Version != version {
+		return ErrWrongBackupVersion
+	}
+
+	rooms := s.sessions[version]
+	if rooms[roomID] == nil {
+		rooms[roomID] = make(map[string]*KeyBackupData)
+	}
+	existing := rooms[roomID][sessionID]
+	if existing != nil && !betterBackup(data, existing) {
+		return nil
+	}
+
+	copied := *data
+	rooms[roomID][sessionID] = &copied
+	return nil
+}
+
+func betterBackup(a, b *KeyBackupData) bool {
+	if a.IsVerified != b.IsVerified {
+		return a.IsVerified
+	}
+	if a.FirstMessageIndex != b.FirstMessageIndex {
+		return a.FirstMessageIndex < b.FirstMessageIndex
+	}
+	return a.ForwardedCount < b.ForwardedCount
+}
+
+// BackupSessions returns the backed up sessions of the version by room ID
+// and session ID.
+func (s *MemoryBackupServer) BackupSessions(version string) (map[string]map[string]*KeyBackupData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rooms, ok := s.sessions[version]
+	if !ok {
+		return nil, errors.New("unknown backup version")
+	}
+
+	result := make(map[string]map[string]*KeyBackupData, len(rooms))
+	for roomID, sessions := range rooms {
+		result[roomID] = make(map[string]*KeyBackupData, len(sessions))
+		for sessionID, data := range sessions {
+			copied := *data
+			result[roomID][sessionID] = &copied
+		}
+	}
+	return result, nil
+}
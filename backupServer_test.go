@@ -0,0 +1,74 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryBackupServerVersions(t *testing.T) {
+	Convey("A new MemoryBackupServer should have no backup.", t, func() {
+		version, err := NewMemoryBackupServer().LatestBackupVersion()
+		So(err, ShouldBeNil)
+		So(version, ShouldBeNil)
+	})
+	Convey("The last created version should be the latest.", t, func() {
+		server := NewMemoryBackupServer()
+		first, _ := server.CreateBackupVersion(AlgorithmMegolmBackupV1, json.RawMessage(`{"public_key":"a"}`))
+		second, err := server.CreateBackupVersion(AlgorithmMegolmBackupV1, json.RawMessage(`{"public_key":"b"}`))
+		So(err, ShouldBeNil)
+		So(second, ShouldNotEqual, first)
+
+		latest, err := server.LatestBackupVersion()
+		So(err, ShouldBeNil)
+		So(latest.Version, ShouldEqual, second)
+		So(latest.Algorithm, ShouldEqual, AlgorithmMegolmBackupV1)
+		So(string(latest.AuthData), ShouldEqual, `{"public_key":"b"}`)
+	})
+}
+
+func TestMemoryBackupServerSessions(t *testing.T) {
+	Convey("A MemoryBackupServer", t, func() {
+		server := NewMemoryBackupServer()
+		old, _ := server.CreateBackupVersion(AlgorithmMegolmBackupV1, nil)
+		version, _ := server.CreateBackupVersion(AlgorithmMegolmBackupV1, nil)
+
+		stored := &KeyBackupData{FirstMessageIndex: 5, ForwardedCount: 1}
+		So(server.PutBackupSession(version, "!room", "session", stored), ShouldBeNil)
+
+		load := func() *KeyBackupData {
+			sessions, _ := server.BackupSessions(version)
+			return sessions["!room"]["session"]
+		}
+
+		Convey("should return stored sessions.", func() {
+			So(load(), ShouldResemble, stored)
+		})
+		Convey("should not accept sessions for old versions.", func() {
+			So(server.PutBackupSession(old, "!room", "session", stored), ShouldEqual, ErrWrongBackupVersion)
+		})
+		Convey("should prefer verified backups.", func() {
+			server.PutBackupSession(version, "!room", "session", &KeyBackupData{FirstMessageIndex: 9, IsVerified: true})
+			So(load().IsVerified, ShouldBeTrue)
+
+			server.PutBackupSession(version, "!room", "session", &KeyBackupData{FirstMessageIndex: 0})
+			So(load().FirstMessageIndex, ShouldEqual, 9)
+		})
+		Convey("should prefer a lower first message index.", func() {
+			server.PutBackupSession(version, "!room", "session", &KeyBackupData{FirstMessageIndex: 7})
+			So(load().FirstMessageIndex, ShouldEqual, 5)
+
+			server.PutBackupSession(version, "!room", "session", &KeyBackupData{FirstMessageIndex: 2, ForwardedCount: 3})
+			So(load().FirstMessageIndex, ShouldEqual, 2)
+		})
+		Convey("should prefer backups forwarded less often.", func() {
+			server.PutBackupSession(version, "!room", "session", &KeyBackupData{FirstMessageIndex: 5})
+			So(load().ForwardedCount, ShouldEqual, 0)
+		})
+		Convey("should not return sessions of unknown versions.", func() {
+			_, err := server.BackupSessions("unknown")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
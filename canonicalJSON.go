@@ -0,0 +1,176 @@
+package golm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// maxCanonicalInt is the largest integer that may appear in canonical JSON.
+const maxCanonicalInt = 1<<53 - 1
+
+// CanonicalJSON encodes v as canonical JSON as specified by Matrix:
+// object keys are sorted by code point, there is no insignificant
+// whitespace, strings are not escaped beyond what JSON requires and
+// numbers must be integers in the range [-(2^53)+1, (2^53)-1].
+//
+// v is encoded with encoding/json first, so any value that can be
+// marshalled is accepted. A []byte or json.RawMessage is taken to be
+// JSON already.
+func CanonicalJSON(v interface{}) ([]byte, error) {
+	value, err := decodeJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = writeCanonicalJSON(buf, value)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeJSONValue(v interface{}) (interface{}, error) {
+	var data []byte
+	switch raw := v.(type) {
+	case []byte:
+		data = raw
+	case json.RawMessage:
+		data = raw
+	default:
+		var err error
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func writeCanonicalJSON(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := canonicalInt(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatInt(n, 10))
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// Byte order of UTF-8 strings is code point order.
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", value)
+	}
+	return nil
+}
+
+func canonicalInt(number json.Number) (int64, error) {
+	n, err := strconv.ParseInt(string(number), 10, 64)
+	if err != nil {
+		// Integers may still be written as 1e3 or 1.0.
+		f, ferr := strconv.ParseFloat(string(number), 64)
+		if ferr != nil || f != math.Trunc(f) || math.Abs(f) > maxCanonicalInt {
+			return 0, fmt.Errorf("number %s is not allowed in canonical JSON", number)
+		}
+		n = int64(f)
+	}
+	if n > maxCanonicalInt || n < -maxCanonicalInt {
+		return 0, fmt.Errorf("number %s is not allowed in canonical JSON", number)
+	}
+	return n, nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xF])
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// jsonObject decodes v into a freshly allocated JSON object, so it can be
+// modified without touching v.
+func jsonObject(v interface{}) (map[string]interface{}, error) {
+	value, err := decodeJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("value is not a JSON object")
+	}
+	return object, nil
+}
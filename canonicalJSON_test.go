@@ -0,0 +1,60 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	vectors := map[string]string{
+		`{}`:                                     `{}`,
+		`{"one": 1, "two": "Two"}`:               `{"one":1,"two":"Two"}`,
+		`{"b": "2", "a": "1"}`:                   `{"a":"1","b":"2"}`,
+		`{"a": "日本語"}`:                           `{"a":"日本語"}`,
+		`{"本": 2, "日": 1}`:                       `{"日":1,"本":2}`,
+		`{"a": "\u65E5"}`:                        `{"a":"日"}`,
+		`{"a": null}`:                            `{"a":null}`,
+		`{"a": -0, "b": 1e10}`:                   `{"a":0,"b":10000000000}`,
+		`{"a": "<>&\u2028"}`:                     "{\"a\":\"<>&\u2028\"}",
+		`{"a": "\"\\\n\t\u0001\u001f"}`:          `{"a":"\"\\\n\t\u0001\u001f"}`,
+		`{"a": [true, false, {"d": 1, "c": 2}]}`: `{"a":[true,false,{"c":2,"d":1}]}`,
+		`{
+			"auth": {
+				"success": true,
+				"mxid": "@john.doe:example.com",
+				"profile": {
+					"display_name": "John Doe",
+					"three_pids": [
+						{"medium": "email", "address": "john.doe@example.org"},
+						{"medium": "msisdn", "address": "123456789"}
+					]
+				}
+			}
+		}`: `{"auth":{"mxid":"@john.doe:example.com","profile":{"display_name":"John Doe","three_pids":[{"address":"john.doe@example.org","medium":"email"},{"address":"123456789","medium":"msisdn"}]},"success":true}}`,
+	}
+
+	Convey("Canonical JSON should match the known vectors.", t, func() {
+		for input, expected := range vectors {
+			output, err := CanonicalJSON(json.RawMessage(input))
+			So(err, ShouldBeNil)
+			So(string(output), ShouldEqual, expected)
+		}
+	})
+	Convey("Go values should be encoded canonically.", t, func() {
+		output, err := CanonicalJSON(map[string]interface{}{"b": 1, "a": []string{"x"}})
+		So(err, ShouldBeNil)
+		So(string(output), ShouldEqual, `{"a":["x"],"b":1}`)
+	})
+	Convey("Numbers that are not allowed should be rejected.", t, func() {
+		for _, input := range []string{`{"a": 1.5}`, `{"a": 9007199254740992}`, `{"a": -9007199254740992}`, `{"a": 1e300}`} {
+			_, err := CanonicalJSON(json.RawMessage(input))
+			So(err, ShouldNotBeNil)
+		}
+	})
+	Convey("Invalid JSON should not work.", t, func() {
+		_, err := CanonicalJSON([]byte("{"))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,164 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ClaimedSession is a session created from a claimed one time key.
+type ClaimedSession struct {
+	Device *DeviceKeys
+	// KeyID is the ID of the one time key, e.g. "signed_curve25519:AAAAAQ".
+	KeyID   string
+	Session *Session
+}
+
+// SkippedDevice is a device no session was created for.
+type SkippedDevice struct {
+	UserID   string
+	DeviceID string
+	// Err tells why the device was skipped.
+	Err error
+}
+
+// claimResponse is the body of a response to /keys/claim.
+type claimResponse struct {
+	OneTimeKeys map[string]map[string]map[string]json.RawMessage `json:"one_time_keys"`
+}
+
+// NewOutboundSessionsFromClaim creates an outbound session for every device
+// in the response to a /keys/claim request. devices maps user IDs and
+// device IDs to the device keys of the claimed devices, as returned by
+// ParseDeviceKeys.
+//
+// Each one time key must be a signed_curve25519 key signed by the ed25519
+// key of its device. Devices in devices the response has no key for,
+// devices whose key is invalid and devices that are not in devices are
+// reported as skipped. Results are sorted by user ID and device ID.
+func NewOutboundSessionsFromClaim(account *Account, response []byte, devices map[string]map[string]*DeviceKeys) ([]*ClaimedSession, []*SkippedDevice, error) {
+	return newSessionsFromClaim(response, devices, func(theirIdentityKey, theirOneTimeKey string) (*Session, error) {
+		return NewOutboundSession(account, theirIdentityKey, theirOneTimeKey)
+	})
+}
+
+// NewOutboundSessionsFromClaim creates and stores an outbound session for
+// every device in the response to a /keys/claim request. See the function
+// NewOutboundSessionsFromClaim.
+func (m *SessionManager) NewOutboundSessionsFromClaim(response []byte, devices map[string]map[string]*DeviceKeys) ([]*ClaimedSession, []*SkippedDevice, error) {
+	return newSessionsFromClaim(response, devices, m.NewOutboundSession)
+}
+
+func newSessionsFromClaim(response []byte, devices map[string]map[string]*DeviceKeys, create func(theirIdentityKey, theirOneTimeKey string) (*Session, error)) ([]*ClaimedSession, []*SkippedDevice, error) {
+	claim := &claimResponse{}
+	err := json.Unmarshal(response, claim)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claim.OneTimeKeys == nil {
+		return nil, nil, errors.New("response does not contain one_time_keys")
+	}
+
+	var sessions []*ClaimedSession
+	var skipped []*SkippedDevice
+
+	for _, userID := range claimedUserIDs(claim.OneTimeKeys, devices) {
+		userKeys := claim.OneTimeKeys[userID]
+		for _, deviceID := range claimedDeviceIDs(userKeys, devices[userID]) {
+			keys, ok := userKeys[deviceID]
+			if !ok {
+				skipped = append(skipped, &SkippedDevice{
+					UserID:   userID,
+					DeviceID: deviceID,
+					Err:      errors.New("no one time key claimed"),
+				})
+				continue
+			}
+
+			claimed, err := newSessionFromClaim(userID, deviceID, keys, devices[userID][deviceID], create)
+			if err != nil {
+				skipped = append(skipped, &SkippedDevice{
+					UserID:   userID,
+					DeviceID: deviceID,
+					Err:      err,
+				})
+				continue
+			}
+			sessions = append(sessions, claimed)
+		}
+	}
+
+	return sessions, skipped, nil
+}
+
+// claimedUserIDs returns the sorted user IDs of the response and devices.
+func claimedUserIDs(keys map[string]map[string]map[string]json.RawMessage, devices map[string]map[string]*DeviceKeys) []string {
+	seen := make(map[string]bool)
+	for userID := range keys {
+		seen[userID] = true
+	}
+	for userID := range devices {
+		seen[userID] = true
+	}
+	return sortedKeys(seen)
+}
+
+// claimedDeviceIDs returns the sorted device IDs of a user in the response
+// and devices.
+func claimedDeviceIDs(keys map[string]map[string]json.RawMessage, devices map[string]*DeviceKeys) []string {
+	seen := make(map[string]bool)
+	for deviceID := range keys {
+		seen[deviceID] = true
+	}
+	for deviceID := range devices {
+		seen[deviceID] = true
+	}
+	return sortedKeys(seen)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newSessionFromClaim(userID, deviceID string, keys map[string]json.RawMessage, device *DeviceKeys, create func(theirIdentityKey, theirOneTimeKey string) (*Session, error)) (*ClaimedSession, error) {
+	if device == nil {
+		return nil, errors.New("device keys are unknown")
+	}
+	if device.UserID != userID || device.DeviceID != deviceID {
+		return nil, fmt.Errorf("device keys of %s %s were given for %s %s", device.UserID, device.DeviceID, userID, deviceID)
+	}
+
+	var keyID string
+	for id := range keys {
+		if strings.HasPrefix(id, KeyAlgorithmSignedCurve25519+":") {
+			keyID = id
+			break
+		}
+	}
+	if keyID == "" {
+		return nil, errors.New("no signed_curve25519 one time key was claimed")
+	}
+
+	otk, err := ParseSignedOneTimeKey(keyID, keys[keyID], device)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := create(device.Curve25519(), otk.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClaimedSession{
+		Device:  device,
+		KeyID:   keyID,
+		Session: sess,
+	}, nil
+}
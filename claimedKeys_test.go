@@ -0,0 +1,115 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createClaimResponse(accounts map[string]*Account) ([]byte, map[string]map[string]*DeviceKeys) {
+	oneTimeKeys := make(map[string]map[string]map[string]*SignedOneTimeKey)
+	devices := make(map[string]map[string]*DeviceKeys)
+	for userID, acc := range accounts {
+		acc.GenerateOneTimeKeys(1)
+		device, _ := NewDeviceKeys(acc, userID, "DEVICE")
+		keys, _ := NewSignedOneTimeKeys(acc, userID, "DEVICE")
+
+		oneTimeKeys[userID] = map[string]map[string]*SignedOneTimeKey{"DEVICE": keys}
+		devices[userID] = map[string]*DeviceKeys{"DEVICE": device}
+	}
+
+	response, _ := json.Marshal(map[string]interface{}{
+		"one_time_keys": oneTimeKeys,
+		"failures":      map[string]interface{}{},
+	})
+	return response, devices
+}
+
+func TestNewOutboundSessionsFromClaim(t *testing.T) {
+	Convey("A claim response", t, func() {
+		acc, _ := NewAccount()
+		bob, _ := NewAccount()
+		carol, _ := NewAccount()
+		response, devices := createClaimResponse(map[string]*Account{
+			"@bob:example.org":   bob,
+			"@carol:example.org": carol,
+		})
+
+		Convey("should create a session per device.", func() {
+			sessions, skipped, err := NewOutboundSessionsFromClaim(acc, response, devices)
+			So(err, ShouldBeNil)
+			So(skipped, ShouldBeEmpty)
+			So(sessions, ShouldHaveLength, 2)
+			So(sessions[0].Device.UserID, ShouldEqual, "@bob:example.org")
+			So(sessions[1].Device.UserID, ShouldEqual, "@carol:example.org")
+
+			message, typ, _ := sessions[0].Session.Encrypt("hello")
+			inbound, err := NewInboundSession(bob, message)
+			So(err, ShouldBeNil)
+			plaintext, _ := inbound.Decrypt(typ, message)
+			So(plaintext, ShouldEqual, "hello")
+		})
+		Convey("should skip unknown devices.", func() {
+			delete(devices, "@carol:example.org")
+			sessions, skipped, err := NewOutboundSessionsFromClaim(acc, response, devices)
+			So(err, ShouldBeNil)
+			So(sessions, ShouldHaveLength, 1)
+			So(skipped, ShouldHaveLength, 1)
+			So(skipped[0].UserID, ShouldEqual, "@carol:example.org")
+			So(skipped[0].Err, ShouldNotBeNil)
+		})
+		Convey("should skip keys signed by another device.", func() {
+			other, _ := NewAccount()
+			devices["@carol:example.org"]["DEVICE"], _ = NewDeviceKeys(other, "@carol:example.org", "DEVICE")
+
+			sessions, skipped, err := NewOutboundSessionsFromClaim(acc, response, devices)
+			So(err, ShouldBeNil)
+			So(sessions, ShouldHaveLength, 1)
+			So(skipped, ShouldHaveLength, 1)
+			So(skipped[0].UserID, ShouldEqual, "@carol:example.org")
+		})
+		Convey("should skip devices the server returned no key for.", func() {
+			dave, _ := NewAccount()
+			devices["@dave:example.org"] = map[string]*DeviceKeys{}
+			devices["@dave:example.org"]["DEVICE"], _ = NewDeviceKeys(dave, "@dave:example.org", "DEVICE")
+			devices["@bob:example.org"]["OTHER"], _ = NewDeviceKeys(dave, "@bob:example.org", "OTHER")
+
+			sessions, skipped, err := NewOutboundSessionsFromClaim(acc, response, devices)
+			So(err, ShouldBeNil)
+			So(sessions, ShouldHaveLength, 2)
+			So(skipped, ShouldHaveLength, 2)
+			So(skipped[0].UserID, ShouldEqual, "@bob:example.org")
+			So(skipped[0].DeviceID, ShouldEqual, "OTHER")
+			So(skipped[1].UserID, ShouldEqual, "@dave:example.org")
+			So(skipped[1].Err, ShouldNotBeNil)
+		})
+		Convey("should store the sessions of a manager.", func() {
+			manager := NewSessionManager(acc, NewMemoryStore())
+			sessions, _, err := manager.NewOutboundSessionsFromClaim(response, devices)
+			So(err, ShouldBeNil)
+
+			stored, _ := manager.Sessions(bob.IdentityKeys().Curve25519)
+			So(stored, ShouldHaveLength, 1)
+			So(stored[0].ID(), ShouldEqual, sessions[0].Session.ID())
+		})
+	})
+	Convey("Devices without a signed key should be skipped.", t, func() {
+		acc, _ := NewAccount()
+		bob, _ := NewAccount()
+		device, _ := NewDeviceKeys(bob, "@bob:example.org", "DEVICE")
+		response := []byte(`{"one_time_keys": {"@bob:example.org": {"DEVICE": {"curve25519:AAAAAQ": "key"}}}}`)
+
+		sessions, skipped, err := NewOutboundSessionsFromClaim(acc, response, map[string]map[string]*DeviceKeys{
+			"@bob:example.org": {"DEVICE": device},
+		})
+		So(err, ShouldBeNil)
+		So(sessions, ShouldBeEmpty)
+		So(skipped, ShouldHaveLength, 1)
+	})
+	Convey("A response without one time keys should not work.", t, func() {
+		acc, _ := NewAccount()
+		_, _, err := NewOutboundSessionsFromClaim(acc, []byte(`{"failures": {}}`), nil)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,448 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Usages of cross-signing keys.
+const (
+	// CrossSigningUsageMaster is the usage of the master key, which signs
+	// the other cross-signing keys of its user.
+	CrossSigningUsageMaster = "master"
+	// CrossSigningUsageSelfSigning is the usage of the self-signing key,
+	// which signs the devices of its user.
+	CrossSigningUsageSelfSigning = "self_signing"
+	// CrossSigningUsageUserSigning is the usage of the user-signing key,
+	// which signs the master keys of other users.
+	CrossSigningUsageUserSigning = "user_signing"
+)
+
+// CrossSigningKey is a public cross-signing key as uploaded to the server.
+type CrossSigningKey struct {
+	UserID     string            `json:"user_id"`
+	Usage      []string          `json:"usage"`
+	Keys       map[string]string `json:"keys"`
+	Signatures Signatures        `json:"signatures,omitempty"`
+}
+
+// ParseCrossSigningKey parses a cross-signing key and checks that it
+// belongs to the user, has the usage and contains exactly one ed25519 key.
+// Signatures are not verified, see CrossSigningPublicKeys.Verify.
+func ParseCrossSigningKey(data []byte, userID, usage string) (*CrossSigningKey, error) {
+	key := &CrossSigningKey{}
+	err := json.Unmarshal(data, key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = key.check(userID, usage)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *CrossSigningKey) check(userID, usage string) error {
+	if k.UserID != userID {
+		return fmt.Errorf("cross-signing key of %s was returned for %s", k.UserID, userID)
+	}
+	if !k.hasUsage(usage) {
+		return fmt.Errorf("cross-signing key of %s is no %s key", userID, usage)
+	}
+	if len(k.Keys) != 1 || k.PublicKey() == "" {
+		return errors.New("cross-signing key must contain exactly one ed25519 key")
+	}
+	return nil
+}
+
+func (k *CrossSigningKey) hasUsage(usage string) bool {
+	for _, u := range k.Usage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicKey returns the public ed25519 key.
+func (k *CrossSigningKey) PublicKey() string {
+	for keyID, key := range k.Keys {
+		if strings.HasPrefix(keyID, KeyAlgorithmED25519+":") {
+			return key
+		}
+	}
+	return ""
+}
+
+// KeyID returns the key ID signatures of the key are stored under, e.g.
+// "ed25519:<public key>".
+func (k *CrossSigningKey) KeyID() string {
+	return ED25519KeyID(k.PublicKey())
+}
+
+// verify verifies the signature of obj by the key.
+func (k *CrossSigningKey) verify(obj interface{}) error {
+	return VerifySignedJSON(obj, k.UserID, k.KeyID(), k.PublicKey())
+}
+
+// CrossSigningPublicKeys are the public cross-signing keys of a user.
+// UserSigning is only known for our own user.
+type CrossSigningPublicKeys struct {
+	Master      *CrossSigningKey `json:"master_key"`
+	SelfSigning *CrossSigningKey `json:"self_signing_key"`
+	UserSigning *CrossSigningKey `json:"user_signing_key,omitempty"`
+}
+
+// Verify checks that the keys belong to the same user, have the right
+// usages and that the self-signing and user-signing keys are signed by the
+// master key.
+func (k *CrossSigningPublicKeys) Verify() error {
+	if k.Master == nil || k.SelfSigning == nil {
+		return errors.New("master and self-signing key must not be nil")
+	}
+
+	userID := k.Master.UserID
+	err := k.Master.check(userID, CrossSigningUsageMaster)
+	if err != nil {
+		return err
+	}
+	err = k.SelfSigning.check(userID, CrossSigningUsageSelfSigning)
+	if err != nil {
+		return err
+	}
+	err = k.Master.verify(k.SelfSigning)
+	if err != nil {
+		return err
+	}
+
+	if k.UserSigning != nil {
+		err = k.UserSigning.check(userID, CrossSigningUsageUserSigning)
+		if err != nil {
+			return err
+		}
+		err = k.Master.verify(k.UserSigning)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CrossSigningKeys are the private cross-signing keys of our own user.
+type CrossSigningKeys struct {
+	UserID      string
+	Master      *PkSigning
+	SelfSigning *PkSigning
+	UserSigning *PkSigning
+}
+
+// NewCrossSigningKeys generates new cross-signing keys for the user.
+func NewCrossSigningKeys(userID string) (*CrossSigningKeys, error) {
+	if userID == "" {
+		return nil, errors.New("userID must not be empty")
+	}
+
+	keys := &CrossSigningKeys{UserID: userID}
+	for _, key := range []**PkSigning{&keys.Master, &keys.SelfSigning, &keys.UserSigning} {
+		signing, err := NewPkSigning()
+		if err != nil {
+			return nil, err
+		}
+		*key = signing
+	}
+	return keys, nil
+}
+
+// NewCrossSigningKeysFromSeeds restores cross-signing keys from their
+// seeds, e.g. after loading them from secret storage.
+func NewCrossSigningKeysFromSeeds(userID string, master, selfSigning, userSigning []byte) (*CrossSigningKeys, error) {
+	if userID == "" {
+		return nil, errors.New("userID must not be empty")
+	}
+
+	keys := &CrossSigningKeys{UserID: userID}
+	seeds := [][]byte{master, selfSigning, userSigning}
+	for i, key := range []**PkSigning{&keys.Master, &keys.SelfSigning, &keys.UserSigning} {
+		signing, err := NewPkSigningFromSeed(seeds[i])
+		if err != nil {
+			return nil, err
+		}
+		*key = signing
+	}
+	return keys, nil
+}
+
+// Clear clears the memory used to back the keys.
+func (c *CrossSigningKeys) Clear() {
+	c.Master.Clear()
+	c.SelfSigning.Clear()
+	c.UserSigning.Clear()
+}
+
+// PublicKeys returns the public keys to upload. The self-signing and
+// user-signing keys are signed by the master key, the master key is signed
+// by the device of the account.
+func (c *CrossSigningKeys) PublicKeys(account *Account, deviceID string) (*CrossSigningPublicKeys, error) {
+	keys := &CrossSigningPublicKeys{
+		Master:      c.publicKey(c.Master, CrossSigningUsageMaster),
+		SelfSigning: c.publicKey(c.SelfSigning, CrossSigningUsageSelfSigning),
+		UserSigning: c.publicKey(c.UserSigning, CrossSigningUsageUserSigning),
+	}
+
+	signed, err := SignJSON(account, c.UserID, deviceID, keys.Master)
+	if err != nil {
+		return nil, err
+	}
+	keys.Master.Signatures.set(c.UserID, ED25519KeyID(deviceID), signatureOf(signed, c.UserID, ED25519KeyID(deviceID)))
+
+	for _, key := range []*CrossSigningKey{keys.SelfSigning, keys.UserSigning} {
+		err = pkSignInto(c.Master, c.UserID, key, &key.Signatures)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (c *CrossSigningKeys) publicKey(signing *PkSigning, usage string) *CrossSigningKey {
+	return &CrossSigningKey{
+		UserID: c.UserID,
+		Usage:  []string{usage},
+		Keys:   map[string]string{ED25519KeyID(signing.PublicKey()): signing.PublicKey()},
+	}
+}
+
+// SignDevice signs one of our own devices with the self-signing key.
+func (c *CrossSigningKeys) SignDevice(device *DeviceKeys) error {
+	if device == nil {
+		return errors.New("device must not be nil")
+	}
+	if device.UserID != c.UserID {
+		return fmt.Errorf("device of %s can not be self-signed by %s", device.UserID, c.UserID)
+	}
+	return pkSignInto(c.SelfSigning, c.UserID, device, &device.Signatures)
+}
+
+// SignUser signs the master key of another user with the user-signing key.
+func (c *CrossSigningKeys) SignUser(master *CrossSigningKey) error {
+	if master == nil {
+		return errors.New("master must not be nil")
+	}
+	if master.UserID == c.UserID {
+		return errors.New("our own master key can not be signed with the user-signing key")
+	}
+	err := master.check(master.UserID, CrossSigningUsageMaster)
+	if err != nil {
+		return err
+	}
+	return pkSignInto(c.UserSigning, c.UserID, master, &master.Signatures)
+}
+
+// pkSignInto signs obj with the key and adds the signature to signatures.
+func pkSignInto(signing *PkSigning, userID string, obj interface{}, signatures *Signatures) error {
+	keyID := ED25519KeyID(signing.PublicKey())
+	signed, err := signJSON(obj, userID, keyID, signing.Sign)
+	if err != nil {
+		return err
+	}
+	signatures.set(userID, keyID, signatureOf(signed, userID, keyID))
+	return nil
+}
+
+// TrustLevel tells how far a device is trusted.
+type TrustLevel int
+
+const (
+	// TrustUnverified means the device is not signed by its user.
+	TrustUnverified TrustLevel = iota
+	// TrustCrossSigned means the device is signed by its user's
+	// self-signing key, but the master key of the user is not verified.
+	TrustCrossSigned
+	// TrustVerified means the device was verified, either directly or by
+	// a chain of signatures starting at our own device.
+	TrustVerified
+)
+
+func (l TrustLevel) String() string {
+	switch l {
+	case TrustUnverified:
+		return "unverified"
+	case TrustCrossSigned:
+		return "cross-signed"
+	case TrustVerified:
+		return "verified"
+	}
+	return fmt.Sprintf("TrustLevel(%d)", int(l))
+}
+
+// CrossSigningTrust tracks cross-signing keys and devices and tells how far
+// each device is trusted. It is safe for concurrent use.
+//
+// Our own master key is trusted if it is signed by our own device. The
+// master key of another user is trusted if it is signed by our trusted
+// user-signing key. Master keys can also be marked as verified, e.g. after
+// an interactive verification. A device is verified if it is signed by the
+// self-signing key of a trusted master key or was marked as verified.
+type CrossSigningTrust struct {
+	mutex    sync.Mutex
+	own      *DeviceKeys
+	keys     map[string]*CrossSigningPublicKeys
+	devices  map[string]map[string]*DeviceKeys
+	verified map[string]map[string]string
+	masters  map[string]string
+}
+
+// NewCrossSigningTrust creates a CrossSigningTrust for our own device.
+func NewCrossSigningTrust(own *DeviceKeys) *CrossSigningTrust {
+	t := &CrossSigningTrust{
+		own:      own,
+		keys:     make(map[string]*CrossSigningPublicKeys),
+		devices:  make(map[string]map[string]*DeviceKeys),
+		verified: make(map[string]map[string]string),
+		masters:  make(map[string]string),
+	}
+	t.devices[own.UserID] = map[string]*DeviceKeys{own.DeviceID: own}
+	return t
+}
+
+// AddKeys verifies the cross-signing keys of a user and stores them,
+// replacing the previous keys of the user. The user-signing key is
+// dropped for other users.
+func (t *CrossSigningTrust) AddKeys(keys *CrossSigningPublicKeys) error {
+	if keys == nil {
+		return errors.New("keys must not be nil")
+	}
+	err := keys.Verify()
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stored := *keys
+	if stored.Master.UserID != t.own.UserID {
+		stored.UserSigning = nil
+	}
+	t.keys[stored.Master.UserID] = &stored
+	return nil
+}
+
+// Keys returns the cross-signing keys of the user or nil if there are
+// none.
+func (t *CrossSigningTrust) Keys(userID string) *CrossSigningPublicKeys {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.keys[userID]
+}
+
+// AddDevice stores the device keys, replacing previous keys of the device.
+func (t *CrossSigningTrust) AddDevice(device *DeviceKeys) error {
+	if device == nil {
+		return errors.New("device must not be nil")
+	}
+	if device.UserID == "" || device.DeviceID == "" {
+		return errors.New("userID and deviceID must not be empty")
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.devices[device.UserID] == nil {
+		t.devices[device.UserID] = make(map[string]*DeviceKeys)
+	}
+	t.devices[device.UserID][device.DeviceID] = device
+	return nil
+}
+
+// MarkDeviceVerified marks the device as verified, e.g. after an
+// interactive verification. The mark is bound to the ed25519 key of the
+// device and lost if the key changes.
+func (t *CrossSigningTrust) MarkDeviceVerified(device *DeviceKeys) error {
+	err := t.AddDevice(device)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.verified[device.UserID] == nil {
+		t.verified[device.UserID] = make(map[string]string)
+	}
+	t.verified[device.UserID][device.DeviceID] = device.ED25519()
+	return nil
+}
+
+// MarkMasterKeyVerified marks the master key of the user as verified. The
+// mark is lost if the user gets another master key.
+func (t *CrossSigningTrust) MarkMasterKeyVerified(userID, publicKey string) error {
+	if userID == "" || publicKey == "" {
+		return errors.New("userID and publicKey must not be empty")
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.masters[userID] = publicKey
+	return nil
+}
+
+// UserTrusted tells whether the master key of the user is trusted.
+func (t *CrossSigningTrust) UserTrusted(userID string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.masterTrusted(userID)
+}
+
+func (t *CrossSigningTrust) masterTrusted(userID string) bool {
+	keys := t.keys[userID]
+	if keys == nil {
+		return false
+	}
+	if key, ok := t.masters[userID]; ok && key == keys.Master.PublicKey() {
+		return true
+	}
+
+	if userID == t.own.UserID {
+		return VerifySignedJSON(keys.Master, userID, ED25519KeyID(t.own.DeviceID), t.own.ED25519()) == nil
+	}
+
+	own := t.keys[t.own.UserID]
+	if own == nil || own.UserSigning == nil || !t.masterTrusted(t.own.UserID) {
+		return false
+	}
+	return own.UserSigning.verify(keys.Master) == nil
+}
+
+// DeviceTrust returns how far the device is trusted.
+func (t *CrossSigningTrust) DeviceTrust(userID, deviceID string) TrustLevel {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	device := t.devices[userID][deviceID]
+	if device == nil {
+		return TrustUnverified
+	}
+	if userID == t.own.UserID && deviceID == t.own.DeviceID && device.ED25519() == t.own.ED25519() {
+		return TrustVerified
+	}
+	if key, ok := t.verified[userID][deviceID]; ok && key == device.ED25519() {
+		return TrustVerified
+	}
+
+	keys := t.keys[userID]
+	if keys == nil || keys.SelfSigning.verify(device) != nil {
+		return TrustUnverified
+	}
+	if t.masterTrusted(userID) {
+		return TrustVerified
+	}
+	return TrustCrossSigned
+}
@@ -0,0 +1,204 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testCrossSigningUser struct {
+	account *Account
+	device  *DeviceKeys
+	keys    *CrossSigningKeys
+	public  *CrossSigningPublicKeys
+}
+
+func createCrossSigningUser(userID, deviceID string) *testCrossSigningUser {
+	account, _ := NewAccount()
+	device, _ := NewDeviceKeys(account, userID, deviceID)
+	keys, _ := NewCrossSigningKeys(userID)
+	public, _ := keys.PublicKeys(account, deviceID)
+	return &testCrossSigningUser{account, device, keys, public}
+}
+
+func TestCrossSigningKeys(t *testing.T) {
+	Convey("Cross-signing keys", t, func() {
+		user := createCrossSigningUser("@alice:example.org", "ALICE")
+
+		Convey("should have valid public keys.", func() {
+			So(user.public.Verify(), ShouldBeNil)
+			So(user.public.Master.PublicKey(), ShouldEqual, user.keys.Master.PublicKey())
+			So(user.public.Master.Usage, ShouldResemble, []string{CrossSigningUsageMaster})
+		})
+		Convey("should sign the master key with the device.", func() {
+			err := VerifySignedJSON(user.public.Master, "@alice:example.org", ED25519KeyID("ALICE"), user.device.ED25519())
+			So(err, ShouldBeNil)
+		})
+		Convey("should be restored from their seeds.", func() {
+			restored, err := NewCrossSigningKeysFromSeeds("@alice:example.org",
+				user.keys.Master.Seed(), user.keys.SelfSigning.Seed(), user.keys.UserSigning.Seed())
+			So(err, ShouldBeNil)
+			So(restored.Master.PublicKey(), ShouldEqual, user.keys.Master.PublicKey())
+			So(restored.SelfSigning.PublicKey(), ShouldEqual, user.keys.SelfSigning.PublicKey())
+			So(restored.UserSigning.PublicKey(), ShouldEqual, user.keys.UserSigning.PublicKey())
+		})
+		Convey("should sign our own devices.", func() {
+			account, _ := NewAccount()
+			device, _ := NewDeviceKeys(account, "@alice:example.org", "OTHER")
+			So(user.keys.SignDevice(device), ShouldBeNil)
+			So(user.public.SelfSigning.verify(device), ShouldBeNil)
+		})
+		Convey("should not sign devices of other users.", func() {
+			account, _ := NewAccount()
+			device, _ := NewDeviceKeys(account, "@bob:example.org", "BOB")
+			So(user.keys.SignDevice(device), ShouldNotBeNil)
+		})
+		Convey("should sign master keys of other users.", func() {
+			bob := createCrossSigningUser("@bob:example.org", "BOB")
+			So(user.keys.SignUser(bob.public.Master), ShouldBeNil)
+			So(user.public.UserSigning.verify(bob.public.Master), ShouldBeNil)
+		})
+		Convey("should not sign our own master key with the user-signing key.", func() {
+			So(user.keys.SignUser(user.public.Master), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCrossSigningPublicKeysVerify(t *testing.T) {
+	Convey("Verifying cross-signing keys", t, func() {
+		user := createCrossSigningUser("@alice:example.org", "ALICE")
+		other := createCrossSigningUser("@alice:example.org", "ALICE")
+
+		Convey("should fail if the self-signing key is not signed by the master key.", func() {
+			user.public.SelfSigning = other.public.SelfSigning
+			So(user.public.Verify(), ShouldNotBeNil)
+		})
+		Convey("should fail if the user-signing key is not signed by the master key.", func() {
+			user.public.UserSigning = other.public.UserSigning
+			So(user.public.Verify(), ShouldNotBeNil)
+		})
+		Convey("should fail for keys of the wrong usage.", func() {
+			user.public.SelfSigning = user.public.UserSigning
+			So(user.public.Verify(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseCrossSigningKey(t *testing.T) {
+	Convey("Parsing a cross-signing key", t, func() {
+		user := createCrossSigningUser("@alice:example.org", "ALICE")
+		data, _ := json.Marshal(user.public.Master)
+
+		Convey("should work for the right user and usage.", func() {
+			key, err := ParseCrossSigningKey(data, "@alice:example.org", CrossSigningUsageMaster)
+			So(err, ShouldBeNil)
+			So(key.PublicKey(), ShouldEqual, user.keys.Master.PublicKey())
+			So(key.KeyID(), ShouldEqual, "ed25519:"+user.keys.Master.PublicKey())
+		})
+		Convey("should fail for another user.", func() {
+			_, err := ParseCrossSigningKey(data, "@bob:example.org", CrossSigningUsageMaster)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail for another usage.", func() {
+			_, err := ParseCrossSigningKey(data, "@alice:example.org", CrossSigningUsageSelfSigning)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCrossSigningTrust(t *testing.T) {
+	Convey("Cross-signing trust", t, func() {
+		alice := createCrossSigningUser("@alice:example.org", "ALICE")
+		bob := createCrossSigningUser("@bob:example.org", "BOB")
+		trust := NewCrossSigningTrust(alice.device)
+
+		aliceAccount, _ := NewAccount()
+		aliceDevice, _ := NewDeviceKeys(aliceAccount, "@alice:example.org", "ALICE2")
+		alice.keys.SignDevice(aliceDevice)
+		trust.AddDevice(aliceDevice)
+
+		bob.keys.SignDevice(bob.device)
+		trust.AddDevice(bob.device)
+
+		Convey("should verify our own device.", func() {
+			So(trust.DeviceTrust("@alice:example.org", "ALICE"), ShouldEqual, TrustVerified)
+		})
+		Convey("should not trust unknown devices.", func() {
+			So(trust.DeviceTrust("@carol:example.org", "CAROL"), ShouldEqual, TrustUnverified)
+		})
+		Convey("should not trust devices without cross-signing keys.", func() {
+			So(trust.DeviceTrust("@alice:example.org", "ALICE2"), ShouldEqual, TrustUnverified)
+			So(trust.DeviceTrust("@bob:example.org", "BOB"), ShouldEqual, TrustUnverified)
+		})
+		Convey("with our own keys", func() {
+			So(trust.AddKeys(alice.public), ShouldBeNil)
+
+			Convey("should verify our own self-signed devices.", func() {
+				So(trust.UserTrusted("@alice:example.org"), ShouldBeTrue)
+				So(trust.DeviceTrust("@alice:example.org", "ALICE2"), ShouldEqual, TrustVerified)
+			})
+			Convey("should only cross-sign devices of unverified users.", func() {
+				So(trust.AddKeys(bob.public), ShouldBeNil)
+				So(trust.UserTrusted("@bob:example.org"), ShouldBeFalse)
+				So(trust.DeviceTrust("@bob:example.org", "BOB"), ShouldEqual, TrustCrossSigned)
+			})
+			Convey("should verify devices of users signed by our user-signing key.", func() {
+				alice.keys.SignUser(bob.public.Master)
+				So(trust.AddKeys(bob.public), ShouldBeNil)
+				So(trust.UserTrusted("@bob:example.org"), ShouldBeTrue)
+				So(trust.DeviceTrust("@bob:example.org", "BOB"), ShouldEqual, TrustVerified)
+			})
+			Convey("should not trust the user-signing key of other users.", func() {
+				So(trust.AddKeys(bob.public), ShouldBeNil)
+				So(trust.Keys("@bob:example.org").UserSigning, ShouldBeNil)
+			})
+		})
+		Convey("should not trust our own keys if they are not signed by our device.", func() {
+			other := createCrossSigningUser("@alice:example.org", "ALICE")
+			other.keys.SignDevice(aliceDevice)
+			So(trust.AddKeys(other.public), ShouldBeNil)
+			So(trust.UserTrusted("@alice:example.org"), ShouldBeFalse)
+			So(trust.DeviceTrust("@alice:example.org", "ALICE2"), ShouldEqual, TrustCrossSigned)
+		})
+		Convey("should reject invalid keys.", func() {
+			bob.public.SelfSigning = alice.public.SelfSigning
+			So(trust.AddKeys(bob.public), ShouldNotBeNil)
+		})
+		Convey("should verify devices marked as verified.", func() {
+			So(trust.MarkDeviceVerified(bob.device), ShouldBeNil)
+			So(trust.DeviceTrust("@bob:example.org", "BOB"), ShouldEqual, TrustVerified)
+
+			Convey("until their key changes.", func() {
+				account, _ := NewAccount()
+				replaced, _ := NewDeviceKeys(account, "@bob:example.org", "BOB")
+				trust.AddDevice(replaced)
+				So(trust.DeviceTrust("@bob:example.org", "BOB"), ShouldEqual, TrustUnverified)
+			})
+		})
+		Convey("should trust master keys marked as verified.", func() {
+			So(trust.AddKeys(bob.public), ShouldBeNil)
+			So(trust.MarkMasterKeyVerified("@bob:example.org", bob.public.Master.PublicKey()), ShouldBeNil)
+			So(trust.UserTrusted("@bob:example.org"), ShouldBeTrue)
+			So(trust.DeviceTrust("@bob:example.org", "BOB"), ShouldEqual, TrustVerified)
+
+			Convey("until the master key changes.", func() {
+				other := createCrossSigningUser("@bob:example.org", "BOB")
+				So(trust.AddKeys(other.public), ShouldBeNil)
+				So(trust.UserTrusted("@bob:example.org"), ShouldBeFalse)
+			})
+		})
+		Convey("should not mark empty master keys as verified.", func() {
+			So(trust.MarkMasterKeyVerified("@bob:example.org", ""), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTrustLevelString(t *testing.T) {
+	Convey("Trust levels should have names.", t, func() {
+		So(TrustUnverified.String(), ShouldEqual, "unverified")
+		So(TrustCrossSigned.String(), ShouldEqual, "cross-signed")
+		So(TrustVerified.String(), ShouldEqual, "verified")
+		So(TrustLevel(42).String(), ShouldEqual, "TrustLevel(42)")
+	})
+}
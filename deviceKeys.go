@@ -0,0 +1,137 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DeviceKeys are the identity keys of a device as uploaded to the server.
+type DeviceKeys struct {
+	UserID     string                 `json:"user_id"`
+	DeviceID   string                 `json:"device_id"`
+	Algorithms []string               `json:"algorithms"`
+	Keys       map[string]string      `json:"keys"`
+	Signatures Signatures             `json:"signatures,omitempty"`
+	Unsigned   map[string]interface{} `json:"unsigned,omitempty"`
+}
+
+// NewDeviceKeys builds the device keys of the account, signed by the account.
+func NewDeviceKeys(account *Account, userID, deviceID string) (*DeviceKeys, error) {
+	if userID == "" || deviceID == "" {
+		return nil, errors.New("userID and deviceID must not be empty")
+	}
+
+	identityKeys := account.IdentityKeys()
+	keys := &DeviceKeys{
+		UserID:     userID,
+		DeviceID:   deviceID,
+		Algorithms: []string{AlgorithmOlmV1, AlgorithmMegolmV1},
+		Keys: map[string]string{
+			KeyAlgorithmCurve25519 + ":" + deviceID: identityKeys.Curve25519,
+			ED25519KeyID(deviceID):                  identityKeys.ED25519,
+		},
+	}
+
+	signed, err := SignJSON(account, userID, deviceID, keys)
+	if err != nil {
+		return nil, err
+	}
+	keys.Signatures.set(userID, ED25519KeyID(deviceID), signatureOf(signed, userID, ED25519KeyID(deviceID)))
+
+	return keys, nil
+}
+
+// ParseDeviceKeys parses the device keys of a peer and validates them: they
+// must belong to the given user and device, contain both identity keys and
+// be signed by their own ed25519 key.
+func ParseDeviceKeys(data []byte, userID, deviceID string) (*DeviceKeys, error) {
+	keys := &DeviceKeys{}
+	err := json.Unmarshal(data, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys.UserID != userID || keys.DeviceID != deviceID {
+		return nil, fmt.Errorf("device keys of %s %s were returned for %s %s", keys.UserID, keys.DeviceID, userID, deviceID)
+	}
+	if keys.Curve25519() == "" || keys.ED25519() == "" {
+		return nil, errors.New("device keys are incomplete")
+	}
+
+	err = VerifySignedJSON(data, userID, ED25519KeyID(deviceID), keys.ED25519())
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Curve25519 returns the Curve25519 identity key of the device.
+func (k *DeviceKeys) Curve25519() string {
+	return k.Keys[KeyAlgorithmCurve25519+":"+k.DeviceID]
+}
+
+// ED25519 returns the ed25519 fingerprint key of the device.
+func (k *DeviceKeys) ED25519() string {
+	return k.Keys[ED25519KeyID(k.DeviceID)]
+}
+
+// SignedOneTimeKey is a one time key signed by the device it belongs to.
+type SignedOneTimeKey struct {
+	Key        string     `json:"key"`
+	Signatures Signatures `json:"signatures"`
+}
+
+// NewSignedOneTimeKeys signs the unpublished one time keys of the account.
+// The keys of the returned map are the key IDs, e.g. "signed_curve25519:AAAAAQ".
+func NewSignedOneTimeKeys(account *Account, userID, deviceID string) (map[string]*SignedOneTimeKey, error) {
+	if userID == "" || deviceID == "" {
+		return nil, errors.New("userID and deviceID must not be empty")
+	}
+
+	keyID := ED25519KeyID(deviceID)
+	result := make(map[string]*SignedOneTimeKey)
+	for id, key := range account.OneTimeKeys().Curve25519 {
+		otk := &SignedOneTimeKey{Key: key}
+
+		signed, err := SignJSON(account, userID, deviceID, otk)
+		if err != nil {
+			return nil, err
+		}
+		otk.Signatures.set(userID, keyID, signatureOf(signed, userID, keyID))
+
+		result[KeyAlgorithmSignedCurve25519+":"+id] = otk
+	}
+
+	return result, nil
+}
+
+// ParseSignedOneTimeKey parses a signed one time key of the given device
+// and verifies its signature. keyID is the ID the key was published under,
+// e.g. "signed_curve25519:AAAAAQ".
+func ParseSignedOneTimeKey(keyID string, data []byte, device *DeviceKeys) (*SignedOneTimeKey, error) {
+	if !strings.HasPrefix(keyID, KeyAlgorithmSignedCurve25519+":") {
+		return nil, fmt.Errorf("unexpected one time key algorithm in %q", keyID)
+	}
+	if device == nil {
+		return nil, errors.New("device must not be nil")
+	}
+
+	otk := &SignedOneTimeKey{}
+	err := json.Unmarshal(data, otk)
+	if err != nil {
+		return nil, err
+	}
+	if otk.Key == "" {
+		return nil, errors.New("one time key is empty")
+	}
+
+	err = VerifySignedJSON(data, device.UserID, ED25519KeyID(device.DeviceID), device.ED25519())
+	if err != nil {
+		return nil, err
+	}
+
+	return otk, nil
+}
@@ -0,0 +1,104 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewDeviceKeys(t *testing.T) {
+	acc, _ := NewAccount()
+
+	Convey("Building device keys", t, func() {
+		keys, err := NewDeviceKeys(acc, "@user:example.org", "DEVICE")
+
+		Convey("should work.", func() {
+			So(err, ShouldBeNil)
+			So(keys.Algorithms, ShouldContain, AlgorithmOlmV1)
+			So(keys.Curve25519(), ShouldEqual, acc.IdentityKeys().Curve25519)
+			So(keys.ED25519(), ShouldEqual, acc.IdentityKeys().ED25519)
+		})
+		Convey("should produce keys that can be parsed again.", func() {
+			data, _ := json.Marshal(keys)
+			parsed, err := ParseDeviceKeys(data, "@user:example.org", "DEVICE")
+			So(err, ShouldBeNil)
+			So(parsed, ShouldResemble, keys)
+		})
+	})
+	Convey("Building device keys with empty IDs should not work.", t, func() {
+		_, err := NewDeviceKeys(acc, "", "")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseDeviceKeys(t *testing.T) {
+	acc, _ := NewAccount()
+	keys, _ := NewDeviceKeys(acc, "@user:example.org", "DEVICE")
+
+	Convey("Parsing device keys", t, func() {
+		Convey("for another device should not work.", func() {
+			data, _ := json.Marshal(keys)
+			_, err := ParseDeviceKeys(data, "@user:example.org", "OTHER")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("with a replaced key should not work.", func() {
+			other, _ := NewAccount()
+			forged := *keys
+			forged.Keys = map[string]string{
+				"curve25519:DEVICE": other.IdentityKeys().Curve25519,
+				"ed25519:DEVICE":    keys.ED25519(),
+			}
+			data, _ := json.Marshal(forged)
+			_, err := ParseDeviceKeys(data, "@user:example.org", "DEVICE")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("without signature should not work.", func() {
+			unsigned := *keys
+			unsigned.Signatures = nil
+			data, _ := json.Marshal(unsigned)
+			_, err := ParseDeviceKeys(data, "@user:example.org", "DEVICE")
+			So(err, ShouldEqual, ErrSignatureMissing)
+		})
+		Convey("that are invalid JSON should not work.", func() {
+			_, err := ParseDeviceKeys([]byte("{"), "@user:example.org", "DEVICE")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSignedOneTimeKeys(t *testing.T) {
+	acc, _ := NewAccount()
+	acc.GenerateOneTimeKeys(2)
+	device, _ := NewDeviceKeys(acc, "@user:example.org", "DEVICE")
+
+	Convey("Signing one time keys", t, func() {
+		otks, err := NewSignedOneTimeKeys(acc, "@user:example.org", "DEVICE")
+
+		Convey("should sign all unpublished keys.", func() {
+			So(err, ShouldBeNil)
+			So(otks, ShouldHaveLength, 2)
+		})
+		Convey("should produce keys that can be parsed again.", func() {
+			for keyID, otk := range otks {
+				data, _ := json.Marshal(otk)
+				parsed, err := ParseSignedOneTimeKey(keyID, data, device)
+				So(err, ShouldBeNil)
+				So(parsed.Key, ShouldEqual, otk.Key)
+			}
+		})
+		Convey("should produce keys that other devices reject.", func() {
+			other, _ := NewAccount()
+			otherDevice, _ := NewDeviceKeys(other, "@user:example.org", "DEVICE")
+			for keyID, otk := range otks {
+				data, _ := json.Marshal(otk)
+				_, err := ParseSignedOneTimeKey(keyID, data, otherDevice)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+	Convey("Parsing an unsigned one time key should not work.", t, func() {
+		_, err := ParseSignedOneTimeKey("curve25519:AAAAAQ", []byte(`{"key":"abc"}`), device)
+		So(err, ShouldNotBeNil)
+	})
+}
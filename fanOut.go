@@ -0,0 +1,83 @@
+package golm
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// FanOutTarget is a device a message is encrypted for.
+type FanOutTarget struct {
+	TheirIdentityKey string
+	Session          *Session
+}
+
+// FanOutResult is the message encrypted for a single target.
+type FanOutResult struct {
+	TheirIdentityKey string
+	Message          string
+	Type             MessageType
+	// Err is set if encrypting for the target failed.
+	Err error
+}
+
+// FanOutEncrypt encrypts the same plaintext for every target using a pool
+// of at most workers goroutines. If workers is not positive, one worker
+// per CPU is used. The result at index i belongs to the target at index i.
+//
+// Targets sharing a session are encrypted one after another by the same
+// worker, in the order they were passed, so every session is used by one
+// goroutine at a time. The sessions must not be used elsewhere while
+// FanOutEncrypt runs, and they have to be saved afterwards as their
+// ratchets advanced.
+func FanOutEncrypt(targets []FanOutTarget, plaintext string, workers int) []FanOutResult {
+	results := make([]FanOutResult, len(targets))
+
+	var groups [][]int
+	groupOf := make(map[*Session]int)
+	for i, target := range targets {
+		results[i].TheirIdentityKey = target.TheirIdentityKey
+		if target.Session == nil {
+			results[i].Err = errors.New("session must not be nil")
+			continue
+		}
+
+		group, ok := groupOf[target.Session]
+		if !ok {
+			group = len(groups)
+			groupOf[target.Session] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+
+	jobs := make(chan []int)
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				for _, i := range group {
+					result := &results[i]
+					result.Message, result.Type, result.Err = targets[i].Session.Encrypt(plaintext)
+				}
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		jobs <- group
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,101 @@
+package golm
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createFanOutTargets(n int) ([]FanOutTarget, []*Account) {
+	from, _ := NewAccount()
+
+	targets := make([]FanOutTarget, n)
+	recipients := make([]*Account, n)
+	for i := range targets {
+		to, _ := NewAccount()
+		to.GenerateOneTimeKeys(1)
+		key := to.IdentityKeys().Curve25519
+		sess, _ := NewOutboundSession(from, key, to.OneTimeKeys().Curve(0))
+
+		targets[i] = FanOutTarget{TheirIdentityKey: key, Session: sess}
+		recipients[i] = to
+	}
+	return targets, recipients
+}
+
+func TestFanOutEncrypt(t *testing.T) {
+	Convey("Encrypting for many devices", t, func() {
+		targets, recipients := createFanOutTargets(16)
+		results := FanOutEncrypt(targets, "payload", 4)
+
+		Convey("should return a result per target in order.", func() {
+			So(results, ShouldHaveLength, len(targets))
+			for i, result := range results {
+				So(result.Err, ShouldBeNil)
+				So(result.TheirIdentityKey, ShouldEqual, targets[i].TheirIdentityKey)
+				So(result.Type, ShouldEqual, MessageTypePreKey)
+			}
+		})
+		Convey("should be decryptable by every recipient.", func() {
+			for i, result := range results {
+				sess, err := NewInboundSession(recipients[i], result.Message)
+				So(err, ShouldBeNil)
+				plaintext, err := sess.Decrypt(result.Type, result.Message)
+				So(err, ShouldBeNil)
+				So(plaintext, ShouldEqual, "payload")
+			}
+		})
+	})
+	Convey("Targets sharing a session should be encrypted in order.", t, func() {
+		sess, _, to := createOutboundSession()
+		key := to.IdentityKeys().Curve25519
+		targets := []FanOutTarget{{key, sess}, {key, sess}, {key, sess}}
+
+		results := FanOutEncrypt(targets, "payload", 8)
+
+		inbound, _ := NewInboundSession(to, results[0].Message)
+		for _, result := range results {
+			So(result.Err, ShouldBeNil)
+			plaintext, err := inbound.Decrypt(result.Type, result.Message)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "payload")
+		}
+	})
+	Convey("A target without a session should fail on its own.", t, func() {
+		sess, _, _ := createOutboundSession()
+		results := FanOutEncrypt([]FanOutTarget{{"a", nil}, {"b", sess}}, "payload", 0)
+		So(results[0].Err, ShouldNotBeNil)
+		So(results[1].Err, ShouldBeNil)
+	})
+	Convey("An empty plaintext should fail for every target.", t, func() {
+		sess, _, _ := createOutboundSession()
+		results := FanOutEncrypt([]FanOutTarget{{"a", sess}}, "", 0)
+		So(results[0].Err, ShouldNotBeNil)
+	})
+	Convey("No targets should return no results.", t, func() {
+		So(FanOutEncrypt(nil, "payload", 0), ShouldBeEmpty)
+	})
+}
+
+func BenchmarkFanOutEncrypt1000(b *testing.B) {
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			targets, _ := createFanOutTargets(1000)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				FanOutEncrypt(targets, "room key payload", workers)
+			}
+		})
+	}
+}
+
+func BenchmarkSerialEncrypt1000(b *testing.B) {
+	targets, _ := createFanOutTargets(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, target := range targets {
+			target.Session.Encrypt("room key payload")
+		}
+	}
+}
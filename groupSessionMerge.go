@@ -0,0 +1,170 @@
+package golm
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrGroupSessionConflict is returned if two copies of an inbound group
+// session disagree about the ratchet, the room or the sender and neither
+// can be trusted more than the other.
+var ErrGroupSessionConflict = errors.New("copies of the group session disagree")
+
+// MergeInboundGroupSessions merges two copies of the same inbound group
+// session and returns the entry that should be kept.
+//
+// The copy with the lowest FirstKnownIndex is kept, as a later index can
+// never be turned back into an earlier one. If both start at the same
+// index a verified copy is preferred, otherwise the existing one is kept.
+//
+// Before an earlier copy is accepted, it is checked to agree with the
+// other copy at the later index. If they disagree, the verified copy is
+// kept; if neither or both are verified ErrGroupSessionConflict is
+// returned. Copies starting at the same index must have the same ratchet,
+// otherwise ErrGroupSessionConflict is returned.
+//
+// The metadata is taken from the copy whose ratchet is kept, so the
+// forwarding chain describes the kept ratchet. Missing fields are filled
+// in from the other copy. Copies claiming different rooms or senders are
+// rejected with ErrGroupSessionConflict.
+func MergeInboundGroupSessions(existing, incoming *InboundGroupSessionEntry) (*InboundGroupSessionEntry, error) {
+	if existing == nil || existing.Session == nil || incoming == nil || incoming.Session == nil {
+		return nil, errors.New("sessions must not be nil")
+	}
+	if existing.Session.ID() != incoming.Session.ID() {
+		return nil, errors.New("sessions have different IDs")
+	}
+
+	sess, err := mergeGroupSessionRatchets(existing.Session, incoming.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	preferred, other := existing, incoming
+	if sess == incoming.Session {
+		preferred, other = incoming, existing
+	}
+
+	merged := *preferred
+	merged.Session = sess
+	merged.RoomID, err = mergeGroupSessionField(preferred.RoomID, other.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	merged.SenderKey, err = mergeGroupSessionField(preferred.SenderKey, other.SenderKey)
+	if err != nil {
+		return nil, err
+	}
+	if merged.SigningKey == "" {
+		merged.SigningKey = other.SigningKey
+	}
+	merged.ForwardingChain = append([]string(nil), preferred.ForwardingChain...)
+
+	return &merged, nil
+}
+
+func mergeGroupSessionRatchets(existing, incoming *InboundGroupSession) (*InboundGroupSession, error) {
+	existingIndex := existing.FirstKnownIndex()
+	incomingIndex := incoming.FirstKnownIndex()
+
+	if existingIndex == incomingIndex {
+		consistent, err := groupSessionsAgree(existing, incoming)
+		if err != nil {
+			return nil, err
+		}
+		if !consistent {
+			return nil, ErrGroupSessionConflict
+		}
+		if incoming.IsVerified() && !existing.IsVerified() {
+			return incoming, nil
+		}
+		return existing, nil
+	}
+
+	earlier, later := existing, incoming
+	if incomingIndex < existingIndex {
+		earlier, later = incoming, existing
+	}
+
+	consistent, err := groupSessionsAgree(earlier, later)
+	if err != nil {
+		return nil, err
+	}
+	if consistent {
+		return earlier, nil
+	}
+
+	switch {
+	case earlier.IsVerified() && !later.IsVerified():
+		return earlier, nil
+	case later.IsVerified() && !earlier.IsVerified():
+		return later, nil
+	}
+	return nil, ErrGroupSessionConflict
+}
+
+// groupSessionsAgree checks whether the earlier session reaches the same
+// ratchet state as the later one at the first index of the later one.
+// Sessions starting at the same index must have the same ratchet.
+func groupSessionsAgree(earlier, later *InboundGroupSession) (bool, error) {
+	index := later.FirstKnownIndex()
+
+	earlierKey, err := earlier.Export(index)
+	if err != nil {
+		return false, err
+	}
+	laterKey, err := later.Export(index)
+	if err != nil {
+		return false, err
+	}
+	return earlierKey == laterKey, nil
+}
+
+func mergeGroupSessionField(preferred, other string) (string, error) {
+	if preferred == "" {
+		return other, nil
+	}
+	if other != "" && other != preferred {
+		return "", ErrGroupSessionConflict
+	}
+	return preferred, nil
+}
+
+// groupSessionMergeMutex serializes MergeInboundGroupSession, so concurrent
+// imports of the same session do not overwrite each other's result.
+var groupSessionMergeMutex sync.Mutex
+
+// MergeInboundGroupSession merges the entry into the copy of the session
+// in the store, if there is one, and saves the result. The kept entry is
+// returned.
+//
+// Merges are serialized, so concurrent imports of the same session do not
+// lose a copy. Sessions saved to the store by other means while a merge
+// runs can still be overwritten.
+func MergeInboundGroupSession(store InboundGroupSessionStore, entry *InboundGroupSessionEntry) (*InboundGroupSessionEntry, error) {
+	if entry == nil || entry.Session == nil {
+		return nil, errors.New("session must not be nil")
+	}
+
+	groupSessionMergeMutex.Lock()
+	defer groupSessionMergeMutex.Unlock()
+
+	existing, err := store.LoadInboundGroupSession(entry.Session.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	merged := entry
+	if existing != nil {
+		merged, err = MergeInboundGroupSessions(existing, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = store.SaveInboundGroupSession(merged)
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
@@ -0,0 +1,158 @@
+package golm
+
+import (
+	"encoding/base64"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// importTamperedGroupSession imports the session at the given index with a
+// corrupted ratchet but the same session ID.
+func importTamperedGroupSession(in *InboundGroupSession, index uint32) *InboundGroupSession {
+	exported, _ := in.Export(index)
+	data, _ := base64.RawStdEncoding.DecodeString(exported)
+	data[10] ^= 0xFF
+	tampered, _ := ImportInboundGroupSession(base64.RawStdEncoding.EncodeToString(data))
+	return tampered
+}
+
+func TestMergeInboundGroupSessions(t *testing.T) {
+	const room = "!room:example.org"
+
+	Convey("Merging copies of a group session", t, func() {
+		out, _ := NewOutboundGroupSession()
+		key := out.Key()
+		early, _ := NewInboundGroupSession(key)
+		out.Encrypt("one")
+		late, _ := NewInboundGroupSession(out.Key())
+
+		Convey("should keep the earlier copy.", func() {
+			merged, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: late, RoomID: room},
+				&InboundGroupSessionEntry{Session: early, RoomID: room},
+			)
+			So(err, ShouldBeNil)
+			So(merged.Session, ShouldEqual, early)
+
+			merged, err = MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: early, RoomID: room},
+				&InboundGroupSessionEntry{Session: late, RoomID: room},
+			)
+			So(err, ShouldBeNil)
+			So(merged.Session, ShouldEqual, early)
+		})
+		Convey("should prefer a verified copy at the same index.", func() {
+			exported, _ := early.Export(0)
+			imported, _ := ImportInboundGroupSession(exported)
+			So(imported.IsVerified(), ShouldBeFalse)
+
+			merged, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: imported},
+				&InboundGroupSessionEntry{Session: early},
+			)
+			So(err, ShouldBeNil)
+			So(merged.Session, ShouldEqual, early)
+		})
+		Convey("should keep a verified later copy over a disagreeing earlier one.", func() {
+			tampered := importTamperedGroupSession(early, 0)
+
+			merged, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: late},
+				&InboundGroupSessionEntry{Session: tampered},
+			)
+			So(err, ShouldBeNil)
+			So(merged.Session, ShouldEqual, late)
+		})
+		Convey("should fail if unverified copies disagree.", func() {
+			exported, _ := late.Export(1)
+			imported, _ := ImportInboundGroupSession(exported)
+			tampered := importTamperedGroupSession(early, 0)
+
+			_, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: imported},
+				&InboundGroupSessionEntry{Session: tampered},
+			)
+			So(err, ShouldEqual, ErrGroupSessionConflict)
+		})
+		Convey("should fail if unverified copies at the same index disagree.", func() {
+			exported, _ := early.Export(0)
+			imported, _ := ImportInboundGroupSession(exported)
+			tampered := importTamperedGroupSession(early, 0)
+
+			_, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: imported},
+				&InboundGroupSessionEntry{Session: tampered},
+			)
+			So(err, ShouldEqual, ErrGroupSessionConflict)
+
+			_, err = MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: early},
+				&InboundGroupSessionEntry{Session: tampered},
+			)
+			So(err, ShouldEqual, ErrGroupSessionConflict)
+		})
+		Convey("should take the metadata of the kept copy.", func() {
+			merged, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: late, SenderKey: "sender", SigningKey: "signing"},
+				&InboundGroupSessionEntry{Session: early, RoomID: room, SenderKey: "sender", ForwardingChain: []string{"forwarder"}},
+			)
+			So(err, ShouldBeNil)
+			So(merged.Session, ShouldEqual, early)
+			So(merged.RoomID, ShouldEqual, room)
+			So(merged.SigningKey, ShouldEqual, "signing")
+			So(merged.ForwardingChain, ShouldResemble, []string{"forwarder"})
+		})
+		Convey("should fail for copies of different rooms.", func() {
+			_, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: early, RoomID: room},
+				&InboundGroupSessionEntry{Session: late, RoomID: "!other:example.org"},
+			)
+			So(err, ShouldEqual, ErrGroupSessionConflict)
+		})
+		Convey("should fail for different sessions.", func() {
+			_, other := createOutAndInboundGroupSession()
+			_, err := MergeInboundGroupSessions(
+				&InboundGroupSessionEntry{Session: early},
+				&InboundGroupSessionEntry{Session: other},
+			)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("in a store should keep the earlier copy.", func() {
+			store := NewMemoryStore()
+			store.SaveInboundGroupSession(&InboundGroupSessionEntry{Session: early, RoomID: room})
+
+			merged, err := MergeInboundGroupSession(store, &InboundGroupSessionEntry{Session: late, RoomID: room})
+			So(err, ShouldBeNil)
+			So(merged.Session, ShouldEqual, early)
+
+			stored, _ := store.LoadInboundGroupSession(early.ID())
+			So(stored.Session, ShouldEqual, early)
+		})
+		Convey("in a store should replace a later copy.", func() {
+			store := NewMemoryStore()
+			store.SaveInboundGroupSession(&InboundGroupSessionEntry{Session: late, RoomID: room})
+
+			_, err := MergeInboundGroupSession(store, &InboundGroupSessionEntry{Session: early, RoomID: room})
+			So(err, ShouldBeNil)
+
+			stored, _ := store.LoadInboundGroupSession(early.ID())
+			So(stored.Session.FirstKnownIndex(), ShouldEqual, 0)
+		})
+		Convey("in a store should not lose concurrent imports.", func() {
+			store := NewMemoryStore()
+			done := make(chan error)
+			for _, sess := range []*InboundGroupSession{late, early} {
+				go func(sess *InboundGroupSession) {
+					_, err := MergeInboundGroupSession(store, &InboundGroupSessionEntry{Session: sess, RoomID: room})
+					done <- err
+				}(sess)
+			}
+			So(<-done, ShouldBeNil)
+			So(<-done, ShouldBeNil)
+
+			stored, _ := store.LoadInboundGroupSession(early.ID())
+			So(stored.Session.FirstKnownIndex(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,208 @@
+package golm
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// RotationReason tells why an outbound group session must be replaced.
+type RotationReason int
+
+const (
+	// RotationNotNeeded means the session can still be used.
+	RotationNotNeeded RotationReason = iota
+	// RotationMessageLimit means the session encrypted too many messages.
+	RotationMessageLimit
+	// RotationTimeLimit means the session is too old.
+	RotationTimeLimit
+	// RotationMemberLeft means a member left the room, who must not be able
+	// to read future messages.
+	RotationMemberLeft
+	// RotationDeviceBlocked means a device the session was shared with got
+	// blocked.
+	RotationDeviceBlocked
+)
+
+func (r RotationReason) String() string {
+	switch r {
+	case RotationNotNeeded:
+		return "not needed"
+	case RotationMessageLimit:
+		return "message limit reached"
+	case RotationTimeLimit:
+		return "time limit exceeded"
+	case RotationMemberLeft:
+		return "member left"
+	case RotationDeviceBlocked:
+		return "device blocked"
+	}
+	return "unknown"
+}
+
+// RotationPolicy defines when the outbound group session of a room is
+// replaced. A zero limit means no limit.
+type RotationPolicy struct {
+	// MaxMessages is the number of messages a session encrypts at most.
+	MaxMessages uint32
+	// MaxAge is the time a session is used at most.
+	MaxAge time.Duration
+}
+
+// DefaultRotationPolicy is the policy of rooms that do not configure their
+// own. It uses the defaults of the m.room.encryption state event.
+var DefaultRotationPolicy = RotationPolicy{
+	MaxMessages: 100,
+	MaxAge:      7 * 24 * time.Hour,
+}
+
+// GroupSessionRotator hands out the outbound group session of each room and
+// replaces it with a new one when the policy of the room requires it. It is
+// safe for concurrent use.
+type GroupSessionRotator struct {
+	// DefaultPolicy is used for rooms without a policy of their own.
+	DefaultPolicy RotationPolicy
+
+	store OutboundGroupSessionStore
+	now   func() time.Time
+
+	mutex    sync.Mutex
+	policies map[string]RotationPolicy
+}
+
+// NewGroupSessionRotator creates a GroupSessionRotator keeping the sessions
+// in the store.
+func NewGroupSessionRotator(store OutboundGroupSessionStore) *GroupSessionRotator {
+	return &GroupSessionRotator{
+		DefaultPolicy: DefaultRotationPolicy,
+		store:         store,
+		now:           time.Now,
+		policies:      make(map[string]RotationPolicy),
+	}
+}
+
+// RoomKeyTracker returns a RoomKeyTracker for the sessions of the rotator.
+// It updates the stored sessions under the lock of the rotator.
+func (r *GroupSessionRotator) RoomKeyTracker() *RoomKeyTracker {
+	return &RoomKeyTracker{mutex: &r.mutex, store: r.store}
+}
+
+// SetPolicy sets the policy of the room.
+func (r *GroupSessionRotator) SetPolicy(roomID string, policy RotationPolicy) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.policies[roomID] = policy
+}
+
+// Policy returns the policy of the room.
+func (r *GroupSessionRotator) Policy(roomID string) RotationPolicy {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.policy(roomID)
+}
+
+func (r *GroupSessionRotator) policy(roomID string) RotationPolicy {
+	policy, ok := r.policies[roomID]
+	if !ok {
+		return r.DefaultPolicy
+	}
+	return policy
+}
+
+// Check returns why the session of the room must be replaced, or
+// RotationNotNeeded. A room without a session does not need rotation.
+func (r *GroupSessionRotator) Check(roomID string) (RotationReason, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry, err := r.store.LoadOutboundGroupSession(roomID)
+	if err != nil || entry == nil {
+		return RotationNotNeeded, err
+	}
+	return r.check(entry), nil
+}
+
+func (r *GroupSessionRotator) check(entry *OutboundGroupSessionEntry) RotationReason {
+	if entry.Rotate != RotationNotNeeded {
+		return entry.Rotate
+	}
+
+	policy := r.policy(entry.RoomID)
+	if policy.MaxMessages > 0 && entry.Session.MessageIndex() >= policy.MaxMessages {
+		return RotationMessageLimit
+	}
+	if policy.MaxAge > 0 && !entry.CreatedAt.IsZero() && r.now().Sub(entry.CreatedAt) >= policy.MaxAge {
+		return RotationTimeLimit
+	}
+	return RotationNotNeeded
+}
+
+// Session returns the session to encrypt the next message for the room
+// with. If the room has no session or its session must be rotated, a new
+// session is created and stored. The reason for replacing the previous
+// session is returned along with the session; a new session must be
+// shared with the members of the room before it is used.
+func (r *GroupSessionRotator) Session(roomID string) (*OutboundGroupSessionEntry, RotationReason, error) {
+	if roomID == "" {
+		return nil, RotationNotNeeded, errors.New("roomID must not be empty")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry, err := r.store.LoadOutboundGroupSession(roomID)
+	if err != nil {
+		return nil, RotationNotNeeded, err
+	}
+
+	reason := RotationNotNeeded
+	if entry != nil {
+		reason = r.check(entry)
+		if reason == RotationNotNeeded {
+			return entry, RotationNotNeeded, nil
+		}
+	}
+
+	sess, err := NewOutboundGroupSession()
+	if err != nil {
+		return nil, RotationNotNeeded, err
+	}
+
+	entry = &OutboundGroupSessionEntry{
+		Session:   sess,
+		RoomID:    roomID,
+		CreatedAt: r.now(),
+	}
+	err = r.store.SaveOutboundGroupSession(entry)
+	if err != nil {
+		return nil, RotationNotNeeded, err
+	}
+	return entry, reason, nil
+}
+
+// MemberLeft makes the session of the room be replaced before it is used
+// again, because a member left the room.
+func (r *GroupSessionRotator) MemberLeft(roomID string) error {
+	return r.invalidate(roomID, RotationMemberLeft)
+}
+
+// DeviceBlocked makes the session of the room be replaced before it is
+// used again, because a device in the room got blocked.
+func (r *GroupSessionRotator) DeviceBlocked(roomID string) error {
+	return r.invalidate(roomID, RotationDeviceBlocked)
+}
+
+func (r *GroupSessionRotator) invalidate(roomID string, reason RotationReason) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry, err := r.store.LoadOutboundGroupSession(roomID)
+	if err != nil || entry == nil || entry.Rotate != RotationNotNeeded {
+		return err
+	}
+
+	entry.Rotate = reason
+	return r.store.SaveOutboundGroupSession(entry)
+}
@@ -0,0 +1,95 @@
+package golm
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createGroupSessionRotator() (*GroupSessionRotator, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	rotator := NewGroupSessionRotator(NewMemoryStore())
+	rotator.now = clock.Now
+	return rotator, clock
+}
+
+func TestGroupSessionRotator(t *testing.T) {
+	const room = "!room:example.org"
+
+	Convey("A GroupSessionRotator", t, func() {
+		rotator, clock := createGroupSessionRotator()
+		rotator.SetPolicy(room, RotationPolicy{MaxMessages: 2, MaxAge: time.Hour})
+
+		entry, reason, err := rotator.Session(room)
+		So(err, ShouldBeNil)
+		So(reason, ShouldEqual, RotationNotNeeded)
+		So(entry.RoomID, ShouldEqual, room)
+		So(entry.CreatedAt, ShouldResemble, clock.now)
+
+		Convey("should keep the session while it is within the policy.", func() {
+			entry.Session.Encrypt("one")
+			again, reason, err := rotator.Session(room)
+			So(err, ShouldBeNil)
+			So(reason, ShouldEqual, RotationNotNeeded)
+			So(again.Session, ShouldEqual, entry.Session)
+		})
+		Convey("should rotate once the message limit is reached.", func() {
+			entry.Session.Encrypt("one")
+			entry.Session.Encrypt("two")
+
+			reason, _ := rotator.Check(room)
+			So(reason, ShouldEqual, RotationMessageLimit)
+
+			next, reason, err := rotator.Session(room)
+			So(err, ShouldBeNil)
+			So(reason, ShouldEqual, RotationMessageLimit)
+			So(next.Session.ID(), ShouldNotEqual, entry.Session.ID())
+		})
+		Convey("should rotate once the time limit is exceeded.", func() {
+			clock.now = clock.now.Add(time.Hour)
+			next, reason, _ := rotator.Session(room)
+			So(reason, ShouldEqual, RotationTimeLimit)
+			So(next.CreatedAt, ShouldResemble, clock.now)
+		})
+		Convey("should rotate after a member left.", func() {
+			So(rotator.MemberLeft(room), ShouldBeNil)
+			_, reason, _ := rotator.Session(room)
+			So(reason, ShouldEqual, RotationMemberLeft)
+
+			reason, _ = rotator.Check(room)
+			So(reason, ShouldEqual, RotationNotNeeded)
+		})
+		Convey("should rotate after a device got blocked.", func() {
+			So(rotator.DeviceBlocked(room), ShouldBeNil)
+			_, reason, _ := rotator.Session(room)
+			So(reason, ShouldEqual, RotationDeviceBlocked)
+		})
+		Convey("should keep the first reason.", func() {
+			rotator.MemberLeft(room)
+			rotator.DeviceBlocked(room)
+			reason, _ := rotator.Check(room)
+			So(reason, ShouldEqual, RotationMemberLeft)
+		})
+		Convey("should use the default policy for other rooms.", func() {
+			So(rotator.Policy("!other:example.org"), ShouldResemble, DefaultRotationPolicy)
+
+			entry, _, _ := rotator.Session("!other:example.org")
+			entry.Session.Encrypt("one")
+			entry.Session.Encrypt("two")
+			reason, _ := rotator.Check("!other:example.org")
+			So(reason, ShouldEqual, RotationNotNeeded)
+		})
+	})
+	Convey("A room without a session should not need rotation.", t, func() {
+		rotator, _ := createGroupSessionRotator()
+		reason, err := rotator.Check(room)
+		So(err, ShouldBeNil)
+		So(reason, ShouldEqual, RotationNotNeeded)
+		So(rotator.MemberLeft(room), ShouldBeNil)
+	})
+	Convey("Rotation reasons should have a description.", t, func() {
+		So(RotationMemberLeft.String(), ShouldEqual, "member left")
+		So(RotationReason(42).String(), ShouldEqual, "unknown")
+	})
+}
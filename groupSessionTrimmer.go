@@ -0,0 +1,100 @@
+package golm
+
+import "sync"
+
+// DefaultTrimStep is the default number of message indices by which a
+// GroupSessionTrimmer trims a session at once.
+const DefaultTrimStep = 1
+
+// GroupSessionTrimmer trims the inbound group sessions in a store once
+// their messages have been processed, so the keys of processed messages
+// are gone for good. It is safe for concurrent use.
+//
+// A message should be reported as processed once it never has to be
+// decrypted again, e.g. because it expired under the retention policy of
+// the room or its plaintext is kept elsewhere. Messages may be reported in
+// any order; a session is trimmed up to the first message that was not
+// processed yet.
+type GroupSessionTrimmer struct {
+	// Step is the number of indices that must be processed before a
+	// session is trimmed, as every trim re-imports the session.
+	Step uint32
+
+	store InboundGroupSessionStore
+
+	mutex sync.Mutex
+	// processed holds the processed indices of each session that are not
+	// trimmed yet.
+	processed map[string]map[uint32]bool
+}
+
+// NewGroupSessionTrimmer creates a GroupSessionTrimmer for the sessions in
+// the store.
+func NewGroupSessionTrimmer(store InboundGroupSessionStore) *GroupSessionTrimmer {
+	return &GroupSessionTrimmer{
+		Step:      DefaultTrimStep,
+		store:     store,
+		processed: make(map[string]map[uint32]bool),
+	}
+}
+
+// Processed reports that the message with the given index of the session
+// was processed. Returns whether the session was trimmed. Unknown sessions
+// are ignored.
+func (t *GroupSessionTrimmer) Processed(sessionID string, index uint32) (bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, err := t.store.LoadInboundGroupSession(sessionID)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	first := entry.Session.FirstKnownIndex()
+	if index < first {
+		return false, nil
+	}
+
+	processed, ok := t.processed[sessionID]
+	if !ok {
+		processed = make(map[uint32]bool)
+		t.processed[sessionID] = processed
+	}
+	processed[index] = true
+
+	next := first
+	for processed[next] {
+		next++
+	}
+	if next == first || next-first < t.Step {
+		return false, nil
+	}
+
+	err = entry.Session.ForgetBefore(next)
+	if err != nil {
+		return false, err
+	}
+	err = t.store.SaveInboundGroupSession(entry)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range processed {
+		if i < next {
+			delete(processed, i)
+		}
+	}
+	if len(processed) == 0 {
+		delete(t.processed, sessionID)
+	}
+	return true, nil
+}
+
+// Forget drops what is known about the processed messages of the session,
+// e.g. after the session was deleted.
+func (t *GroupSessionTrimmer) Forget(sessionID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.processed, sessionID)
+}
@@ -0,0 +1,66 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupSessionTrimmer(t *testing.T) {
+	Convey("A GroupSessionTrimmer", t, func() {
+		out, in := createOutAndInboundGroupSession()
+		store := NewMemoryStore()
+		store.SaveInboundGroupSession(&InboundGroupSessionEntry{Session: in})
+		trimmer := NewGroupSessionTrimmer(store)
+
+		messages := make([]string, 4)
+		for i := range messages {
+			messages[i], _ = out.Encrypt("message")
+		}
+
+		Convey("should trim once the first message was processed.", func() {
+			trimmed, err := trimmer.Processed(in.ID(), 0)
+			So(err, ShouldBeNil)
+			So(trimmed, ShouldBeTrue)
+
+			entry, _ := store.LoadInboundGroupSession(in.ID())
+			So(entry.Session.FirstKnownIndex(), ShouldEqual, 1)
+			_, _, err = entry.Session.Decrypt(messages[0])
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should wait for messages processed out of order.", func() {
+			trimmed, _ := trimmer.Processed(in.ID(), 1)
+			So(trimmed, ShouldBeFalse)
+			So(in.FirstKnownIndex(), ShouldEqual, 0)
+
+			trimmed, _ = trimmer.Processed(in.ID(), 0)
+			So(trimmed, ShouldBeTrue)
+			So(in.FirstKnownIndex(), ShouldEqual, 2)
+		})
+		Convey("should trim in steps.", func() {
+			trimmer.Step = 3
+			trimmer.Processed(in.ID(), 0)
+			trimmed, _ := trimmer.Processed(in.ID(), 1)
+			So(trimmed, ShouldBeFalse)
+
+			trimmed, _ = trimmer.Processed(in.ID(), 2)
+			So(trimmed, ShouldBeTrue)
+			So(in.FirstKnownIndex(), ShouldEqual, 3)
+
+			plaintext, _, err := in.Decrypt(messages[3])
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "message")
+		})
+		Convey("should ignore indices that are already forgotten.", func() {
+			trimmer.Processed(in.ID(), 0)
+			trimmed, err := trimmer.Processed(in.ID(), 0)
+			So(err, ShouldBeNil)
+			So(trimmed, ShouldBeFalse)
+		})
+		Convey("should ignore unknown sessions.", func() {
+			trimmed, err := trimmer.Processed("unknown", 0)
+			So(err, ShouldBeNil)
+			So(trimmed, ShouldBeFalse)
+		})
+	})
+}
@@ -234,3 +234,30 @@ func (s *InboundGroupSession) Export(messageIndex uint32) (string, error) {
 
 	return string(keyBytes[:result]), nil
 }
+
+// ForgetBefore discards the ratchet states before the given message index,
+// so messages before it can not be decrypted with this session anymore.
+// The session is replaced in place by one re-imported from an export at
+// the index. Like every imported session it is unverified afterwards.
+func (s *InboundGroupSession) ForgetBefore(messageIndex uint32) error {
+	first := s.FirstKnownIndex()
+	if messageIndex < first {
+		return errors.New("messages before the index are already forgotten")
+	}
+	if messageIndex == first {
+		return nil
+	}
+
+	exported, err := s.Export(messageIndex)
+	if err != nil {
+		return err
+	}
+	trimmed, err := ImportInboundGroupSession(exported)
+	if err != nil {
+		return err
+	}
+
+	s.Clear()
+	*s = *trimmed
+	return nil
+}
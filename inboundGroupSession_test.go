@@ -180,3 +180,36 @@ func TestInboundGroupSessionDecrypt(t *testing.T) {
 		})
 	})
 }
+
+func TestInboundGroupSessionForgetBefore(t *testing.T) {
+	Convey("Forgetting messages before an index", t, func() {
+		out, inSess := createOutAndInboundGroupSession()
+		first, _ := out.Encrypt("first")
+		second, _ := out.Encrypt("second")
+		id := inSess.ID()
+
+		So(inSess.ForgetBefore(1), ShouldBeNil)
+
+		Convey("should move the first known index.", func() {
+			So(inSess.FirstKnownIndex(), ShouldEqual, 1)
+			So(inSess.ID(), ShouldEqual, id)
+		})
+		Convey("should make earlier messages undecryptable.", func() {
+			_, _, err := inSess.Decrypt(first)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should keep later messages decryptable.", func() {
+			plaintext, index, err := inSess.Decrypt(second)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "second")
+			So(index, ShouldEqual, 1)
+		})
+		Convey("should not go back to an earlier index.", func() {
+			So(inSess.ForgetBefore(0), ShouldNotBeNil)
+		})
+		Convey("at the first known index should do nothing.", func() {
+			So(inSess.ForgetBefore(1), ShouldBeNil)
+			So(inSess.FirstKnownIndex(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,264 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// BackupAuthData is the auth_data of a key backup version.
+type BackupAuthData struct {
+	// PublicKey is the Curve25519 key the sessions are encrypted for.
+	PublicKey  string     `json:"public_key"`
+	Signatures Signatures `json:"signatures,omitempty"`
+}
+
+// NewBackupAuthData builds the auth_data for the backup key, signed by the
+// account.
+func NewBackupAuthData(account *Account, userID, deviceID, publicKey string) (*BackupAuthData, error) {
+	if publicKey == "" {
+		return nil, errors.New("publicKey must not be empty")
+	}
+
+	authData := &BackupAuthData{PublicKey: publicKey}
+
+	signed, err := SignJSON(account, userID, deviceID, authData)
+	if err != nil {
+		return nil, err
+	}
+	keyID := ED25519KeyID(deviceID)
+	authData.Signatures.set(userID, keyID, signatureOf(signed, userID, keyID))
+
+	return authData, nil
+}
+
+// ParseBackupAuthData parses the auth_data of a key backup version and
+// verifies that it was signed by the device.
+func ParseBackupAuthData(data []byte, device *DeviceKeys) (*BackupAuthData, error) {
+	if device == nil {
+		return nil, errors.New("device must not be nil")
+	}
+
+	authData := &BackupAuthData{}
+	err := json.Unmarshal(data, authData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.PublicKey == "" {
+		return nil, errors.New("auth data does not contain a public key")
+	}
+
+	err = VerifySignedJSON(data, device.UserID, ED25519KeyID(device.DeviceID), device.ED25519())
+	if err != nil {
+		return nil, err
+	}
+
+	return authData, nil
+}
+
+// KeyBackupData is the backup of a single inbound group session.
+type KeyBackupData struct {
+	FirstMessageIndex uint32 `json:"first_message_index"`
+	// ForwardedCount is the length of the forwarding chain of the session.
+	ForwardedCount int        `json:"forwarded_count"`
+	IsVerified     bool       `json:"is_verified"`
+	SessionData    *PkMessage `json:"session_data"`
+}
+
+// backupSessionData is the plaintext of the session_data of a backed up
+// session.
+type backupSessionData struct {
+	Algorithm         string            `json:"algorithm"`
+	ForwardingChain   []string          `json:"forwarding_curve25519_key_chain"`
+	SenderKey         string            `json:"sender_key"`
+	SenderClaimedKeys map[string]string `json:"sender_claimed_keys"`
+	SessionKey        string            `json:"session_key"`
+}
+
+// EncryptBackupSession encrypts the session for the backup with the given
+// public key. The session is exported from its first known index.
+func EncryptBackupSession(backupKey string, entry *InboundGroupSessionEntry) (*KeyBackupData, error) {
+	if entry == nil || entry.Session == nil {
+		return nil, errors.New("session must not be nil")
+	}
+
+	encryption, err := NewPkEncryption(backupKey)
+	if err != nil {
+		return nil, err
+	}
+	defer encryption.Clear()
+
+	firstIndex := entry.Session.FirstKnownIndex()
+	sessionKey, err := entry.Session.Export(firstIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := entry.ForwardingChain
+	if chain == nil {
+		chain = []string{}
+	}
+	plaintext, err := json.Marshal(&backupSessionData{
+		Algorithm:         AlgorithmMegolmV1,
+		ForwardingChain:   chain,
+		SenderKey:         entry.SenderKey,
+		SenderClaimedKeys: map[string]string{KeyAlgorithmED25519: entry.SigningKey},
+		SessionKey:        sessionKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := encryption.Encrypt(string(plaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyBackupData{
+		FirstMessageIndex: firstIndex,
+		ForwardedCount:    len(entry.ForwardingChain),
+		IsVerified:        entry.Session.IsVerified(),
+		SessionData:       message,
+	}, nil
+}
+
+// DecryptBackupSession decrypts a backed up session of the room with the
+// backup key. The session must have the given ID.
+func DecryptBackupSession(backupKey *PkDecryption, roomID, sessionID string, data *KeyBackupData) (*InboundGroupSessionEntry, error) {
+	if data == nil {
+		return nil, errors.New("data must not be nil")
+	}
+
+	plaintext, err := backupKey.Decrypt(data.SessionData)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &backupSessionData{}
+	err = json.Unmarshal([]byte(plaintext), session)
+	if err != nil {
+		return nil, err
+	}
+	if session.Algorithm != AlgorithmMegolmV1 {
+		return nil, fmt.Errorf("unexpected algorithm %q", session.Algorithm)
+	}
+
+	sess, err := ImportInboundGroupSession(session.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+	err = checkGroupSessionID(sess, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []string
+	if len(session.ForwardingChain) > 0 {
+		chain = session.ForwardingChain
+	}
+	return &InboundGroupSessionEntry{
+		Session:         sess,
+		RoomID:          roomID,
+		SenderKey:       session.SenderKey,
+		SigningKey:      session.SenderClaimedKeys[KeyAlgorithmED25519],
+		ForwardingChain: chain,
+	}, nil
+}
+
+// CreateBackup generates a new backup key and creates a backup version on
+// the server with auth_data signed by the account. The backup key must be
+// kept by the user to restore the backup.
+func CreateBackup(server BackupServer, account *Account, userID, deviceID string) (*PkDecryption, string, error) {
+	backupKey, err := NewPkDecryption()
+	if err != nil {
+		return nil, "", err
+	}
+
+	authData, err := NewBackupAuthData(account, userID, deviceID, backupKey.PublicKey())
+	if err != nil {
+		return nil, "", err
+	}
+	authDataJSON, err := json.Marshal(authData)
+	if err != nil {
+		return nil, "", err
+	}
+
+	version, err := server.CreateBackupVersion(AlgorithmMegolmBackupV1, authDataJSON)
+	if err != nil {
+		return nil, "", err
+	}
+	return backupKey, version, nil
+}
+
+// BackupSessions encrypts the sessions for the latest backup version on
+// the server and uploads them. device is the device that signed the
+// auth_data of the version; its signature is verified before anything is
+// uploaded.
+func BackupSessions(server BackupServer, device *DeviceKeys, entries []*InboundGroupSessionEntry) error {
+	version, authData, err := latestBackup(server, device)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		data, err := EncryptBackupSession(authData.PublicKey, entry)
+		if err != nil {
+			return err
+		}
+		err = server.PutBackupSession(version.Version, entry.RoomID, entry.Session.ID(), data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreBackup decrypts all sessions of the latest backup version on the
+// server with the backup key. device is the device that signed the
+// auth_data of the version; the version must be signed by it and be meant
+// for the backup key.
+func RestoreBackup(server BackupServer, device *DeviceKeys, backupKey *PkDecryption) ([]*InboundGroupSessionEntry, error) {
+	version, authData, err := latestBackup(server, device)
+	if err != nil {
+		return nil, err
+	}
+	if authData.PublicKey != backupKey.PublicKey() {
+		return nil, errors.New("the backup is not meant for the backup key")
+	}
+
+	rooms, err := server.BackupSessions(version.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*InboundGroupSessionEntry
+	for roomID, sessions := range rooms {
+		for sessionID, data := range sessions {
+			entry, err := DecryptBackupSession(backupKey, roomID, sessionID, data)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func latestBackup(server BackupServer, device *DeviceKeys) (*BackupVersion, *BackupAuthData, error) {
+	version, err := server.LatestBackupVersion()
+	if err != nil {
+		return nil, nil, err
+	}
+	if version == nil {
+		return nil, nil, errors.New("there is no backup")
+	}
+	if version.Algorithm != AlgorithmMegolmBackupV1 {
+		return nil, nil, fmt.Errorf("unexpected backup algorithm %q", version.Algorithm)
+	}
+
+	authData, err := ParseBackupAuthData(version.AuthData, device)
+	if err != nil {
+		return nil, nil, err
+	}
+	return version, authData, nil
+}
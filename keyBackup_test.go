@@ -0,0 +1,125 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackupAuthData(t *testing.T) {
+	Convey("Backup auth data", t, func() {
+		acc, _ := NewAccount()
+		device, _ := NewDeviceKeys(acc, "@user:example.org", "DEVICE")
+
+		authData, err := NewBackupAuthData(acc, "@user:example.org", "DEVICE", "public key")
+		So(err, ShouldBeNil)
+		data, _ := json.Marshal(authData)
+
+		Convey("should be verified with the signing device.", func() {
+			parsed, err := ParseBackupAuthData(data, device)
+			So(err, ShouldBeNil)
+			So(parsed.PublicKey, ShouldEqual, "public key")
+		})
+		Convey("should not be verified with another device.", func() {
+			other, _ := NewAccount()
+			otherDevice, _ := NewDeviceKeys(other, "@user:example.org", "DEVICE")
+			_, err := ParseBackupAuthData(data, otherDevice)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not be verified if the key was replaced.", func() {
+			authData.PublicKey = "other key"
+			tampered, _ := json.Marshal(authData)
+			_, err := ParseBackupAuthData(tampered, device)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBackupSession(t *testing.T) {
+	Convey("A backed up session", t, func() {
+		backupKey, _ := NewPkDecryption()
+		out, in := createOutAndInboundGroupSession()
+		entry := &InboundGroupSessionEntry{
+			Session:         in,
+			RoomID:          "!room:example.org",
+			SenderKey:       "sender",
+			SigningKey:      "signing",
+			ForwardingChain: []string{"forwarder"},
+		}
+
+		data, err := EncryptBackupSession(backupKey.PublicKey(), entry)
+		So(err, ShouldBeNil)
+
+		Convey("should describe the session.", func() {
+			So(data.FirstMessageIndex, ShouldEqual, 0)
+			So(data.ForwardedCount, ShouldEqual, 1)
+			So(data.IsVerified, ShouldBeTrue)
+		})
+		Convey("should be decrypted with the backup key.", func() {
+			restored, err := DecryptBackupSession(backupKey, "!room:example.org", in.ID(), data)
+			So(err, ShouldBeNil)
+			So(restored.RoomID, ShouldEqual, "!room:example.org")
+			So(restored.SenderKey, ShouldEqual, "sender")
+			So(restored.SigningKey, ShouldEqual, "signing")
+			So(restored.ForwardingChain, ShouldResemble, []string{"forwarder"})
+
+			message, _ := out.Encrypt("hello")
+			plaintext, _, err := restored.Session.Decrypt(message)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "hello")
+		})
+		Convey("should not be decrypted with another key.", func() {
+			other, _ := NewPkDecryption()
+			_, err := DecryptBackupSession(other, "!room:example.org", in.ID(), data)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not be restored under another session ID.", func() {
+			_, err := DecryptBackupSession(backupKey, "!room:example.org", "other", data)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestKeyBackupRoundTrip(t *testing.T) {
+	Convey("A key backup", t, func() {
+		acc, _ := NewAccount()
+		device, _ := NewDeviceKeys(acc, "@user:example.org", "DEVICE")
+		server := NewMemoryBackupServer()
+
+		backupKey, _, err := CreateBackup(server, acc, "@user:example.org", "DEVICE")
+		So(err, ShouldBeNil)
+
+		_, in := createOutAndInboundGroupSession()
+		entry := &InboundGroupSessionEntry{Session: in, RoomID: "!room:example.org", SenderKey: "sender"}
+		So(BackupSessions(server, device, []*InboundGroupSessionEntry{entry}), ShouldBeNil)
+
+		Convey("should be restored with the backup key.", func() {
+			restoredKey, _ := NewPkDecryptionFromPrivateKey(backupKey.PrivateKey())
+			entries, err := RestoreBackup(server, device, restoredKey)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].Session.ID(), ShouldEqual, in.ID())
+			So(entries[0].RoomID, ShouldEqual, "!room:example.org")
+		})
+		Convey("should not be restored with another key.", func() {
+			other, _ := NewPkDecryption()
+			_, err := RestoreBackup(server, device, other)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not be trusted if signed by another device.", func() {
+			other, _ := NewAccount()
+			otherDevice, _ := NewDeviceKeys(other, "@user:example.org", "DEVICE")
+			_, err := RestoreBackup(server, otherDevice, backupKey)
+			So(err, ShouldNotBeNil)
+			So(BackupSessions(server, otherDevice, []*InboundGroupSessionEntry{entry}), ShouldNotBeNil)
+		})
+	})
+	Convey("Restoring without a backup should not work.", t, func() {
+		acc, _ := NewAccount()
+		device, _ := NewDeviceKeys(acc, "@user:example.org", "DEVICE")
+		backupKey, _ := NewPkDecryption()
+		_, err := RestoreBackup(NewMemoryBackupServer(), device, backupKey)
+		So(err, ShouldNotBeNil)
+	})
+}
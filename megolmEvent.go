@@ -0,0 +1,157 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownGroupSession is returned if an event was encrypted with an
+// inbound group session that is not known.
+var ErrUnknownGroupSession = errors.New("unknown group session")
+
+// MegolmEventContent is the content of an m.room.encrypted event that was
+// encrypted with Megolm.
+type MegolmEventContent struct {
+	Algorithm string `json:"algorithm"`
+	// SenderKey is the Curve25519 identity key of the sending device.
+	SenderKey string `json:"sender_key"`
+	// DeviceID is the ID of the sending device.
+	DeviceID   string `json:"device_id"`
+	SessionID  string `json:"session_id"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// MegolmPayload is the plaintext of a Megolm encrypted event.
+type MegolmPayload struct {
+	Type    string          `json:"type"`
+	Content json.RawMessage `json:"content"`
+	RoomID  string          `json:"room_id"`
+}
+
+// MegolmDecryptionResult is a decrypted Megolm event.
+type MegolmDecryptionResult struct {
+	MegolmPayload
+	// SenderKey is the Curve25519 identity key of the device that created
+	// the session.
+	SenderKey string
+	SessionID string
+	// MessageIndex is the index of the message within the session.
+	MessageIndex uint32
+	// Verified is the IsVerified state of the session after decrypting.
+	Verified bool
+	// Forwarded is set if the session was forwarded by another device
+	// than the one that created it.
+	Forwarded bool
+	// SigningKey is the ed25519 key the device that created the session
+	// claims to own.
+	SigningKey string
+}
+
+// EncryptMegolmEvent encrypts an event for the room with the outbound group
+// session. deviceID is the ID of the device of the account.
+func EncryptMegolmEvent(account *Account, deviceID string, sess *OutboundGroupSession, roomID, eventType string, content interface{}) (*MegolmEventContent, error) {
+	if deviceID == "" || roomID == "" || eventType == "" {
+		return nil, errors.New("deviceID, roomID and eventType must not be empty")
+	}
+
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(&MegolmPayload{
+		Type:    eventType,
+		Content: contentJSON,
+		RoomID:  roomID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := sess.Encrypt(string(plaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	return &MegolmEventContent{
+		Algorithm:  AlgorithmMegolmV1,
+		SenderKey:  account.IdentityKeys().Curve25519,
+		DeviceID:   deviceID,
+		SessionID:  sess.ID(),
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// DecryptMegolmEvent decrypts an event that arrived in the given room.
+//
+// The event is rejected if it was not encrypted with the session of the
+// entry, if the entry does not name the sender of the session or names
+// another sender, if the entry is known to belong to another room, or if
+// the room ID in the plaintext is not the room the event arrived in.
+func DecryptMegolmEvent(entry *InboundGroupSessionEntry, roomID string, content *MegolmEventContent) (*MegolmDecryptionResult, error) {
+	if entry == nil || entry.Session == nil {
+		return nil, errors.New("session must not be nil")
+	}
+	if content == nil {
+		return nil, errors.New("content must not be nil")
+	}
+	if content.Algorithm != AlgorithmMegolmV1 {
+		return nil, fmt.Errorf("unexpected algorithm %q", content.Algorithm)
+	}
+	if content.SessionID != entry.Session.ID() {
+		return nil, errors.New("event was encrypted with another session")
+	}
+	if entry.SenderKey == "" {
+		return nil, errors.New("sender of the session is unknown")
+	}
+	if entry.SenderKey != content.SenderKey {
+		return nil, errors.New("session belongs to another sender")
+	}
+	if entry.RoomID != "" && entry.RoomID != roomID {
+		return nil, errors.New("session belongs to another room")
+	}
+
+	plaintext, index, err := entry.Session.Decrypt(content.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MegolmDecryptionResult{
+		SenderKey:    content.SenderKey,
+		SessionID:    content.SessionID,
+		MessageIndex: index,
+		Verified:     entry.Session.IsVerified(),
+		Forwarded:    entry.Forwarded(),
+		SigningKey:   entry.SigningKey,
+	}
+	err = json.Unmarshal([]byte(plaintext), &result.MegolmPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.RoomID != roomID {
+		return nil, fmt.Errorf("event was sent to room %q, not %q", result.RoomID, roomID)
+	}
+
+	return result, nil
+}
+
+// DecryptMegolmEventFrom decrypts an event that arrived in the given room
+// with the session from the store. Returns ErrUnknownGroupSession if the
+// store does not have the session.
+func DecryptMegolmEventFrom(store InboundGroupSessionStore, roomID string, content *MegolmEventContent) (*MegolmDecryptionResult, error) {
+	if content == nil {
+		return nil, errors.New("content must not be nil")
+	}
+
+	entry, err := store.LoadInboundGroupSession(content.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, ErrUnknownGroupSession
+	}
+
+	return DecryptMegolmEvent(entry, roomID, content)
+}
@@ -0,0 +1,81 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMegolmEvent(t *testing.T) {
+	const room = "!room:example.org"
+
+	Convey("A Megolm encrypted event", t, func() {
+		acc, _ := NewAccount()
+		out, in := createOutAndInboundGroupSession()
+		entry := &InboundGroupSessionEntry{
+			Session:   in,
+			RoomID:    room,
+			SenderKey: acc.IdentityKeys().Curve25519,
+		}
+
+		content, err := EncryptMegolmEvent(acc, "DEVICE", out, room, "m.room.message", map[string]string{"body": "hi"})
+		So(err, ShouldBeNil)
+
+		Convey("should have the expected envelope.", func() {
+			So(content.Algorithm, ShouldEqual, AlgorithmMegolmV1)
+			So(content.SenderKey, ShouldEqual, acc.IdentityKeys().Curve25519)
+			So(content.DeviceID, ShouldEqual, "DEVICE")
+			So(content.SessionID, ShouldEqual, out.ID())
+		})
+		Convey("should be decrypted in the same room.", func() {
+			result, err := DecryptMegolmEvent(entry, room, content)
+			So(err, ShouldBeNil)
+			So(result.Type, ShouldEqual, "m.room.message")
+			So(string(result.Content), ShouldEqual, `{"body":"hi"}`)
+			So(result.RoomID, ShouldEqual, room)
+			So(result.MessageIndex, ShouldEqual, 0)
+			So(result.Verified, ShouldBeTrue)
+		})
+		Convey("should report the message index.", func() {
+			second, _ := EncryptMegolmEvent(acc, "DEVICE", out, room, "m.room.message", map[string]string{"body": "again"})
+			result, err := DecryptMegolmEvent(entry, room, second)
+			So(err, ShouldBeNil)
+			So(result.MessageIndex, ShouldEqual, 1)
+		})
+		Convey("should be rejected in another room.", func() {
+			entry.RoomID = ""
+			_, err := DecryptMegolmEvent(entry, "!other:example.org", content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected with a session of another room.", func() {
+			_, err := DecryptMegolmEvent(entry, "!other:example.org", content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected with a session of another sender.", func() {
+			entry.SenderKey = "other"
+			_, err := DecryptMegolmEvent(entry, room, content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected with a session of an unknown sender.", func() {
+			entry.SenderKey = ""
+			_, err := DecryptMegolmEvent(entry, room, content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected with another session.", func() {
+			_, other := createOutAndInboundGroupSession()
+			_, err := DecryptMegolmEvent(&InboundGroupSessionEntry{Session: other}, room, content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be found in a store.", func() {
+			store := NewMemoryStore()
+			store.SaveInboundGroupSession(entry)
+			result, err := DecryptMegolmEventFrom(store, room, content)
+			So(err, ShouldBeNil)
+			So(result.SessionID, ShouldEqual, in.ID())
+		})
+		Convey("should not be found in an empty store.", func() {
+			_, err := DecryptMegolmEventFrom(NewMemoryStore(), room, content)
+			So(err, ShouldEqual, ErrUnknownGroupSession)
+		})
+	})
+}
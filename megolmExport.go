@@ -0,0 +1,251 @@
+package golm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultExportRounds is the default number of PBKDF2 rounds of a session
+// export.
+const DefaultExportRounds = 500000
+
+// MaxExportRounds is the highest number of PBKDF2 rounds of a session
+// export. Imports claiming more rounds are rejected, so a crafted file can
+// not keep the importer busy.
+const MaxExportRounds = 10 * DefaultExportRounds
+
+const (
+	megolmExportHeader  = "-----BEGIN MEGOLM SESSION DATA-----"
+	megolmExportFooter  = "-----END MEGOLM SESSION DATA-----"
+	megolmExportVersion = 1
+	megolmExportSalt    = 16
+	megolmExportLine    = 96
+)
+
+// ErrExportCorrupted is returned if a session export is malformed or was
+// encrypted with another passphrase.
+var ErrExportCorrupted = errors.New("session export is corrupted or the passphrase is wrong")
+
+// exportedSession is a session in the plaintext of a session export.
+type exportedSession struct {
+	Algorithm         string            `json:"algorithm"`
+	ForwardingChain   []string          `json:"forwarding_curve25519_key_chain"`
+	RoomID            string            `json:"room_id"`
+	SenderKey         string            `json:"sender_key"`
+	SenderClaimedKeys map[string]string `json:"sender_claimed_keys"`
+	SessionID         string            `json:"session_id"`
+	SessionKey        string            `json:"session_key"`
+}
+
+// ExportSessions writes the sessions into the "MEGOLM SESSION DATA" format
+// understood by other Matrix clients, encrypted with the passphrase. Each
+// session is exported from its first known index.
+//
+// The payload is a version byte, a 16 byte salt, a 16 byte IV, the PBKDF2
+// rounds as big endian uint32, the AES-256-CTR encrypted JSON list of
+// sessions and an HMAC-SHA256 over everything before it. The keys are
+// derived with PBKDF2-HMAC-SHA512 like those of a vault.
+func ExportSessions(sessions []*InboundGroupSessionEntry, passphrase string, rounds int) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	if rounds <= 0 {
+		return nil, errors.New("rounds must be positive")
+	}
+	if rounds > MaxExportRounds {
+		return nil, fmt.Errorf("rounds must be at most %d", MaxExportRounds)
+	}
+
+	exported := make([]*exportedSession, 0, len(sessions))
+	for _, entry := range sessions {
+		if entry == nil || entry.Session == nil {
+			return nil, errors.New("session must not be nil")
+		}
+
+		key, err := entry.Session.Export(entry.Session.FirstKnownIndex())
+		if err != nil {
+			return nil, err
+		}
+
+		chain := entry.ForwardingChain
+		if chain == nil {
+			chain = []string{}
+		}
+		exported = append(exported, &exportedSession{
+			Algorithm:         AlgorithmMegolmV1,
+			ForwardingChain:   chain,
+			RoomID:            entry.RoomID,
+			SenderKey:         entry.SenderKey,
+			SenderClaimedKeys: map[string]string{KeyAlgorithmED25519: entry.SigningKey},
+			SessionID:         entry.Session.ID(),
+			SessionKey:        key,
+		})
+	}
+
+	plaintext, err := json.Marshal(exported)
+	if err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, megolmExportSalt+aes.BlockSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	salt := random[:megolmExportSalt]
+	iv := random[megolmExportSalt:]
+	// Some implementations use a 64 bit counter; clearing its top bit
+	// keeps them from overflowing.
+	iv[8] &= 0x7F
+
+	payload, err := encryptMegolmExport(plaintext, passphrase, salt, iv, uint32(rounds))
+	if err != nil {
+		return nil, err
+	}
+	return armorMegolmExport(payload), nil
+}
+
+// ImportSessions reads sessions from the "MEGOLM SESSION DATA" format,
+// decrypting it with the passphrase. Sessions of other algorithms are
+// skipped. The returned sessions are unverified, like every imported
+// session; they can be merged into a store with MergeInboundGroupSession.
+func ImportSessions(data []byte, passphrase string) ([]*InboundGroupSessionEntry, error) {
+	payload, err := dearmorMegolmExport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decryptMegolmExport(payload, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var exported []*exportedSession
+	err = json.Unmarshal(plaintext, &exported)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*InboundGroupSessionEntry, 0, len(exported))
+	for _, session := range exported {
+		if session.Algorithm != AlgorithmMegolmV1 {
+			continue
+		}
+
+		sess, err := ImportInboundGroupSession(session.SessionKey)
+		if err != nil {
+			return nil, err
+		}
+		err = checkGroupSessionID(sess, session.SessionID)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &InboundGroupSessionEntry{
+			Session:         sess,
+			RoomID:          session.RoomID,
+			SenderKey:       session.SenderKey,
+			SigningKey:      session.SenderClaimedKeys[KeyAlgorithmED25519],
+			ForwardingChain: session.ForwardingChain,
+		})
+	}
+	return entries, nil
+}
+
+func encryptMegolmExport(plaintext []byte, passphrase string, salt, iv []byte, rounds uint32) ([]byte, error) {
+	aesKey, macKey := vaultKeys(passphrase, salt, rounds)
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &bytes.Buffer{}
+	payload.WriteByte(megolmExportVersion)
+	payload.Write(salt)
+	payload.Write(iv)
+	binary.Write(payload, binary.BigEndian, rounds)
+
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+	payload.Write(ciphertext)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(payload.Bytes())
+	payload.Write(mac.Sum(nil))
+
+	return payload.Bytes(), nil
+}
+
+func decryptMegolmExport(payload []byte, passphrase string) ([]byte, error) {
+	const headerSize = 1 + megolmExportSalt + aes.BlockSize + 4
+	if len(payload) < headerSize+sha256.Size {
+		return nil, ErrExportCorrupted
+	}
+	if payload[0] != megolmExportVersion {
+		return nil, fmt.Errorf("unsupported session export version %d", payload[0])
+	}
+
+	salt := payload[1 : 1+megolmExportSalt]
+	iv := payload[1+megolmExportSalt : 1+megolmExportSalt+aes.BlockSize]
+	rounds := binary.BigEndian.Uint32(payload[headerSize-4 : headerSize])
+	if rounds == 0 || rounds > MaxExportRounds {
+		return nil, ErrExportCorrupted
+	}
+	ciphertext := payload[headerSize : len(payload)-sha256.Size]
+
+	aesKey, macKey := vaultKeys(passphrase, salt, rounds)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(payload[:len(payload)-sha256.Size])
+	if !hmac.Equal(mac.Sum(nil), payload[len(payload)-sha256.Size:]) {
+		return nil, ErrExportCorrupted
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+
+	return plaintext, nil
+}
+
+func armorMegolmExport(payload []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	armored := &bytes.Buffer{}
+	armored.WriteString(megolmExportHeader + "\n")
+	for len(encoded) > megolmExportLine {
+		armored.WriteString(encoded[:megolmExportLine] + "\n")
+		encoded = encoded[megolmExportLine:]
+	}
+	armored.WriteString(encoded + "\n")
+	armored.WriteString(megolmExportFooter + "\n")
+
+	return armored.Bytes()
+}
+
+func dearmorMegolmExport(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, megolmExportHeader) || !strings.HasSuffix(text, megolmExportFooter) {
+		return nil, errors.New("data is not a megolm session export")
+	}
+	text = text[len(megolmExportHeader) : len(text)-len(megolmExportFooter)]
+	text = strings.Join(strings.Fields(text), "")
+
+	payload, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, ErrExportCorrupted
+	}
+	return payload, nil
+}
@@ -0,0 +1,135 @@
+package golm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// From the key export tests of matrix-react-sdk.
+const megolmExportVector = "AXNhbHRzYWx0c2FsdHNhbHSIiIiIiIiIiIiIiIiIiIiIAAAACmIRUW2OjZ3L2l6j9h0lHlV3M2dxcissyYBxjsfsAndErh065A8="
+
+// Encrypts `[{"algorithm":"m.other.v1","session_id":"x"}]` with the
+// passphrase "passphrase", salt 0x00..0x0F, IV 0x10..0x1F and 1000 rounds.
+const megolmExportOtherAlgorithmVector = "-----BEGIN MEGOLM SESSION DATA-----\n" +
+	"AQABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fAAAD6El4nqzfK5KRMTa0ZbaxXPjqp4oNUTmyNHeQfNtnjvM/pGRz\n" +
+	"j1tIJmzFgyzURd9+54Rncu1enpvNk0CNzkL7Lmmc+zFpAeRE4RVKgisb\n" +
+	"-----END MEGOLM SESSION DATA-----\n"
+
+func TestMegolmExportVectors(t *testing.T) {
+	payload, _ := base64.StdEncoding.DecodeString(megolmExportVector)
+
+	Convey("The test vector should be decrypted.", t, func() {
+		plaintext, err := decryptMegolmExport(payload, "password")
+		So(err, ShouldBeNil)
+		So(string(plaintext), ShouldEqual, "plain")
+	})
+	Convey("The test vector should be reproduced.", t, func() {
+		encrypted, err := encryptMegolmExport([]byte("plain"), "password", []byte("saltsaltsaltsalt"), bytes.Repeat([]byte{0x88}, 16), 10)
+		So(err, ShouldBeNil)
+		So(encrypted, ShouldResemble, payload)
+	})
+	Convey("The test vector should not be decrypted with another passphrase.", t, func() {
+		_, err := decryptMegolmExport(payload, "wrong")
+		So(err, ShouldEqual, ErrExportCorrupted)
+	})
+	Convey("A tampered test vector should not be decrypted.", t, func() {
+		tampered := append([]byte{}, payload...)
+		tampered[len(tampered)-40] ^= 1
+		_, err := decryptMegolmExport(tampered, "password")
+		So(err, ShouldEqual, ErrExportCorrupted)
+	})
+	Convey("A payload with too many rounds should not be decrypted.", t, func() {
+		tampered := append([]byte{}, payload...)
+		binary.BigEndian.PutUint32(tampered[1+megolmExportSalt+aes.BlockSize:], MaxExportRounds+1)
+		_, err := decryptMegolmExport(tampered, "password")
+		So(err, ShouldEqual, ErrExportCorrupted)
+	})
+	Convey("A truncated payload should not be decrypted.", t, func() {
+		_, err := decryptMegolmExport(payload[:20], "password")
+		So(err, ShouldEqual, ErrExportCorrupted)
+	})
+	Convey("Sessions of other algorithms should be skipped.", t, func() {
+		entries, err := ImportSessions([]byte(megolmExportOtherAlgorithmVector), "passphrase")
+		So(err, ShouldBeNil)
+		So(entries, ShouldBeEmpty)
+	})
+}
+
+func TestMegolmExportArmor(t *testing.T) {
+	Convey("Armored data should be split into lines.", t, func() {
+		payload := bytes.Repeat([]byte{1}, 200)
+		armored := string(armorMegolmExport(payload))
+		lines := strings.Split(strings.TrimSpace(armored), "\n")
+
+		So(lines[0], ShouldEqual, "-----BEGIN MEGOLM SESSION DATA-----")
+		So(lines[len(lines)-1], ShouldEqual, "-----END MEGOLM SESSION DATA-----")
+		So(lines[1], ShouldHaveLength, 96)
+
+		dearmored, err := dearmorMegolmExport([]byte(armored))
+		So(err, ShouldBeNil)
+		So(dearmored, ShouldResemble, payload)
+	})
+	Convey("Data without the header should not be dearmored.", t, func() {
+		_, err := dearmorMegolmExport([]byte(megolmExportVector))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestExportSessions(t *testing.T) {
+	const room = "!room:example.org"
+
+	Convey("Exported sessions", t, func() {
+		out, in := createOutAndInboundGroupSession()
+		out.Encrypt("first")
+		second, _ := out.Encrypt("second")
+
+		entry := &InboundGroupSessionEntry{
+			Session:         in,
+			RoomID:          room,
+			SenderKey:       "sender",
+			SigningKey:      "signing",
+			ForwardingChain: []string{"forwarder"},
+		}
+		data, err := ExportSessions([]*InboundGroupSessionEntry{entry}, "passphrase", 1000)
+		So(err, ShouldBeNil)
+
+		Convey("should be armored.", func() {
+			So(string(data), ShouldStartWith, "-----BEGIN MEGOLM SESSION DATA-----\n")
+		})
+		Convey("should be imported again.", func() {
+			entries, err := ImportSessions(data, "passphrase")
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+
+			imported := entries[0]
+			So(imported.Session.ID(), ShouldEqual, in.ID())
+			So(imported.Session.FirstKnownIndex(), ShouldEqual, 0)
+			So(imported.RoomID, ShouldEqual, room)
+			So(imported.SenderKey, ShouldEqual, "sender")
+			So(imported.SigningKey, ShouldEqual, "signing")
+			So(imported.ForwardingChain, ShouldResemble, []string{"forwarder"})
+
+			plaintext, _, err := imported.Session.Decrypt(second)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "second")
+		})
+		Convey("should not be imported with another passphrase.", func() {
+			_, err := ImportSessions(data, "wrong")
+			So(err, ShouldEqual, ErrExportCorrupted)
+		})
+	})
+	Convey("Exporting without a passphrase should not work.", t, func() {
+		_, err := ExportSessions(nil, "", 1000)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Exporting with too many rounds should not work.", t, func() {
+		_, err := ExportSessions(nil, "passphrase", MaxExportRounds+1)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,82 @@
+package golm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MegolmReplayError is returned if a message index of a session was already
+// decrypted from another event.
+type MegolmReplayError struct {
+	SessionID    string
+	MessageIndex uint32
+	// EventID is the ID of the event the index reappeared in.
+	EventID string
+	// First is the event the index was first seen in.
+	First MegolmIndexRecord
+}
+
+func (e *MegolmReplayError) Error() string {
+	return fmt.Sprintf("message index %d of session %s was already used by event %s", e.MessageIndex, e.SessionID, e.First.EventID)
+}
+
+// MegolmReplayGuard detects Megolm messages that are replayed as new
+// events. It records the event each message index of a session was first
+// decrypted from. It is safe for concurrent use.
+type MegolmReplayGuard struct {
+	mutex sync.Mutex
+	store MegolmIndexStore
+}
+
+// NewMegolmReplayGuard creates a guard recording into the store. If store
+// is nil the records are kept in memory.
+func NewMegolmReplayGuard(store MegolmIndexStore) *MegolmReplayGuard {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &MegolmReplayGuard{store: store}
+}
+
+// Check records that the message index of the session was decrypted from
+// the event with the given ID and origin_server_ts. Decrypting the same
+// event again is fine; if the index was already seen in an event with
+// another ID or timestamp a *MegolmReplayError is returned.
+func (g *MegolmReplayGuard) Check(sessionID string, index uint32, eventID string, timestamp int64) error {
+	if sessionID == "" || eventID == "" {
+		return errors.New("sessionID and eventID must not be empty")
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	record, err := g.store.LoadMegolmIndex(sessionID, index)
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		if record.EventID == eventID && record.Timestamp == timestamp {
+			return nil
+		}
+		return &MegolmReplayError{
+			SessionID:    sessionID,
+			MessageIndex: index,
+			EventID:      eventID,
+			First:        *record,
+		}
+	}
+
+	return g.store.SaveMegolmIndex(sessionID, index, MegolmIndexRecord{
+		EventID:   eventID,
+		Timestamp: timestamp,
+	})
+}
+
+// CheckResult checks the decrypted event with the given ID and
+// origin_server_ts. See Check.
+func (g *MegolmReplayGuard) CheckResult(result *MegolmDecryptionResult, eventID string, timestamp int64) error {
+	if result == nil {
+		return errors.New("result must not be nil")
+	}
+	return g.Check(result.SessionID, result.MessageIndex, eventID, timestamp)
+}
@@ -0,0 +1,63 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMegolmReplayGuard(t *testing.T) {
+	Convey("A MegolmReplayGuard", t, func() {
+		guard := NewMegolmReplayGuard(nil)
+		So(guard.Check("session", 0, "$first", 1000), ShouldBeNil)
+
+		Convey("should accept the same event again.", func() {
+			So(guard.Check("session", 0, "$first", 1000), ShouldBeNil)
+		})
+		Convey("should accept the next index.", func() {
+			So(guard.Check("session", 1, "$second", 2000), ShouldBeNil)
+		})
+		Convey("should accept the same index of another session.", func() {
+			So(guard.Check("other", 0, "$other", 1000), ShouldBeNil)
+		})
+		Convey("should reject the index in another event.", func() {
+			err := guard.Check("session", 0, "$replayed", 3000)
+			So(err, ShouldHaveSameTypeAs, &MegolmReplayError{})
+
+			replay := err.(*MegolmReplayError)
+			So(replay.SessionID, ShouldEqual, "session")
+			So(replay.MessageIndex, ShouldEqual, 0)
+			So(replay.EventID, ShouldEqual, "$replayed")
+			So(replay.First, ShouldResemble, MegolmIndexRecord{EventID: "$first", Timestamp: 1000})
+		})
+		Convey("should reject the index with another timestamp.", func() {
+			So(guard.Check("session", 0, "$first", 1001), ShouldNotBeNil)
+		})
+		Convey("should not accept an empty event ID.", func() {
+			So(guard.Check("session", 1, "", 1000), ShouldNotBeNil)
+		})
+	})
+	Convey("A MegolmReplayGuard should record into the store.", t, func() {
+		store := NewMemoryStore()
+		So(NewMegolmReplayGuard(store).Check("session", 5, "$event", 1000), ShouldBeNil)
+
+		So(NewMegolmReplayGuard(store).Check("session", 5, "$replayed", 1000), ShouldNotBeNil)
+	})
+	Convey("A replayed Megolm event should be detected.", t, func() {
+		const room = "!room:example.org"
+		acc, _ := NewAccount()
+		out, in := createOutAndInboundGroupSession()
+		entry := &InboundGroupSessionEntry{Session: in, RoomID: room, SenderKey: acc.IdentityKeys().Curve25519}
+		guard := NewMegolmReplayGuard(nil)
+
+		content, _ := EncryptMegolmEvent(acc, "DEVICE", out, room, "m.room.message", map[string]string{"body": "hi"})
+
+		result, err := DecryptMegolmEvent(entry, room, content)
+		So(err, ShouldBeNil)
+		So(guard.CheckResult(result, "$original", 1000), ShouldBeNil)
+
+		result, err = DecryptMegolmEvent(entry, room, content)
+		So(err, ShouldBeNil)
+		So(guard.CheckResult(result, "$replayed", 2000), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,252 @@
+package golm
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store keeping everything in memory. It is safe for
+// concurrent use.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	account  *Account
+	sessions map[string][]*Session
+	inbound  map[string]*InboundGroupSessionEntry
+	outbound map[string]*OutboundGroupSessionEntry
+	indices  map[megolmIndexKey]MegolmIndexRecord
+}
+
+type megolmIndexKey struct {
+	sessionID string
+	index     uint32
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string][]*Session),
+		inbound:  make(map[string]*InboundGroupSessionEntry),
+		outbound: make(map[string]*OutboundGroupSessionEntry),
+		indices:  make(map[megolmIndexKey]MegolmIndexRecord),
+	}
+}
+
+// LoadAccount returns the stored account or nil if no account
+// was stored yet.
+func (s *MemoryStore) LoadAccount() (*Account, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.account, nil
+}
+
+// SaveAccount stores the account, replacing any previously stored account.
+func (s *MemoryStore) SaveAccount(account *Account) error {
+	if account == nil {
+		return errors.New("account must not be nil")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.account = account
+	return nil
+}
+
+// SessionPeers returns the identity keys of all peers that sessions
+// are stored for.
+func (s *MemoryStore) SessionPeers() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	peers := make([]string, 0, len(s.sessions))
+	for key := range s.sessions {
+		peers = append(peers, key)
+	}
+	sort.Strings(peers)
+
+	return peers, nil
+}
+
+// LoadSessions returns the sessions shared with the given peer. The
+// most recently saved session comes first.
+func (s *MemoryStore) LoadSessions(theirIdentityKey string) ([]*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sessions := make([]*Session, len(s.sessions[theirIdentityKey]))
+	copy(sessions, s.sessions[theirIdentityKey])
+
+	return sessions, nil
+}
+
+// SaveSession stores the session, replacing a stored session with the
+// same ID.
+func (s *MemoryStore) SaveSession(theirIdentityKey string, sess *Session) error {
+	if theirIdentityKey == "" {
+		return errors.New("theirIdentityKey must not be empty")
+	}
+	if sess == nil {
+		return errors.New("session must not be nil")
+	}
+
+	id := sess.ID()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sessions := []*Session{sess}
+	for _, stored := range s.sessions[theirIdentityKey] {
+		if stored.ID() != id {
+			sessions = append(sessions, stored)
+		}
+	}
+	s.sessions[theirIdentityKey] = sessions
+
+	return nil
+}
+
+// InboundGroupSessionIDs returns the IDs of all stored sessions.
+func (s *MemoryStore) InboundGroupSessionIDs() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]string, 0, len(s.inbound))
+	for id := range s.inbound {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// LoadInboundGroupSession returns the session with the given ID or nil
+// if there is no such session.
+func (s *MemoryStore) LoadInboundGroupSession(sessionID string) (*InboundGroupSessionEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.inbound[sessionID]
+	if !ok {
+		return nil, nil
+	}
+	return copyInboundGroupSessionEntry(entry), nil
+}
+
+// SaveInboundGroupSession stores the session, replacing a stored session
+// with the same ID.
+func (s *MemoryStore) SaveInboundGroupSession(entry *InboundGroupSessionEntry) error {
+	if entry == nil || entry.Session == nil {
+		return errors.New("session must not be nil")
+	}
+
+	copied := copyInboundGroupSessionEntry(entry)
+	id := entry.Session.ID()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.inbound[id] = copied
+	return nil
+}
+
+func copyInboundGroupSessionEntry(entry *InboundGroupSessionEntry) *InboundGroupSessionEntry {
+	copied := *entry
+	copied.ForwardingChain = append([]string(nil), entry.ForwardingChain...)
+	return &copied
+}
+
+// OutboundGroupSessionRooms returns the IDs of all rooms a session is
+// stored for.
+func (s *MemoryStore) OutboundGroupSessionRooms() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rooms := make([]string, 0, len(s.outbound))
+	for roomID := range s.outbound {
+		rooms = append(rooms, roomID)
+	}
+	sort.Strings(rooms)
+
+	return rooms, nil
+}
+
+// LoadOutboundGroupSession returns the session of the given room or nil
+// if there is no such session.
+func (s *MemoryStore) LoadOutboundGroupSession(roomID string) (*OutboundGroupSessionEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.outbound[roomID]
+	if !ok {
+		return nil, nil
+	}
+	return copyOutboundGroupSessionEntry(entry), nil
+}
+
+// SaveOutboundGroupSession stores the session, replacing the stored
+// session of the same room.
+func (s *MemoryStore) SaveOutboundGroupSession(entry *OutboundGroupSessionEntry) error {
+	if entry == nil || entry.Session == nil {
+		return errors.New("session must not be nil")
+	}
+	if entry.RoomID == "" {
+		return errors.New("room ID must not be empty")
+	}
+
+	copied := copyOutboundGroupSessionEntry(entry)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.outbound[entry.RoomID] = copied
+	return nil
+}
+
+func copyOutboundGroupSessionEntry(entry *OutboundGroupSessionEntry) *OutboundGroupSessionEntry {
+	copied := *entry
+	copied.Shares = append([]RoomKeyShare(nil), entry.Shares...)
+	return &copied
+}
+
+// LoadMegolmIndex returns the record of the message index of the session
+// or nil if the index was not seen yet.
+func (s *MemoryStore) LoadMegolmIndex(sessionID string, index uint32) (*MegolmIndexRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, ok := s.indices[megolmIndexKey{sessionID, index}]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// SaveMegolmIndex stores the record of the message index of the session.
+func (s *MemoryStore) SaveMegolmIndex(sessionID string, index uint32, record MegolmIndexRecord) error {
+	if sessionID == "" {
+		return errors.New("sessionID must not be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.indices[megolmIndexKey{sessionID, index}] = record
+	return nil
+}
+
+// MegolmIndices returns the records of all message indices of the session
+// that were seen.
+func (s *MemoryStore) MegolmIndices(sessionID string) (map[uint32]MegolmIndexRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	indices := make(map[uint32]MegolmIndexRecord)
+	for key, record := range s.indices {
+		if key.sessionID == sessionID {
+			indices[key.index] = record
+		}
+	}
+	return indices, nil
+}
@@ -0,0 +1,136 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryStoreAccount(t *testing.T) {
+	Convey("A new MemoryStore should have no account.", t, func() {
+		store := NewMemoryStore()
+		acc, err := store.LoadAccount()
+		So(err, ShouldBeNil)
+		So(acc, ShouldBeNil)
+	})
+	Convey("A saved account should be loaded again.", t, func() {
+		store := NewMemoryStore()
+		acc, _ := NewAccount()
+		So(store.SaveAccount(acc), ShouldBeNil)
+
+		loaded, err := store.LoadAccount()
+		So(err, ShouldBeNil)
+		So(loaded, ShouldEqual, acc)
+	})
+	Convey("Saving a nil account should not work.", t, func() {
+		store := NewMemoryStore()
+		So(store.SaveAccount(nil), ShouldNotBeNil)
+	})
+}
+
+func TestMemoryStoreSessions(t *testing.T) {
+	first, _, _ := createOutboundSession()
+	second, _, _ := createOutboundSession()
+
+	Convey("Saving sessions", t, func() {
+		store := NewMemoryStore()
+		So(store.SaveSession("peer", first), ShouldBeNil)
+		So(store.SaveSession("peer", second), ShouldBeNil)
+
+		Convey("should return the most recently saved first.", func() {
+			sessions, err := store.LoadSessions("peer")
+			So(err, ShouldBeNil)
+			So(sessions, ShouldHaveLength, 2)
+			So(sessions[0], ShouldEqual, second)
+			So(sessions[1], ShouldEqual, first)
+		})
+		Convey("again should replace and move it to the front.", func() {
+			So(store.SaveSession("peer", first), ShouldBeNil)
+			sessions, _ := store.LoadSessions("peer")
+			So(sessions, ShouldHaveLength, 2)
+			So(sessions[0], ShouldEqual, first)
+		})
+		Convey("should list the peer.", func() {
+			peers, err := store.SessionPeers()
+			So(err, ShouldBeNil)
+			So(peers, ShouldResemble, []string{"peer"})
+		})
+		Convey("with an empty peer should not work.", func() {
+			So(store.SaveSession("", first), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMemoryStoreInboundGroupSessions(t *testing.T) {
+	_, in := createOutAndInboundGroupSession()
+
+	Convey("A saved inbound group session should be loaded by its ID.", t, func() {
+		store := NewMemoryStore()
+		So(store.SaveInboundGroupSession(&InboundGroupSessionEntry{Session: in, RoomID: "!room"}), ShouldBeNil)
+
+		entry, err := store.LoadInboundGroupSession(in.ID())
+		So(err, ShouldBeNil)
+		So(entry.Session, ShouldEqual, in)
+		So(entry.RoomID, ShouldEqual, "!room")
+
+		ids, _ := store.InboundGroupSessionIDs()
+		So(ids, ShouldResemble, []string{in.ID()})
+	})
+	Convey("Loading an unknown inbound group session should return nil.", t, func() {
+		store := NewMemoryStore()
+		entry, err := store.LoadInboundGroupSession("unknown")
+		So(err, ShouldBeNil)
+		So(entry, ShouldBeNil)
+	})
+}
+
+func TestMemoryStoreOutboundGroupSessions(t *testing.T) {
+	out, _ := createOutAndInboundGroupSession()
+
+	Convey("A saved outbound group session should be loaded by its room.", t, func() {
+		store := NewMemoryStore()
+		So(store.SaveOutboundGroupSession(&OutboundGroupSessionEntry{Session: out, RoomID: "!room"}), ShouldBeNil)
+
+		entry, err := store.LoadOutboundGroupSession("!room")
+		So(err, ShouldBeNil)
+		So(entry.Session, ShouldEqual, out)
+
+		rooms, _ := store.OutboundGroupSessionRooms()
+		So(rooms, ShouldResemble, []string{"!room"})
+	})
+	Convey("Saving an outbound group session without a room should not work.", t, func() {
+		store := NewMemoryStore()
+		So(store.SaveOutboundGroupSession(&OutboundGroupSessionEntry{Session: out}), ShouldNotBeNil)
+	})
+}
+
+func TestMemoryStoreMegolmIndices(t *testing.T) {
+	Convey("A saved message index should be loaded again.", t, func() {
+		store := NewMemoryStore()
+		So(store.SaveMegolmIndex("session", 3, MegolmIndexRecord{EventID: "$event", Timestamp: 42}), ShouldBeNil)
+
+		record, err := store.LoadMegolmIndex("session", 3)
+		So(err, ShouldBeNil)
+		So(*record, ShouldResemble, MegolmIndexRecord{EventID: "$event", Timestamp: 42})
+
+		record, err = store.LoadMegolmIndex("session", 4)
+		So(err, ShouldBeNil)
+		So(record, ShouldBeNil)
+	})
+	Convey("All message indices of a session should be listed.", t, func() {
+		store := NewMemoryStore()
+		store.SaveMegolmIndex("session", 3, MegolmIndexRecord{EventID: "$three"})
+		store.SaveMegolmIndex("session", 5, MegolmIndexRecord{EventID: "$five"})
+		store.SaveMegolmIndex("other", 4, MegolmIndexRecord{EventID: "$four"})
+
+		indices, err := store.MegolmIndices("session")
+		So(err, ShouldBeNil)
+		So(indices, ShouldResemble, map[uint32]MegolmIndexRecord{
+			3: {EventID: "$three"},
+			5: {EventID: "$five"},
+		})
+	})
+	Convey("Saving a message index without a session should not work.", t, func() {
+		So(NewMemoryStore().SaveMegolmIndex("", 0, MegolmIndexRecord{}), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,146 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// OlmEventContent is the content of an m.room.encrypted event that was
+// encrypted with Olm.
+type OlmEventContent struct {
+	Algorithm string `json:"algorithm"`
+	// SenderKey is the Curve25519 identity key of the sending device.
+	SenderKey string `json:"sender_key"`
+	// Ciphertext maps the Curve25519 identity keys of the recipient
+	// devices to the message encrypted for them.
+	Ciphertext map[string]OlmCiphertext `json:"ciphertext"`
+}
+
+// OlmCiphertext is a message encrypted for a single device.
+type OlmCiphertext struct {
+	Type MessageType `json:"type"`
+	Body string      `json:"body"`
+}
+
+// OlmPayload is the plaintext of an Olm encrypted event.
+type OlmPayload struct {
+	Type    string          `json:"type"`
+	Content json.RawMessage `json:"content"`
+	// Sender is the user ID of the sender.
+	Sender string `json:"sender"`
+	// Recipient is the user ID of the recipient.
+	Recipient string `json:"recipient"`
+	// RecipientKeys holds the ed25519 key of the recipient device.
+	RecipientKeys map[string]string `json:"recipient_keys"`
+	// Keys holds the ed25519 key of the sending device.
+	Keys map[string]string `json:"keys"`
+}
+
+// SenderED25519 returns the ed25519 key the sender claims to own.
+func (p *OlmPayload) SenderED25519() string {
+	return p.Keys[KeyAlgorithmED25519]
+}
+
+// OlmRecipient is the device an event is encrypted for.
+type OlmRecipient struct {
+	UserID     string
+	Curve25519 string
+	ED25519    string
+}
+
+// EncryptEvent encrypts an event for the recipient device. sender is the
+// user ID of the account of the manager.
+func (m *SessionManager) EncryptEvent(sender string, recipient OlmRecipient, eventType string, content interface{}) (*OlmEventContent, error) {
+	if sender == "" || eventType == "" {
+		return nil, errors.New("sender and eventType must not be empty")
+	}
+	if recipient.UserID == "" || recipient.Curve25519 == "" || recipient.ED25519 == "" {
+		return nil, errors.New("the recipient must be complete")
+	}
+
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	identityKeys := m.account.IdentityKeys()
+	plaintext, err := json.Marshal(&OlmPayload{
+		Type:          eventType,
+		Content:       contentJSON,
+		Sender:        sender,
+		Recipient:     recipient.UserID,
+		RecipientKeys: map[string]string{KeyAlgorithmED25519: recipient.ED25519},
+		Keys:          map[string]string{KeyAlgorithmED25519: identityKeys.ED25519},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body, typ, err := m.Encrypt(recipient.Curve25519, string(plaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	return &OlmEventContent{
+		Algorithm: AlgorithmOlmV1,
+		SenderKey: identityKeys.Curve25519,
+		Ciphertext: map[string]OlmCiphertext{
+			recipient.Curve25519: {Type: typ, Body: body},
+		},
+	}, nil
+}
+
+// DecryptEvent decrypts an event sent by the device sender to the user
+// recipient, which is the user ID of the account of the manager.
+//
+// The event is rejected unless it was sent with the Curve25519 key of the
+// sender. The payload is rejected unless it names the same sender and
+// recipient as the event, claims the ed25519 key of the sender and is meant
+// for the ed25519 key of this account.
+func (m *SessionManager) DecryptEvent(sender *DeviceKeys, recipient string, content *OlmEventContent) (*OlmPayload, error) {
+	if sender == nil {
+		return nil, errors.New("sender must not be nil")
+	}
+	if content == nil {
+		return nil, errors.New("content must not be nil")
+	}
+	if content.Algorithm != AlgorithmOlmV1 {
+		return nil, fmt.Errorf("unexpected algorithm %q", content.Algorithm)
+	}
+	if content.SenderKey == "" || content.SenderKey != sender.Curve25519() {
+		return nil, errors.New("event was not sent with the key of the sender")
+	}
+
+	identityKeys := m.account.IdentityKeys()
+	ciphertext, ok := content.Ciphertext[identityKeys.Curve25519]
+	if !ok {
+		return nil, errors.New("event is not encrypted for this device")
+	}
+
+	plaintext, err := m.Decrypt(content.SenderKey, ciphertext.Type, ciphertext.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &OlmPayload{}
+	err = json.Unmarshal([]byte(plaintext), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.Sender != sender.UserID {
+		return nil, fmt.Errorf("payload was sent by %q, not %q", payload.Sender, sender.UserID)
+	}
+	if payload.Recipient != recipient {
+		return nil, fmt.Errorf("payload is meant for %q, not %q", payload.Recipient, recipient)
+	}
+	if payload.RecipientKeys[KeyAlgorithmED25519] != identityKeys.ED25519 {
+		return nil, errors.New("payload is meant for another device")
+	}
+	if payload.SenderED25519() == "" || payload.SenderED25519() != sender.ED25519() {
+		return nil, errors.New("payload does not contain the key of the sender")
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,122 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func olmRecipientOf(manager *SessionManager, userID string) OlmRecipient {
+	keys := manager.Account().IdentityKeys()
+	return OlmRecipient{
+		UserID:     userID,
+		Curve25519: keys.Curve25519,
+		ED25519:    keys.ED25519,
+	}
+}
+
+func olmDeviceOf(manager *SessionManager, userID string) *DeviceKeys {
+	device, _ := NewDeviceKeys(manager.Account(), userID, "DEVICE")
+	return device
+}
+
+func TestOlmEvent(t *testing.T) {
+	Convey("An Olm encrypted event", t, func() {
+		alice := createSessionManager()
+		bob := createSessionManager()
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+		aliceDevice := olmDeviceOf(alice, "@alice:example.org")
+
+		content, err := alice.EncryptEvent("@alice:example.org", olmRecipientOf(bob, "@bob:example.org"), "m.room_key", map[string]string{"a": "b"})
+		So(err, ShouldBeNil)
+
+		Convey("should have the expected envelope.", func() {
+			So(content.Algorithm, ShouldEqual, AlgorithmOlmV1)
+			So(content.SenderKey, ShouldEqual, alice.Account().IdentityKeys().Curve25519)
+			So(content.Ciphertext, ShouldContainKey, bobKey)
+		})
+		Convey("should be decrypted by the recipient.", func() {
+			payload, err := bob.DecryptEvent(aliceDevice, "@bob:example.org", content)
+			So(err, ShouldBeNil)
+			So(payload.Type, ShouldEqual, "m.room_key")
+			So(string(payload.Content), ShouldEqual, `{"a":"b"}`)
+			So(payload.SenderED25519(), ShouldEqual, alice.Account().IdentityKeys().ED25519)
+		})
+		Convey("should survive a JSON round trip.", func() {
+			data, _ := json.Marshal(content)
+			parsed := &OlmEventContent{}
+			So(json.Unmarshal(data, parsed), ShouldBeNil)
+
+			_, err := bob.DecryptEvent(aliceDevice, "@bob:example.org", parsed)
+			So(err, ShouldBeNil)
+		})
+		Convey("should be rejected if sent by another user.", func() {
+			_, err := bob.DecryptEvent(olmDeviceOf(alice, "@mallory:example.org"), "@bob:example.org", content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected if sent by another device.", func() {
+			mallory := createSessionManager()
+			_, err := bob.DecryptEvent(olmDeviceOf(mallory, "@alice:example.org"), "@bob:example.org", content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected if delivered to someone else.", func() {
+			_, err := bob.DecryptEvent(aliceDevice, "@carol:example.org", content)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected with another algorithm.", func() {
+			content.Algorithm = AlgorithmMegolmV1
+			_, err := bob.DecryptEvent(aliceDevice, "@bob:example.org", content)
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("An event encrypted for the wrong device should be rejected.", t, func() {
+		alice := createSessionManager()
+		bob := createSessionManager()
+		carol := createSessionManager()
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+
+		aliceDevice := olmDeviceOf(alice, "@alice:example.org")
+
+		recipient := olmRecipientOf(bob, "@bob:example.org")
+		recipient.ED25519 = carol.Account().IdentityKeys().ED25519
+		content, _ := alice.EncryptEvent("@alice:example.org", recipient, "m.dummy", struct{}{})
+
+		_, err := bob.DecryptEvent(aliceDevice, "@bob:example.org", content)
+		So(err, ShouldNotBeNil)
+
+		_, err = carol.DecryptEvent(aliceDevice, "@bob:example.org", content)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("An event claiming the wrong ed25519 key of the sender should be rejected.", t, func() {
+		alice := createSessionManager()
+		bob := createSessionManager()
+		mallory := createSessionManager()
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+
+		plaintext, _ := json.Marshal(&OlmPayload{
+			Type:          "m.dummy",
+			Content:       json.RawMessage(`{}`),
+			Sender:        "@alice:example.org",
+			Recipient:     "@bob:example.org",
+			RecipientKeys: map[string]string{KeyAlgorithmED25519: bob.Account().IdentityKeys().ED25519},
+			Keys:          map[string]string{KeyAlgorithmED25519: mallory.Account().IdentityKeys().ED25519},
+		})
+		body, typ, _ := alice.Encrypt(bobKey, string(plaintext))
+		content := &OlmEventContent{
+			Algorithm:  AlgorithmOlmV1,
+			SenderKey:  alice.Account().IdentityKeys().Curve25519,
+			Ciphertext: map[string]OlmCiphertext{bobKey: {Type: typ, Body: body}},
+		}
+
+		_, err := bob.DecryptEvent(olmDeviceOf(alice, "@alice:example.org"), "@bob:example.org", content)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Encrypting for an incomplete recipient should not work.", t, func() {
+		_, err := createSessionManager().EncryptEvent("@alice:example.org", OlmRecipient{}, "m.dummy", nil)
+		So(err, ShouldNotBeNil)
+	})
+}
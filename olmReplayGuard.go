@@ -0,0 +1,221 @@
+package golm
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrReplay is returned if an Olm message was already seen or a pre-key
+// message uses a one time key that was already consumed.
+var ErrReplay = errors.New("message was replayed")
+
+// DefaultOlmReplayWindow is the default number of message hashes an
+// OlmReplayGuard remembers.
+const DefaultOlmReplayWindow = 1024
+
+// OlmReplayGuard wraps the creation of inbound sessions and the decryption
+// of Olm messages to reject messages that were seen before. It is safe for
+// concurrent use.
+//
+// The SHA-256 hashes of the last Window successfully decrypted messages are
+// remembered. One time keys are remembered once a pre-key message sent with
+// them was decrypted, so a captured pre-key message can not create a
+// second session even if the key was never removed from the account.
+// Creating a session does not consume the key, as olm does not check the
+// MAC of a pre-key message before it is decrypted; otherwise forged
+// messages could burn the published keys. As olm only lists the IDs of
+// unpublished keys, consumed keys are remembered by their public key.
+type OlmReplayGuard struct {
+	// Window is the number of message hashes that are remembered.
+	Window int
+
+	account  *Account
+	utility  *Utility
+	mutex    sync.Mutex
+	seen     map[string]bool
+	order    []string
+	consumed map[string]bool
+}
+
+// NewOlmReplayGuard creates a guard for the sessions of the account.
+func NewOlmReplayGuard(account *Account) *OlmReplayGuard {
+	return &OlmReplayGuard{
+		Window:   DefaultOlmReplayWindow,
+		account:  account,
+		utility:  NewUtility(),
+		seen:     make(map[string]bool),
+		consumed: make(map[string]bool),
+	}
+}
+
+// NewInboundSession creates a new inbound session like NewInboundSession
+// unless the message or its one time key was already seen, in which case
+// ErrReplay is returned. The one time key is consumed once the message is
+// decrypted with Decrypt or Consume is called.
+func (g *OlmReplayGuard) NewInboundSession(oneTimeKeyMessage string) (*Session, error) {
+	return g.newInboundSession(oneTimeKeyMessage, func() (*Session, error) {
+		return NewInboundSession(g.account, oneTimeKeyMessage)
+	})
+}
+
+// NewInboundSessionFrom creates a new inbound session like
+// NewInboundSessionFrom unless the message or its one time key was already
+// seen, in which case ErrReplay is returned. The one time key is consumed
+// once the message is decrypted with Decrypt or Consume is called.
+func (g *OlmReplayGuard) NewInboundSessionFrom(theirIdentityKey, oneTimeKeyMessage string) (*Session, error) {
+	return g.newInboundSession(oneTimeKeyMessage, func() (*Session, error) {
+		return NewInboundSessionFrom(g.account, theirIdentityKey, oneTimeKeyMessage)
+	})
+}
+
+func (g *OlmReplayGuard) newInboundSession(message string, create func() (*Session, error)) (*Session, error) {
+	if message == "" {
+		return nil, errors.New("oneTimeKeyMessage must not be empty")
+	}
+
+	oneTimeKey, err := preKeyMessageOneTimeKey(message)
+	if err != nil {
+		return nil, err
+	}
+	hash := g.utility.SHA256(message)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.seen[hash] || g.consumed[oneTimeKey] {
+		return nil, ErrReplay
+	}
+
+	return create()
+}
+
+// Consume records the one time key of the pre-key message as consumed. It
+// should only be called once the message was decrypted successfully.
+func (g *OlmReplayGuard) Consume(oneTimeKeyMessage string) error {
+	oneTimeKey, err := preKeyMessageOneTimeKey(oneTimeKeyMessage)
+	if err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.consumed[oneTimeKey] = true
+	return nil
+}
+
+// Decrypt decrypts the message with the session unless it was already
+// seen, in which case ErrReplay is returned. The one time key of a
+// decrypted pre-key message is consumed.
+func (g *OlmReplayGuard) Decrypt(sess *Session, typ MessageType, message string) (string, error) {
+	if err := g.Check(message); err != nil {
+		return "", err
+	}
+
+	plaintext, err := sess.Decrypt(typ, message)
+	if err != nil {
+		return "", err
+	}
+
+	if typ == MessageTypePreKey {
+		err = g.Consume(message)
+		if err != nil {
+			return "", err
+		}
+	}
+	g.Remember(message)
+	return plaintext, nil
+}
+
+// Check returns ErrReplay if the message was already seen.
+func (g *OlmReplayGuard) Check(message string) error {
+	if message == "" {
+		return errors.New("message must not be empty")
+	}
+
+	hash := g.utility.SHA256(message)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.seen[hash] {
+		return ErrReplay
+	}
+	return nil
+}
+
+// Remember records the message as seen. It should only be called for
+// messages that were decrypted successfully, so forged messages can not
+// push real ones out of the window.
+func (g *OlmReplayGuard) Remember(message string) {
+	if message == "" {
+		return
+	}
+
+	hash := g.utility.SHA256(message)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.seen[hash] {
+		return
+	}
+	g.seen[hash] = true
+	g.order = append(g.order, hash)
+
+	for len(g.order) > g.Window && len(g.order) > 0 {
+		delete(g.seen, g.order[0])
+		g.order = g.order[1:]
+	}
+}
+
+// preKeyMessageOneTimeKey returns the one time key a pre-key message was
+// sent with, encoded like the keys of OneTimeKeys.
+//
+// A pre-key message is a version byte followed by protobuf style fields,
+// the one time key being field 1.
+func preKeyMessageOneTimeKey(message string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(message)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 || data[0] != 3 {
+		return "", errors.New("unsupported pre-key message version")
+	}
+
+	data = data[1:]
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return "", errors.New("malformed pre-key message")
+		}
+		data = data[n:]
+
+		switch tag & 7 {
+		case 0:
+			_, n = binary.Uvarint(data)
+			if n <= 0 {
+				return "", errors.New("malformed pre-key message")
+			}
+			data = data[n:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return "", errors.New("malformed pre-key message")
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+
+			if tag>>3 == 1 {
+				return base64.RawStdEncoding.EncodeToString(value), nil
+			}
+		default:
+			return "", fmt.Errorf("unexpected wire type %d in pre-key message", tag&7)
+		}
+	}
+
+	return "", errors.New("pre-key message has no one time key")
+}
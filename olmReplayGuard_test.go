@@ -0,0 +1,176 @@
+package golm
+
+import (
+	"encoding/base64"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPreKeyMessageOneTimeKey(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	encodedKey := base64.RawStdEncoding.EncodeToString(key)
+
+	Convey("The one time key of a pre-key message should be found.", t, func() {
+		message := []byte{3, 0x0A, 32}
+		message = append(message, key...)
+		message = append(message, 0x12, 2, 0xAA, 0xBB)
+
+		otk, err := preKeyMessageOneTimeKey(base64.RawStdEncoding.EncodeToString(message))
+		So(err, ShouldBeNil)
+		So(otk, ShouldEqual, encodedKey)
+	})
+	Convey("The one time key should be found after other fields.", t, func() {
+		message := []byte{3, 0x12, 2, 0xAA, 0xBB, 0x0A, 32}
+		message = append(message, key...)
+
+		otk, err := preKeyMessageOneTimeKey(base64.RawStdEncoding.EncodeToString(message))
+		So(err, ShouldBeNil)
+		So(otk, ShouldEqual, encodedKey)
+	})
+	Convey("A pre-key message with another version should not work.", t, func() {
+		_, err := preKeyMessageOneTimeKey(base64.RawStdEncoding.EncodeToString([]byte{2, 0x0A, 0}))
+		So(err, ShouldNotBeNil)
+	})
+	Convey("A truncated pre-key message should not work.", t, func() {
+		_, err := preKeyMessageOneTimeKey(base64.RawStdEncoding.EncodeToString([]byte{3, 0x0A, 32, 1, 2}))
+		So(err, ShouldNotBeNil)
+	})
+	Convey("A pre-key message without a one time key should not work.", t, func() {
+		_, err := preKeyMessageOneTimeKey(base64.RawStdEncoding.EncodeToString([]byte{3, 0x12, 1, 0}))
+		So(err, ShouldNotBeNil)
+	})
+	Convey("A message that is not base64 should not work.", t, func() {
+		_, err := preKeyMessageOneTimeKey("!!!")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestOlmReplayGuard(t *testing.T) {
+	Convey("An OlmReplayGuard", t, func() {
+		out, from, to := createOutboundSession()
+		guard := NewOlmReplayGuard(to)
+		fromKey := from.IdentityKeys().Curve25519
+
+		message, _, _ := out.Encrypt("hello")
+
+		sess, err := guard.NewInboundSessionFrom(fromKey, message)
+		So(err, ShouldBeNil)
+
+		plaintext, err := guard.Decrypt(sess, MessageTypePreKey, message)
+		So(err, ShouldBeNil)
+		So(plaintext, ShouldEqual, "hello")
+
+		Convey("should reject the same message again.", func() {
+			_, err := guard.Decrypt(sess, MessageTypePreKey, message)
+			So(err, ShouldEqual, ErrReplay)
+		})
+		Convey("should not create a second session from the message.", func() {
+			_, err := guard.NewInboundSessionFrom(fromKey, message)
+			So(err, ShouldEqual, ErrReplay)
+
+			_, err = guard.NewInboundSession(message)
+			So(err, ShouldEqual, ErrReplay)
+		})
+		Convey("should not create a session from another message with the used one time key.", func() {
+			second, _, _ := out.Encrypt("again")
+			_, err := guard.NewInboundSessionFrom(fromKey, second)
+			So(err, ShouldEqual, ErrReplay)
+		})
+		Convey("should accept new messages.", func() {
+			reply, typ, _ := sess.Encrypt("reply")
+			out.Decrypt(typ, reply)
+
+			next, typ, _ := out.Encrypt("next")
+			plaintext, err := guard.Decrypt(sess, typ, next)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "next")
+		})
+	})
+	Convey("A forged pre-key message should not consume the one time key.", t, func() {
+		out, from, to := createOutboundSession()
+		guard := NewOlmReplayGuard(to)
+		fromKey := from.IdentityKeys().Curve25519
+
+		message, _, _ := out.Encrypt("hello")
+		forged := corruptOlmMAC(message)
+
+		sess, err := guard.NewInboundSessionFrom(fromKey, forged)
+		So(err, ShouldBeNil)
+		_, err = guard.Decrypt(sess, MessageTypePreKey, forged)
+		So(err, ShouldNotBeNil)
+
+		sess, err = guard.NewInboundSessionFrom(fromKey, message)
+		So(err, ShouldBeNil)
+		plaintext, err := guard.Decrypt(sess, MessageTypePreKey, message)
+		So(err, ShouldBeNil)
+		So(plaintext, ShouldEqual, "hello")
+	})
+	Convey("An OlmReplayGuard should forget messages outside its window.", t, func() {
+		acc, _ := NewAccount()
+		guard := NewOlmReplayGuard(acc)
+		guard.Window = 2
+
+		guard.Remember("first")
+		guard.Remember("second")
+		So(guard.Check("first"), ShouldEqual, ErrReplay)
+
+		guard.Remember("third")
+		So(guard.Check("first"), ShouldBeNil)
+		So(guard.Check("second"), ShouldEqual, ErrReplay)
+		So(guard.Check("third"), ShouldEqual, ErrReplay)
+	})
+}
+
+// corruptOlmMAC alters the MAC at the end of an Olm message.
+func corruptOlmMAC(message string) string {
+	corrupted := []byte(message)
+	if corrupted[len(corrupted)-2] == 'A' {
+		corrupted[len(corrupted)-2] = 'B'
+	} else {
+		corrupted[len(corrupted)-2] = 'A'
+	}
+	return string(corrupted)
+}
+
+func TestSessionManagerReplay(t *testing.T) {
+	Convey("A SessionManager", t, func() {
+		alice := createSessionManager()
+		bob := createSessionManager()
+		aliceKey := alice.Account().IdentityKeys().Curve25519
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+
+		message, typ, _ := alice.Encrypt(bobKey, "hello")
+		_, err := bob.Decrypt(aliceKey, typ, message)
+		So(err, ShouldBeNil)
+
+		Convey("should reject a replayed pre-key message.", func() {
+			_, err := bob.Decrypt(aliceKey, typ, message)
+			So(err, ShouldEqual, ErrReplay)
+
+			sessions, _ := bob.Sessions(aliceKey)
+			So(sessions, ShouldHaveLength, 1)
+		})
+	})
+	Convey("A SessionManager should decrypt a pre-key message after a forged one with the same key.", t, func() {
+		alice := createSessionManager()
+		bob := createSessionManager()
+		aliceKey := alice.Account().IdentityKeys().Curve25519
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+		keysBefore := bob.Account().OneTimeKeys().Size()
+
+		message, typ, _ := alice.Encrypt(bobKey, "hello")
+		_, err := bob.Decrypt(aliceKey, typ, corruptOlmMAC(message))
+		So(err, ShouldNotBeNil)
+		So(bob.Account().OneTimeKeys().Size(), ShouldEqual, keysBefore)
+
+		plaintext, err := bob.Decrypt(aliceKey, typ, message)
+		So(err, ShouldBeNil)
+		So(plaintext, ShouldEqual, "hello")
+	})
+}
@@ -0,0 +1,115 @@
+package golm
+
+import (
+	"errors"
+	"sync"
+)
+
+// DefaultOneTimeKeyTargetFraction is the default fraction of
+// MaxNumberOfOneTimeKeys that is kept on the server.
+const DefaultOneTimeKeyTargetFraction = 0.5
+
+// OneTimeKeyUploadFunc uploads one time keys to the server. It must only
+// return nil if the server accepted all of the keys.
+type OneTimeKeyUploadFunc func(keys *OneTimeKeys) error
+
+// OneTimeKeyReplenisher keeps the number of one time keys on the server
+// topped up. It is safe for concurrent use, but the account must not be
+// changed by anything else while Replenish runs.
+type OneTimeKeyReplenisher struct {
+	// TargetFraction is the fraction of MaxNumberOfOneTimeKeys that is
+	// kept on the server.
+	TargetFraction float64
+
+	mutex   sync.Mutex
+	account *Account
+	store   AccountStore
+	upload  OneTimeKeyUploadFunc
+}
+
+// NewOneTimeKeyReplenisher creates a OneTimeKeyReplenisher for the account.
+// The account is saved to the store whenever it changes.
+func NewOneTimeKeyReplenisher(account *Account, store AccountStore, upload OneTimeKeyUploadFunc) *OneTimeKeyReplenisher {
+	return &OneTimeKeyReplenisher{
+		TargetFraction: DefaultOneTimeKeyTargetFraction,
+		account:        account,
+		store:          store,
+		upload:         upload,
+	}
+}
+
+// Target returns the number of one time keys that should be on the server.
+func (r *OneTimeKeyReplenisher) Target() int {
+	max := r.account.MaxNumberOfOneTimeKeys()
+	target := int(float64(max) * r.TargetFraction)
+	if target > max {
+		return max
+	}
+	if target < 0 {
+		return 0
+	}
+	return target
+}
+
+// Replenish generates as many one time keys as are needed to reach the
+// target given that serverCount keys are left on the server. All
+// unpublished keys, including ones left over from a failed upload, are then
+// uploaded and marked as published once the upload succeeded. Returns the
+// number of uploaded keys.
+//
+// The account is saved after generating the keys, so the private parts of
+// the keys are never lost after they were uploaded, and again after marking
+// them as published.
+func (r *OneTimeKeyReplenisher) Replenish(serverCount int) (int, error) {
+	if serverCount < 0 {
+		return 0, errors.New("serverCount must not be negative")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	unpublished := r.account.OneTimeKeys().Size()
+	missing := r.Target() - serverCount - unpublished
+	if free := r.account.MaxNumberOfOneTimeKeys() - unpublished; missing > free {
+		missing = free
+	}
+	if missing > 0 {
+		err := r.account.GenerateOneTimeKeys(missing)
+		if err != nil {
+			return 0, err
+		}
+		err = r.store.SaveAccount(r.account)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	keys := r.account.OneTimeKeys()
+	if keys.Size() == 0 {
+		return 0, nil
+	}
+
+	err := r.upload(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	// MarkKeysAsPublished marks whatever keys are unpublished right now,
+	// so make sure these are a subset of the uploaded ones.
+	for id, key := range r.account.OneTimeKeys().Curve25519 {
+		if keys.Curve25519[id] != key {
+			return 0, errors.New("one time keys changed during the upload")
+		}
+	}
+
+	err = r.account.MarkKeysAsPublished()
+	if err != nil {
+		return 0, err
+	}
+	err = r.store.SaveAccount(r.account)
+	if err != nil {
+		return 0, err
+	}
+
+	return keys.Size(), nil
+}
@@ -0,0 +1,78 @@
+package golm
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOneTimeKeyReplenisherReplenish(t *testing.T) {
+	Convey("Replenishing", t, func() {
+		acc, _ := NewAccount()
+		store := NewMemoryStore()
+		var uploaded []*OneTimeKeys
+		replenisher := NewOneTimeKeyReplenisher(acc, store, func(keys *OneTimeKeys) error {
+			uploaded = append(uploaded, keys)
+			return nil
+		})
+
+		Convey("an empty server should upload the target number of keys.", func() {
+			n, err := replenisher.Replenish(0)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, replenisher.Target())
+			So(uploaded, ShouldHaveLength, 1)
+			So(uploaded[0].Size(), ShouldEqual, replenisher.Target())
+			So(acc.OneTimeKeys().Size(), ShouldEqual, 0)
+
+			stored, _ := store.LoadAccount()
+			So(stored, ShouldEqual, acc)
+		})
+		Convey("a partially filled server should only upload the missing keys.", func() {
+			n, err := replenisher.Replenish(replenisher.Target() - 3)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+		})
+		Convey("a full server should not upload anything.", func() {
+			n, err := replenisher.Replenish(replenisher.Target())
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+			So(uploaded, ShouldBeEmpty)
+		})
+		Convey("with a negative count should not work.", func() {
+			_, err := replenisher.Replenish(-1)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestOneTimeKeyReplenisherFailedUpload(t *testing.T) {
+	Convey("After a failed upload", t, func() {
+		acc, _ := NewAccount()
+		fail := true
+		var uploaded []*OneTimeKeys
+		replenisher := NewOneTimeKeyReplenisher(acc, NewMemoryStore(), func(keys *OneTimeKeys) error {
+			if fail {
+				return errors.New("server unavailable")
+			}
+			uploaded = append(uploaded, keys)
+			return nil
+		})
+
+		_, err := replenisher.Replenish(0)
+		So(err, ShouldNotBeNil)
+
+		Convey("the keys should not be marked as published.", func() {
+			So(acc.OneTimeKeys().Size(), ShouldEqual, replenisher.Target())
+		})
+		Convey("the next attempt should upload the same keys without generating more.", func() {
+			pending := acc.OneTimeKeys()
+			fail = false
+
+			n, err := replenisher.Replenish(0)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, replenisher.Target())
+			So(uploaded[0].Curve25519, ShouldResemble, pending.Curve25519)
+		})
+	})
+}
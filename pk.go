@@ -0,0 +1,301 @@
+package golm
+
+//#include <olm/pk.h>
+import "C"
+import (
+	"crypto/rand"
+	"errors"
+	"unsafe"
+)
+
+// PkMessage is a message encrypted with PkEncryption.
+type PkMessage struct {
+	Ciphertext string `json:"ciphertext"`
+	MAC        string `json:"mac"`
+	// Ephemeral is the ephemeral Curve25519 key the message was encrypted
+	// with.
+	Ephemeral string `json:"ephemeral"`
+}
+
+// PkEncryption encrypts messages for the owner of a Curve25519 key.
+type PkEncryption struct {
+	memory []byte
+	ptr    *C.OlmPkEncryption
+}
+
+func newPkEncryption() *PkEncryption {
+	buf := make([]byte, C.olm_pk_encryption_size())
+	ptr := C.olm_pk_encryption(unsafe.Pointer(&buf[0]))
+
+	return &PkEncryption{
+		memory: buf,
+		ptr:    ptr,
+	}
+}
+
+func (e *PkEncryption) lastError() string {
+	return C.GoString(C.olm_pk_encryption_last_error(e.ptr))
+}
+
+// Clear clears the memory used to back this PkEncryption.
+// Note that once this function was called using the object it
+// was called on will panic.
+//
+// C-Function: olm_clear_pk_encryption
+func (e *PkEncryption) Clear() {
+	C.olm_clear_pk_encryption(e.ptr)
+}
+
+// NewPkEncryption creates a PkEncryption encrypting for the given public key.
+//
+// C-Function: olm_pk_encryption_set_recipient_key
+func NewPkEncryption(recipientKey string) (*PkEncryption, error) {
+	if recipientKey == "" {
+		return nil, errors.New("recipientKey must not be empty")
+	}
+
+	e := newPkEncryption()
+
+	keyBytes := []byte(recipientKey)
+
+	result := C.olm_pk_encryption_set_recipient_key(
+		e.ptr,
+		unsafe.Pointer(&keyBytes[0]), C.size_t(len(keyBytes)),
+	)
+
+	err := getError(e, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Encrypt encrypts a message for the recipient.
+//
+// C-Function: olm_pk_encrypt
+func (e *PkEncryption) Encrypt(plaintext string) (*PkMessage, error) {
+	if plaintext == "" {
+		return nil, errors.New("plaintext must not be empty")
+	}
+
+	plaintextBytes := []byte(plaintext)
+	ciphertextBytes := make([]byte, C.olm_pk_ciphertext_length(e.ptr, C.size_t(len(plaintextBytes))))
+	macBytes := make([]byte, C.olm_pk_mac_length(e.ptr))
+	ephemeralBytes := make([]byte, C.olm_pk_key_length())
+	randomBytes := make([]byte, C.olm_pk_encrypt_random_length(e.ptr))
+
+	n, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := C.olm_pk_encrypt(
+		e.ptr,
+		unsafe.Pointer(&plaintextBytes[0]), C.size_t(len(plaintextBytes)),
+		unsafe.Pointer(&ciphertextBytes[0]), C.size_t(len(ciphertextBytes)),
+		unsafe.Pointer(&macBytes[0]), C.size_t(len(macBytes)),
+		unsafe.Pointer(&ephemeralBytes[0]), C.size_t(len(ephemeralBytes)),
+		unsafe.Pointer(&randomBytes[0]), C.size_t(n),
+	)
+
+	err = getError(e, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PkMessage{
+		Ciphertext: string(ciphertextBytes),
+		MAC:        string(macBytes),
+		Ephemeral:  string(ephemeralBytes),
+	}, nil
+}
+
+// PkDecryption decrypts messages encrypted for its Curve25519 key.
+type PkDecryption struct {
+	memory    []byte
+	ptr       *C.OlmPkDecryption
+	publicKey string
+}
+
+func newPkDecryption() *PkDecryption {
+	buf := make([]byte, C.olm_pk_decryption_size())
+	ptr := C.olm_pk_decryption(unsafe.Pointer(&buf[0]))
+
+	return &PkDecryption{
+		memory: buf,
+		ptr:    ptr,
+	}
+}
+
+func (d *PkDecryption) lastError() string {
+	return C.GoString(C.olm_pk_decryption_last_error(d.ptr))
+}
+
+// Clear clears the memory used to back this PkDecryption.
+// Note that once this function was called using the object it
+// was called on will panic.
+//
+// C-Function: olm_clear_pk_decryption
+func (d *PkDecryption) Clear() {
+	C.olm_clear_pk_decryption(d.ptr)
+}
+
+// NewPkDecryption creates a PkDecryption with a new random key.
+func NewPkDecryption() (*PkDecryption, error) {
+	privateKey := make([]byte, C.olm_pk_private_key_length())
+
+	_, err := rand.Read(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPkDecryptionFromPrivateKey(privateKey)
+}
+
+// NewPkDecryptionFromPrivateKey creates a PkDecryption using the given
+// private key.
+//
+// C-Function: olm_pk_key_from_private
+func NewPkDecryptionFromPrivateKey(privateKey []byte) (*PkDecryption, error) {
+	if len(privateKey) != int(C.olm_pk_private_key_length()) {
+		return nil, errors.New("privateKey has the wrong length")
+	}
+
+	d := newPkDecryption()
+
+	publicKeyBytes := make([]byte, C.olm_pk_key_length())
+
+	result := C.olm_pk_key_from_private(
+		d.ptr,
+		unsafe.Pointer(&publicKeyBytes[0]), C.size_t(len(publicKeyBytes)),
+		unsafe.Pointer(&privateKey[0]), C.size_t(len(privateKey)),
+	)
+
+	err := getError(d, result)
+	if err != nil {
+		return nil, err
+	}
+
+	d.publicKey = string(publicKeyBytes)
+	return d, nil
+}
+
+// UnpicklePkDecryption loads a PkDecryption from a pickled base64 string.
+// Decrypts the PkDecryption using the supplied key.
+//
+// C-Function: olm_unpickle_pk_decryption
+func UnpicklePkDecryption(key, pickle string) (*PkDecryption, error) {
+	if len(key) == 0 {
+		return nil, errors.New("key must not be empty")
+	}
+	if len(pickle) == 0 {
+		return nil, errors.New("pickle must not be empty")
+	}
+
+	d := newPkDecryption()
+
+	keyBytes := []byte(key)
+	pickleBytes := []byte(pickle)
+	publicKeyBytes := make([]byte, C.olm_pk_key_length())
+
+	result := C.olm_unpickle_pk_decryption(
+		d.ptr,
+		unsafe.Pointer(&keyBytes[0]), C.size_t(len(keyBytes)),
+		unsafe.Pointer(&pickleBytes[0]), C.size_t(len(pickleBytes)),
+		unsafe.Pointer(&publicKeyBytes[0]), C.size_t(len(publicKeyBytes)),
+	)
+
+	err := getError(d, result)
+	if err != nil {
+		return nil, err
+	}
+
+	d.publicKey = string(publicKeyBytes)
+	return d, nil
+}
+
+// Pickle stores the PkDecryption as a base64 encoded string.
+//
+// C-Function: olm_pickle_pk_decryption
+func (d *PkDecryption) Pickle(key string) (string, error) {
+	if len(key) == 0 {
+		return "", errors.New("key must not be empty")
+	}
+
+	keyBytes := []byte(key)
+	pickleBytes := make([]byte, C.olm_pickle_pk_decryption_length(d.ptr))
+
+	result := C.olm_pickle_pk_decryption(
+		d.ptr,
+		unsafe.Pointer(&keyBytes[0]), C.size_t(len(keyBytes)),
+		unsafe.Pointer(&pickleBytes[0]), C.size_t(len(pickleBytes)),
+	)
+
+	err := getError(d, result)
+	panicOnError(err)
+
+	return string(pickleBytes[:result]), nil
+}
+
+// PublicKey returns the public key messages are encrypted for.
+func (d *PkDecryption) PublicKey() string {
+	return d.publicKey
+}
+
+// PrivateKey returns the private key.
+//
+// C-Function: olm_pk_get_private_key
+func (d *PkDecryption) PrivateKey() []byte {
+	privateKey := make([]byte, C.olm_pk_private_key_length())
+
+	result := C.olm_pk_get_private_key(
+		d.ptr,
+		unsafe.Pointer(&privateKey[0]), C.size_t(len(privateKey)),
+	)
+
+	err := getError(d, result)
+	// Only OUTPUT_BUFFER_TOO_SMALL can happen, which never happens here.
+	panicOnError(err)
+
+	return privateKey
+}
+
+// Decrypt decrypts a message encrypted for the key.
+//
+// C-Function: olm_pk_decrypt
+func (d *PkDecryption) Decrypt(message *PkMessage) (string, error) {
+	if message == nil {
+		return "", errors.New("message must not be nil")
+	}
+	if message.Ciphertext == "" || message.MAC == "" || message.Ephemeral == "" {
+		return "", errors.New("message must be complete")
+	}
+
+	ephemeralBytes := []byte(message.Ephemeral)
+	macBytes := []byte(message.MAC)
+	// olm_pk_decrypt destroys the ciphertext.
+	ciphertextBytes := []byte(message.Ciphertext)
+	plaintextLength := C.olm_pk_max_plaintext_length(d.ptr, C.size_t(len(ciphertextBytes)))
+	// Ciphertexts of an impossible base64 length fail here without
+	// setting the last error of the object.
+	if plaintextLength == errorCode() || plaintextLength == 0 {
+		return "", errors.New("INVALID_BASE64")
+	}
+	plaintextBytes := make([]byte, plaintextLength)
+
+	result := C.olm_pk_decrypt(
+		d.ptr,
+		unsafe.Pointer(&ephemeralBytes[0]), C.size_t(len(ephemeralBytes)),
+		unsafe.Pointer(&macBytes[0]), C.size_t(len(macBytes)),
+		unsafe.Pointer(&ciphertextBytes[0]), C.size_t(len(ciphertextBytes)),
+		unsafe.Pointer(&plaintextBytes[0]), C.size_t(len(plaintextBytes)),
+	)
+
+	err := getError(d, result)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintextBytes[:result]), nil
+}
@@ -0,0 +1,120 @@
+package golm
+
+//#include <olm/pk.h>
+import "C"
+import (
+	"crypto/rand"
+	"errors"
+	"unsafe"
+)
+
+// PkSigning signs messages with an ed25519 key that does not belong to an
+// account, like the cross-signing keys.
+type PkSigning struct {
+	memory    []byte
+	ptr       *C.OlmPkSigning
+	seed      []byte
+	publicKey string
+}
+
+func newPkSigning() *PkSigning {
+	buf := make([]byte, C.olm_pk_signing_size())
+	ptr := C.olm_pk_signing(unsafe.Pointer(&buf[0]))
+
+	return &PkSigning{
+		memory: buf,
+		ptr:    ptr,
+	}
+}
+
+func (s *PkSigning) lastError() string {
+	return C.GoString(C.olm_pk_signing_last_error(s.ptr))
+}
+
+// Clear clears the memory used to back this PkSigning.
+// Note that once this function was called using the object it
+// was called on will panic.
+//
+// C-Function: olm_clear_pk_signing
+func (s *PkSigning) Clear() {
+	C.olm_clear_pk_signing(s.ptr)
+	for i := range s.seed {
+		s.seed[i] = 0
+	}
+}
+
+// NewPkSigning creates a PkSigning with a new random key.
+func NewPkSigning() (*PkSigning, error) {
+	seed := make([]byte, C.olm_pk_signing_seed_length())
+
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPkSigningFromSeed(seed)
+}
+
+// NewPkSigningFromSeed creates a PkSigning using the given seed as
+// private key.
+//
+// C-Function: olm_pk_signing_key_from_seed
+func NewPkSigningFromSeed(seed []byte) (*PkSigning, error) {
+	if len(seed) != int(C.olm_pk_signing_seed_length()) {
+		return nil, errors.New("seed has the wrong length")
+	}
+
+	s := newPkSigning()
+	s.seed = append([]byte(nil), seed...)
+
+	publicKeyBytes := make([]byte, C.olm_pk_signing_public_key_length())
+
+	result := C.olm_pk_signing_key_from_seed(
+		s.ptr,
+		unsafe.Pointer(&publicKeyBytes[0]), C.size_t(len(publicKeyBytes)),
+		unsafe.Pointer(&s.seed[0]), C.size_t(len(s.seed)),
+	)
+
+	err := getError(s, result)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publicKey = string(publicKeyBytes)
+	return s, nil
+}
+
+// PublicKey returns the public ed25519 key.
+func (s *PkSigning) PublicKey() string {
+	return s.publicKey
+}
+
+// Seed returns the seed the key was created from.
+func (s *PkSigning) Seed() []byte {
+	return append([]byte(nil), s.seed...)
+}
+
+// Sign signs the message and returns the base64 encoded signature.
+//
+// C-Function: olm_pk_sign
+func (s *PkSigning) Sign(message string) (string, error) {
+	if len(message) == 0 {
+		return "", errors.New("message must not be empty")
+	}
+
+	messageBytes := []byte(message)
+	signatureBytes := make([]byte, C.olm_pk_signature_length())
+
+	result := C.olm_pk_sign(
+		s.ptr,
+		(*C.uint8_t)(unsafe.Pointer(&messageBytes[0])), C.size_t(len(messageBytes)),
+		(*C.uint8_t)(unsafe.Pointer(&signatureBytes[0])), C.size_t(len(signatureBytes)),
+	)
+
+	err := getError(s, result)
+	if err != nil {
+		return "", err
+	}
+
+	return string(signatureBytes), nil
+}
@@ -0,0 +1,62 @@
+package golm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewPkSigning(t *testing.T) {
+	Convey("Creating a PkSigning should work.", t, func() {
+		s, err := NewPkSigning()
+		So(err, ShouldBeNil)
+		So(s.PublicKey(), ShouldNotBeEmpty)
+		So(s.Seed(), ShouldHaveLength, 32)
+	})
+	Convey("Creating a PkSigning with the random source faulty should error.", t, func() {
+		ctrl := gomock.NewController(t)
+		mock := NewMockReader(ctrl)
+
+		mock.EXPECT().Read(gomock.Any()).Return(0, errors.New("some error"))
+
+		sw := switchRandSource(mock)
+		defer sw.Revert()
+
+		s, err := NewPkSigning()
+		So(err, ShouldNotBeNil)
+		So(s, ShouldBeNil)
+	})
+	Convey("A PkSigning created from the same seed should have the same public key.", t, func() {
+		s, _ := NewPkSigning()
+		restored, err := NewPkSigningFromSeed(s.Seed())
+		So(err, ShouldBeNil)
+		So(restored.PublicKey(), ShouldEqual, s.PublicKey())
+	})
+	Convey("Creating a PkSigning from a short seed should fail.", t, func() {
+		_, err := NewPkSigningFromSeed(bytes.Repeat([]byte{1}, 16))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPkSigningSign(t *testing.T) {
+	Convey("A signature of a PkSigning", t, func() {
+		s, _ := NewPkSigning()
+		signature, err := s.Sign("message")
+		So(err, ShouldBeNil)
+
+		Convey("should be verified with its public key.", func() {
+			So(NewUtility().ED25519Verify(s.PublicKey(), "message", signature), ShouldBeNil)
+		})
+		Convey("should not be verified for another message.", func() {
+			So(NewUtility().ED25519Verify(s.PublicKey(), "other", signature), ShouldNotBeNil)
+		})
+	})
+	Convey("Signing an empty message should not work.", t, func() {
+		s, _ := NewPkSigning()
+		_, err := s.Sign("")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,108 @@
+package golm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewPkDecryption(t *testing.T) {
+	Convey("Creating a PkDecryption should work.", t, func() {
+		d, err := NewPkDecryption()
+		So(err, ShouldBeNil)
+		So(d.PublicKey(), ShouldNotBeEmpty)
+		So(d.PrivateKey(), ShouldHaveLength, 32)
+	})
+	Convey("Creating a PkDecryption with the random source faulty should error.", t, func() {
+		ctrl := gomock.NewController(t)
+		mock := NewMockReader(ctrl)
+
+		mock.EXPECT().Read(gomock.Any()).Return(0, errors.New("some error"))
+
+		sw := switchRandSource(mock)
+		defer sw.Revert()
+
+		d, err := NewPkDecryption()
+		So(err, ShouldNotBeNil)
+		So(d, ShouldBeNil)
+	})
+	Convey("A PkDecryption created from the same private key should have the same public key.", t, func() {
+		d, _ := NewPkDecryption()
+		restored, err := NewPkDecryptionFromPrivateKey(d.PrivateKey())
+		So(err, ShouldBeNil)
+		So(restored.PublicKey(), ShouldEqual, d.PublicKey())
+	})
+	Convey("Creating a PkDecryption from a short private key should fail.", t, func() {
+		_, err := NewPkDecryptionFromPrivateKey(bytes.Repeat([]byte{1}, 16))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPkDecryptionPickle(t *testing.T) {
+	d, _ := NewPkDecryption()
+
+	Convey("Pickling and unpickling a PkDecryption should restore its key.", t, func() {
+		pickle, err := d.Pickle("key")
+		So(err, ShouldBeNil)
+
+		restored, err := UnpicklePkDecryption("key", pickle)
+		So(err, ShouldBeNil)
+		So(restored.PublicKey(), ShouldEqual, d.PublicKey())
+	})
+	Convey("Unpickling with the wrong key should fail.", t, func() {
+		pickle, _ := d.Pickle("key")
+		_, err := UnpicklePkDecryption("other", pickle)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Pickling with an empty key should fail.", t, func() {
+		_, err := d.Pickle("")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPkEncryption(t *testing.T) {
+	Convey("A message encrypted with PkEncryption", t, func() {
+		d, _ := NewPkDecryption()
+		e, err := NewPkEncryption(d.PublicKey())
+		So(err, ShouldBeNil)
+
+		message, err := e.Encrypt("secret")
+		So(err, ShouldBeNil)
+
+		Convey("should be decrypted by the recipient.", func() {
+			plaintext, err := d.Decrypt(message)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "secret")
+		})
+		Convey("should not be decrypted by someone else.", func() {
+			other, _ := NewPkDecryption()
+			_, err := other.Decrypt(message)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not be decrypted if incomplete.", func() {
+			message.MAC = ""
+			_, err := d.Decrypt(message)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not be decrypted if the ciphertext was truncated.", func() {
+			message.Ciphertext = message.Ciphertext[:5]
+			So(func() {
+				_, err := d.Decrypt(message)
+				So(err, ShouldNotBeNil)
+			}, ShouldNotPanic)
+		})
+	})
+	Convey("Encrypting an empty message should fail.", t, func() {
+		d, _ := NewPkDecryption()
+		e, _ := NewPkEncryption(d.PublicKey())
+		_, err := e.Encrypt("")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Creating a PkEncryption without a key should fail.", t, func() {
+		_, err := NewPkEncryption("")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,289 @@
+package golm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// QRVerificationMode tells which keys a QR code contains.
+type QRVerificationMode byte
+
+const (
+	// QRModeCrossUser verifies another user. The first key is the master
+	// key of the displaying user, the second key the master key of the
+	// scanning user.
+	QRModeCrossUser QRVerificationMode = 0
+	// QRModeSelfTrusted verifies another device of our own user from a
+	// device that trusts the master key. The first key is the master key,
+	// the second key the device key of the scanning device.
+	QRModeSelfTrusted QRVerificationMode = 1
+	// QRModeSelfUntrusted verifies another device of our own user from a
+	// device that does not trust the master key yet. The first key is the
+	// device key of the displaying device, the second key the master key.
+	QRModeSelfUntrusted QRVerificationMode = 2
+)
+
+const (
+	qrVerificationPrefix  = "MATRIX"
+	qrVerificationVersion = 0x02
+	qrVerificationKey     = 32
+	// qrVerificationSecret is the length of generated shared secrets;
+	// parsed secrets must be at least qrVerificationMinSecret long.
+	qrVerificationSecret    = 16
+	qrVerificationMinSecret = 8
+)
+
+// ErrQRCodeMismatch is returned if the keys of a QR code are not the keys
+// we know. The verification must be cancelled with CancelKeyMismatch then.
+var ErrQRCodeMismatch = errors.New("keys of the QR code do not match")
+
+// QRVerificationData is the payload of a verification QR code. Keys are
+// unpadded base64 ed25519 keys like those of Account.IdentityKeys.
+type QRVerificationData struct {
+	Mode          QRVerificationMode
+	TransactionID string
+	FirstKey      string
+	SecondKey     string
+	SharedSecret  []byte
+}
+
+// NewQRVerificationData creates the payload of a QR code with a new random
+// shared secret.
+func NewQRVerificationData(mode QRVerificationMode, transactionID, firstKey, secondKey string) (*QRVerificationData, error) {
+	if mode > QRModeSelfUntrusted {
+		return nil, fmt.Errorf("unknown QR code mode %d", mode)
+	}
+	if transactionID == "" || firstKey == "" || secondKey == "" {
+		return nil, errors.New("transactionID and keys must not be empty")
+	}
+
+	secret := make([]byte, qrVerificationSecret)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &QRVerificationData{
+		Mode:          mode,
+		TransactionID: transactionID,
+		FirstKey:      firstKey,
+		SecondKey:     secondKey,
+		SharedSecret:  secret,
+	}, nil
+}
+
+// NewQRCodeForUser creates the QR code shown to another user, whose master
+// key we believe to be theirMasterKey.
+func NewQRCodeForUser(transactionID, ourMasterKey, theirMasterKey string) (*QRVerificationData, error) {
+	return NewQRVerificationData(QRModeCrossUser, transactionID, ourMasterKey, theirMasterKey)
+}
+
+// NewQRCodeForOwnDevice creates the QR code shown to another device of our
+// own user by a device that trusts the master key.
+func NewQRCodeForOwnDevice(transactionID, masterKey string, theirDevice *DeviceKeys) (*QRVerificationData, error) {
+	if theirDevice == nil {
+		return nil, errors.New("theirDevice must not be nil")
+	}
+	return NewQRVerificationData(QRModeSelfTrusted, transactionID, masterKey, theirDevice.ED25519())
+}
+
+// NewQRCodeForMasterKey creates the QR code shown by a device that does
+// not trust the master key of its user yet.
+func NewQRCodeForMasterKey(transactionID string, account *Account, masterKey string) (*QRVerificationData, error) {
+	return NewQRVerificationData(QRModeSelfUntrusted, transactionID, account.IdentityKeys().ED25519, masterKey)
+}
+
+// Encode returns the binary payload to put into the QR code: "MATRIX", the
+// version, the mode, the length of the transaction ID as big endian uint16,
+// the transaction ID, both keys and the shared secret.
+func (d *QRVerificationData) Encode() ([]byte, error) {
+	if len(d.TransactionID) > 0xFFFF {
+		return nil, errors.New("transaction ID is too long")
+	}
+	if len(d.SharedSecret) < qrVerificationMinSecret {
+		return nil, errors.New("shared secret is too short")
+	}
+	firstKey, err := decodeQRVerificationKey(d.FirstKey)
+	if err != nil {
+		return nil, err
+	}
+	secondKey, err := decodeQRVerificationKey(d.SecondKey)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(qrVerificationPrefix)
+	buf.WriteByte(qrVerificationVersion)
+	buf.WriteByte(byte(d.Mode))
+	binary.Write(buf, binary.BigEndian, uint16(len(d.TransactionID)))
+	buf.WriteString(d.TransactionID)
+	buf.Write(firstKey)
+	buf.Write(secondKey)
+	buf.Write(d.SharedSecret)
+
+	return buf.Bytes(), nil
+}
+
+// ParseQRVerificationData parses the binary payload of a QR code.
+func ParseQRVerificationData(data []byte) (*QRVerificationData, error) {
+	header := len(qrVerificationPrefix) + 4
+	if len(data) < header || string(data[:len(qrVerificationPrefix)]) != qrVerificationPrefix {
+		return nil, errors.New("data is no verification QR code")
+	}
+	if version := data[len(qrVerificationPrefix)]; version != qrVerificationVersion {
+		return nil, fmt.Errorf("unsupported QR code version %d", version)
+	}
+
+	mode := QRVerificationMode(data[len(qrVerificationPrefix)+1])
+	if mode > QRModeSelfUntrusted {
+		return nil, fmt.Errorf("unknown QR code mode %d", mode)
+	}
+
+	idLength := int(binary.BigEndian.Uint16(data[header-2 : header]))
+	rest := data[header:]
+	if len(rest) < idLength+2*qrVerificationKey+qrVerificationMinSecret {
+		return nil, errors.New("QR code is too short")
+	}
+
+	return &QRVerificationData{
+		Mode:          mode,
+		TransactionID: string(rest[:idLength]),
+		FirstKey:      base64.RawStdEncoding.EncodeToString(rest[idLength : idLength+qrVerificationKey]),
+		SecondKey:     base64.RawStdEncoding.EncodeToString(rest[idLength+qrVerificationKey : idLength+2*qrVerificationKey]),
+		SharedSecret:  append([]byte(nil), rest[idLength+2*qrVerificationKey:]...),
+	}, nil
+}
+
+func decodeQRVerificationKey(key string) ([]byte, error) {
+	decoded, err := base64.RawStdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != qrVerificationKey {
+		return nil, fmt.Errorf("key must be %d bytes long", qrVerificationKey)
+	}
+	return decoded, nil
+}
+
+// QRVerificationResult is what a QR code verification proved.
+type QRVerificationResult struct {
+	// UserID and MasterKey are set if the master key of the user was
+	// verified.
+	UserID    string
+	MasterKey string
+	// Device is set if the device was verified.
+	Device *DeviceKeys
+}
+
+// Apply records the result in the trust. Signing the verified keys with
+// our cross-signing keys is left to the caller.
+func (r *QRVerificationResult) Apply(trust *CrossSigningTrust) error {
+	if r.MasterKey != "" {
+		err := trust.MarkMasterKeyVerified(r.UserID, r.MasterKey)
+		if err != nil {
+			return err
+		}
+	}
+	if r.Device != nil {
+		return trust.MarkDeviceVerified(r.Device)
+	}
+	return nil
+}
+
+// QRVerifier holds the keys a QR code is checked against.
+type QRVerifier struct {
+	Account  *Account
+	UserID   string
+	DeviceID string
+	// MasterKey is the master key of our own user as we know it.
+	MasterKey string
+	// TheirDevice is the device showing or scanning the code.
+	TheirDevice *DeviceKeys
+	// TheirMasterKey is the master key of the other user as we know it.
+	// It is only needed for QRModeCrossUser.
+	TheirMasterKey string
+}
+
+// Scanned checks a QR code scanned from the other device. If it matches,
+// the result is returned along with the start event to send to the other
+// device; otherwise ErrQRCodeMismatch is returned.
+//
+// Scanning QRModeCrossUser verifies the master key of the other user,
+// QRModeSelfTrusted our own master key and QRModeSelfUntrusted the other
+// device.
+func (q *QRVerifier) Scanned(code *QRVerificationData) (*QRVerificationResult, *VerificationEvent, error) {
+	if code == nil {
+		return nil, nil, errors.New("code must not be nil")
+	}
+
+	var result *QRVerificationResult
+	switch code.Mode {
+	case QRModeCrossUser:
+		if q.TheirMasterKey == "" || code.FirstKey != q.TheirMasterKey || code.SecondKey != q.MasterKey {
+			return nil, nil, ErrQRCodeMismatch
+		}
+		result = &QRVerificationResult{UserID: q.TheirDevice.UserID, MasterKey: q.TheirMasterKey}
+	case QRModeSelfTrusted:
+		if code.FirstKey != q.MasterKey || code.SecondKey != q.Account.IdentityKeys().ED25519 {
+			return nil, nil, ErrQRCodeMismatch
+		}
+		result = &QRVerificationResult{UserID: q.UserID, MasterKey: q.MasterKey}
+	case QRModeSelfUntrusted:
+		if code.FirstKey != q.TheirDevice.ED25519() || code.SecondKey != q.MasterKey {
+			return nil, nil, ErrQRCodeMismatch
+		}
+		result = &QRVerificationResult{Device: q.TheirDevice}
+	default:
+		return nil, nil, fmt.Errorf("unknown QR code mode %d", code.Mode)
+	}
+
+	start := &VerificationEvent{
+		Type: EventTypeVerificationStart,
+		Content: &VerificationStart{
+			FromDevice:    q.DeviceID,
+			Method:        VerificationMethodReciprocate,
+			TransactionID: code.TransactionID,
+			Secret:        base64.RawStdEncoding.EncodeToString(code.SharedSecret),
+		},
+	}
+	return result, start, nil
+}
+
+// Reciprocated checks the start event the other device sent after
+// scanning our QR code. If it carries the shared secret, the result is
+// returned; the keys in the code were confirmed by the other device.
+//
+// Showing QRModeCrossUser verifies the master key of the other user,
+// QRModeSelfTrusted the other device and QRModeSelfUntrusted our own master
+// key.
+func (q *QRVerifier) Reciprocated(code *QRVerificationData, start *VerificationStart) (*QRVerificationResult, error) {
+	if code == nil || start == nil {
+		return nil, errors.New("code and start must not be nil")
+	}
+	if start.Method != VerificationMethodReciprocate || start.TransactionID != code.TransactionID {
+		return nil, errors.New("start does not reciprocate the QR code")
+	}
+
+	secret, err := base64.RawStdEncoding.DecodeString(start.Secret)
+	if err != nil || !hmac.Equal(secret, code.SharedSecret) {
+		return nil, ErrQRCodeMismatch
+	}
+
+	switch code.Mode {
+	case QRModeCrossUser:
+		return &QRVerificationResult{UserID: q.TheirDevice.UserID, MasterKey: code.SecondKey}, nil
+	case QRModeSelfTrusted:
+		if code.SecondKey != q.TheirDevice.ED25519() {
+			return nil, ErrQRCodeMismatch
+		}
+		return &QRVerificationResult{Device: q.TheirDevice}, nil
+	case QRModeSelfUntrusted:
+		return &QRVerificationResult{UserID: q.UserID, MasterKey: code.SecondKey}, nil
+	}
+	return nil, fmt.Errorf("unknown QR code mode %d", code.Mode)
+}
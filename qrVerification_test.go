@@ -0,0 +1,239 @@
+package golm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// createQRVerificationKey returns an unpadded base64 key of 32 times b.
+func createQRVerificationKey(b byte) string {
+	return base64.RawStdEncoding.EncodeToString(bytes.Repeat([]byte{b}, qrVerificationKey))
+}
+
+func TestQRVerificationData(t *testing.T) {
+	Convey("QR verification data", t, func() {
+		code := &QRVerificationData{
+			Mode:          QRModeSelfTrusted,
+			TransactionID: "txn",
+			FirstKey:      createQRVerificationKey(1),
+			SecondKey:     createQRVerificationKey(2),
+			SharedSecret:  []byte("12345678"),
+		}
+
+		Convey("should be encoded in the binary format.", func() {
+			encoded, err := code.Encode()
+			So(err, ShouldBeNil)
+
+			expected := []byte("MATRIX\x02\x01\x00\x03txn")
+			expected = append(expected, bytes.Repeat([]byte{1}, 32)...)
+			expected = append(expected, bytes.Repeat([]byte{2}, 32)...)
+			expected = append(expected, "12345678"...)
+			So(encoded, ShouldResemble, expected)
+		})
+		Convey("should be parsed again.", func() {
+			encoded, _ := code.Encode()
+			parsed, err := ParseQRVerificationData(encoded)
+			So(err, ShouldBeNil)
+			So(parsed, ShouldResemble, code)
+		})
+		Convey("should not be encoded with invalid keys.", func() {
+			code.FirstKey = "key"
+			_, err := code.Encode()
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not be encoded with a short secret.", func() {
+			code.SharedSecret = []byte("1234")
+			_, err := code.Encode()
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("New QR verification data", t, func() {
+		Convey("should get a random secret.", func() {
+			code, err := NewQRCodeForUser("txn", createQRVerificationKey(1), createQRVerificationKey(2))
+			So(err, ShouldBeNil)
+			So(code.Mode, ShouldEqual, QRModeCrossUser)
+			So(code.SharedSecret, ShouldHaveLength, qrVerificationSecret)
+
+			other, _ := NewQRCodeForUser("txn", createQRVerificationKey(1), createQRVerificationKey(2))
+			So(other.SharedSecret, ShouldNotResemble, code.SharedSecret)
+		})
+		Convey("should fail for an unknown mode.", func() {
+			_, err := NewQRVerificationData(QRVerificationMode(3), "txn", createQRVerificationKey(1), createQRVerificationKey(2))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail without a transaction ID.", func() {
+			_, err := NewQRVerificationData(QRModeCrossUser, "", createQRVerificationKey(1), createQRVerificationKey(2))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseQRVerificationData(t *testing.T) {
+	Convey("Parsing QR verification data", t, func() {
+		code := &QRVerificationData{
+			Mode:          QRModeCrossUser,
+			TransactionID: "txn",
+			FirstKey:      createQRVerificationKey(1),
+			SecondKey:     createQRVerificationKey(2),
+			SharedSecret:  []byte("12345678"),
+		}
+		encoded, _ := code.Encode()
+
+		Convey("should fail for other data.", func() {
+			_, err := ParseQRVerificationData([]byte("https://example.org"))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail for other versions.", func() {
+			encoded[6] = 0x01
+			_, err := ParseQRVerificationData(encoded)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail for unknown modes.", func() {
+			encoded[7] = 0x03
+			_, err := ParseQRVerificationData(encoded)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail if the data is too short.", func() {
+			_, err := ParseQRVerificationData(encoded[:len(encoded)-1])
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// createQRVerifiers creates the verifiers of two devices of @alice, where
+// only the first one trusts the master key, and of a device of @bob. The
+// cross-signing keys of @alice are returned, too.
+func createQRVerifiers() (*QRVerifier, *QRVerifier, *QRVerifier, *testCrossSigningUser) {
+	alice := createCrossSigningUser("@alice:example.org", "ALICE")
+	bob := createCrossSigningUser("@bob:example.org", "BOB")
+	newAccount, _ := NewAccount()
+	newDevice, _ := NewDeviceKeys(newAccount, "@alice:example.org", "ALICE2")
+
+	trusted := &QRVerifier{
+		Account:        alice.account,
+		UserID:         "@alice:example.org",
+		DeviceID:       "ALICE",
+		MasterKey:      alice.public.Master.PublicKey(),
+		TheirDevice:    newDevice,
+		TheirMasterKey: bob.public.Master.PublicKey(),
+	}
+	untrusted := &QRVerifier{
+		Account:     newAccount,
+		UserID:      "@alice:example.org",
+		DeviceID:    "ALICE2",
+		MasterKey:   alice.public.Master.PublicKey(),
+		TheirDevice: alice.device,
+	}
+	other := &QRVerifier{
+		Account:        bob.account,
+		UserID:         "@bob:example.org",
+		DeviceID:       "BOB",
+		MasterKey:      bob.public.Master.PublicKey(),
+		TheirDevice:    alice.device,
+		TheirMasterKey: alice.public.Master.PublicKey(),
+	}
+	return trusted, untrusted, other, alice
+}
+
+// scanQRCode transmits the code and the start event like a camera and a
+// transport would.
+func scanQRCode(shower, scanner *QRVerifier, code *QRVerificationData) (*QRVerificationResult, *QRVerificationResult) {
+	encoded, err := code.Encode()
+	So(err, ShouldBeNil)
+	scanned, err := ParseQRVerificationData(encoded)
+	So(err, ShouldBeNil)
+
+	scannerResult, start, err := scanner.Scanned(scanned)
+	So(err, ShouldBeNil)
+	So(start.Type, ShouldEqual, EventTypeVerificationStart)
+	So(start.Content.(*VerificationStart).FromDevice, ShouldEqual, scanner.DeviceID)
+
+	showerResult, err := shower.Reciprocated(code, transmit(start).Content.(*VerificationStart))
+	So(err, ShouldBeNil)
+	return showerResult, scannerResult
+}
+
+func TestQRVerifier(t *testing.T) {
+	Convey("A QR code verification", t, func() {
+		trusted, untrusted, other, alice := createQRVerifiers()
+
+		Convey("with another user should verify both master keys.", func() {
+			bobDevice, _ := NewDeviceKeys(other.Account, "@bob:example.org", "BOB")
+			trusted.TheirDevice = bobDevice
+
+			code, _ := NewQRCodeForUser("txn", other.MasterKey, other.TheirMasterKey)
+			showerResult, scannerResult := scanQRCode(other, trusted, code)
+
+			So(showerResult.UserID, ShouldEqual, "@alice:example.org")
+			So(showerResult.MasterKey, ShouldEqual, trusted.MasterKey)
+			So(scannerResult.UserID, ShouldEqual, "@bob:example.org")
+			So(scannerResult.MasterKey, ShouldEqual, other.MasterKey)
+			So(scannerResult.Device, ShouldBeNil)
+		})
+		Convey("shown by a trusted device should verify the new device and the master key.", func() {
+			code, _ := NewQRCodeForOwnDevice("txn", trusted.MasterKey, trusted.TheirDevice)
+			showerResult, scannerResult := scanQRCode(trusted, untrusted, code)
+
+			So(showerResult.Device, ShouldEqual, trusted.TheirDevice)
+			So(showerResult.MasterKey, ShouldBeEmpty)
+			So(scannerResult.MasterKey, ShouldEqual, untrusted.MasterKey)
+			So(scannerResult.Device, ShouldBeNil)
+		})
+		Convey("shown by a new device should verify the new device and the master key.", func() {
+			code, _ := NewQRCodeForMasterKey("txn", untrusted.Account, untrusted.MasterKey)
+			showerResult, scannerResult := scanQRCode(untrusted, trusted, code)
+
+			So(showerResult.MasterKey, ShouldEqual, untrusted.MasterKey)
+			So(showerResult.Device, ShouldBeNil)
+			So(scannerResult.Device, ShouldEqual, trusted.TheirDevice)
+			So(scannerResult.MasterKey, ShouldBeEmpty)
+		})
+		Convey("should fail if the scanned keys are not the keys we know.", func() {
+			code, _ := NewQRCodeForUser("txn", other.MasterKey, createQRVerificationKey(1))
+			_, _, err := trusted.Scanned(code)
+			So(err, ShouldEqual, ErrQRCodeMismatch)
+
+			code, _ = NewQRCodeForOwnDevice("txn", trusted.MasterKey, other.TheirDevice)
+			_, _, err = untrusted.Scanned(code)
+			So(err, ShouldEqual, ErrQRCodeMismatch)
+
+			code, _ = NewQRCodeForMasterKey("txn", other.Account, untrusted.MasterKey)
+			_, _, err = trusted.Scanned(code)
+			So(err, ShouldEqual, ErrQRCodeMismatch)
+		})
+		Convey("should fail if the start event has the wrong secret.", func() {
+			code, _ := NewQRCodeForOwnDevice("txn", trusted.MasterKey, trusted.TheirDevice)
+			_, start, _ := untrusted.Scanned(code)
+			start.Content.(*VerificationStart).Secret = base64.RawStdEncoding.EncodeToString([]byte("12345678"))
+
+			_, err := trusted.Reciprocated(code, start.Content.(*VerificationStart))
+			So(err, ShouldEqual, ErrQRCodeMismatch)
+		})
+		Convey("should fail if the start event is not for the code.", func() {
+			code, _ := NewQRCodeForOwnDevice("txn", trusted.MasterKey, trusted.TheirDevice)
+			_, start, _ := untrusted.Scanned(code)
+			start.Content.(*VerificationStart).TransactionID = "other"
+
+			_, err := trusted.Reciprocated(code, start.Content.(*VerificationStart))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be applied to the trust.", func() {
+			alice.keys.SignDevice(alice.device)
+			trust := NewCrossSigningTrust(trusted.TheirDevice)
+			trust.AddDevice(alice.device)
+			So(trust.AddKeys(alice.public), ShouldBeNil)
+			So(trust.UserTrusted("@alice:example.org"), ShouldBeFalse)
+			So(trust.DeviceTrust("@alice:example.org", "ALICE"), ShouldEqual, TrustCrossSigned)
+
+			code, _ := NewQRCodeForOwnDevice("txn", trusted.MasterKey, trusted.TheirDevice)
+			_, result := scanQRCode(trusted, untrusted, code)
+			So(result.Apply(trust), ShouldBeNil)
+
+			So(trust.UserTrusted("@alice:example.org"), ShouldBeTrue)
+			So(trust.DeviceTrust("@alice:example.org", "ALICE"), ShouldEqual, TrustVerified)
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package golm
+
+import "crypto/rand"
+
+const (
+	randomIDLength = 32
+	randomIDChars  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// randomID returns a random alphanumeric ID, e.g. a transaction ID.
+// Random bytes beyond the last multiple of the number of characters are
+// skipped, so every character is equally likely.
+func randomID() (string, error) {
+	const limit = 256 - 256%len(randomIDChars)
+
+	id := make([]byte, 0, randomIDLength)
+	random := make([]byte, randomIDLength)
+	for len(id) < randomIDLength {
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+		for _, b := range random {
+			if int(b) >= limit {
+				continue
+			}
+			id = append(id, randomIDChars[int(b)%len(randomIDChars)])
+			if len(id) == randomIDLength {
+				break
+			}
+		}
+	}
+	return string(id), nil
+}
@@ -0,0 +1,30 @@
+package golm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRandomID(t *testing.T) {
+	Convey("Random IDs should be alphanumeric and differ.", t, func() {
+		id, err := randomID()
+		So(err, ShouldBeNil)
+		So(id, ShouldHaveLength, randomIDLength)
+		So(strings.Trim(id, randomIDChars), ShouldBeEmpty)
+
+		other, _ := randomID()
+		So(other, ShouldNotEqual, id)
+	})
+	Convey("Random IDs should skip bytes that would bias them.", t, func() {
+		random := append(bytes.Repeat([]byte{255}, randomIDLength), bytes.Repeat([]byte{1}, randomIDLength)...)
+		sw := switchRandSource(bytes.NewReader(random))
+		id, err := randomID()
+		sw.Revert()
+
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, strings.Repeat("b", randomIDLength))
+	})
+}
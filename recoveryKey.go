@@ -0,0 +1,154 @@
+package golm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// RecoveryKeyLength is the length of the private key encoded in a recovery
+// key.
+const RecoveryKeyLength = 32
+
+var recoveryKeyPrefix = []byte{0x8B, 0x01}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	// ErrRecoveryKeyPrefix is returned if a recovery key does not start with
+	// the recovery key prefix.
+	ErrRecoveryKeyPrefix = errors.New("recovery key has an invalid prefix")
+	// ErrRecoveryKeyLength is returned if a recovery key is too short or too
+	// long.
+	ErrRecoveryKeyLength = errors.New("recovery key has an invalid length")
+	// ErrRecoveryKeyParity is returned if the parity byte of a recovery key
+	// does not match, which usually means that it was mistyped.
+	ErrRecoveryKeyParity = errors.New("recovery key has an invalid parity")
+)
+
+// EncodeRecoveryKey encodes the private key as a recovery key to be shown to
+// the user. The key is encoded in base58 with a prefix and a parity byte
+// and split into blocks of four characters.
+func EncodeRecoveryKey(privateKey []byte) (string, error) {
+	if len(privateKey) != RecoveryKeyLength {
+		return "", fmt.Errorf("privateKey must be %d bytes long", RecoveryKeyLength)
+	}
+
+	data := make([]byte, 0, len(recoveryKeyPrefix)+len(privateKey)+1)
+	data = append(data, recoveryKeyPrefix...)
+	data = append(data, privateKey...)
+	data = append(data, recoveryKeyParity(data))
+
+	encoded := encodeBase58(data)
+	blocks := make([]string, 0, (len(encoded)+3)/4)
+	for len(encoded) > 4 {
+		blocks = append(blocks, encoded[:4])
+		encoded = encoded[4:]
+	}
+	blocks = append(blocks, encoded)
+
+	return strings.Join(blocks, " "), nil
+}
+
+// DecodeRecoveryKey decodes a recovery key and returns the private key.
+// Whitespace is ignored.
+func DecodeRecoveryKey(recoveryKey string) ([]byte, error) {
+	compact := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, recoveryKey)
+	if compact == "" {
+		return nil, errors.New("recoveryKey must not be empty")
+	}
+
+	data, err := decodeBase58(compact)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != len(recoveryKeyPrefix)+RecoveryKeyLength+1 {
+		return nil, ErrRecoveryKeyLength
+	}
+	for i, b := range recoveryKeyPrefix {
+		if data[i] != b {
+			return nil, ErrRecoveryKeyPrefix
+		}
+	}
+	if recoveryKeyParity(data) != 0 {
+		return nil, ErrRecoveryKeyParity
+	}
+
+	return data[len(recoveryKeyPrefix) : len(data)-1], nil
+}
+
+// NewPkDecryptionFromRecoveryKey creates a PkDecryption from the private
+// key encoded in the recovery key.
+func NewPkDecryptionFromRecoveryKey(recoveryKey string) (*PkDecryption, error) {
+	privateKey, err := DecodeRecoveryKey(recoveryKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewPkDecryptionFromPrivateKey(privateKey)
+}
+
+// RecoveryKey returns the private key encoded as a recovery key.
+func (d *PkDecryption) RecoveryKey() string {
+	recoveryKey, err := EncodeRecoveryKey(d.PrivateKey())
+	panicOnError(err)
+	return recoveryKey
+}
+
+func recoveryKeyParity(data []byte) byte {
+	var parity byte
+	for _, b := range data {
+		parity ^= b
+	}
+	return parity
+}
+
+func encodeBase58(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	mod := new(big.Int)
+
+	var encoded []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+func decodeBase58(encoded string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+
+	for _, r := range encoded {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, fmt.Errorf("recovery key contains the invalid character %q", r)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	var zeros int
+	for zeros < len(encoded) && encoded[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
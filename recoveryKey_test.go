@@ -0,0 +1,93 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createSequentialKey() []byte {
+	key := make([]byte, RecoveryKeyLength)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func TestEncodeRecoveryKey(t *testing.T) {
+	Convey("Encoding a recovery key should match known vectors.", t, func() {
+		encoded, err := EncodeRecoveryKey(createSequentialKey())
+		So(err, ShouldBeNil)
+		So(encoded, ShouldEqual, "EsSz ykH7 LCZx 7Cae cmKD wcmY JRXi Ybtu 8iQ3 t8Ez nRwK pUY1")
+
+		encoded, err = EncodeRecoveryKey(make([]byte, RecoveryKeyLength))
+		So(err, ShouldBeNil)
+		So(encoded, ShouldEqual, "EsSz ygLv VP1b xF1C v7kE eBQx MxDP buG5 w25T L3b6 hfyG Kkrd")
+	})
+	Convey("Encoding a key of the wrong length should not work.", t, func() {
+		_, err := EncodeRecoveryKey([]byte{1, 2, 3})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestDecodeRecoveryKey(t *testing.T) {
+	Convey("Decoding a recovery key", t, func() {
+		Convey("should return the private key.", func() {
+			key, err := DecodeRecoveryKey("EsSz ykH7 LCZx 7Cae cmKD wcmY JRXi Ybtu 8iQ3 t8Ez nRwK pUY1")
+			So(err, ShouldBeNil)
+			So(key, ShouldResemble, createSequentialKey())
+		})
+		Convey("should ignore whitespace.", func() {
+			key, err := DecodeRecoveryKey(" EsSzygLvVP1b\nxF1C v7kE\teBQx MxDP buG5 w25T L3b6 hfyG Kkrd ")
+			So(err, ShouldBeNil)
+			So(key, ShouldResemble, make([]byte, RecoveryKeyLength))
+		})
+		Convey("should detect typos.", func() {
+			_, err := DecodeRecoveryKey("EsSz ykH7 LCZx 7Cae cmKD wcmY JRXi Ybtu 8iQ3 t8Ez nRwK pUY2")
+			So(err, ShouldEqual, ErrRecoveryKeyParity)
+		})
+		Convey("should reject invalid characters.", func() {
+			_, err := DecodeRecoveryKey("EsSz ykH7 LCZx 7Cae cmKD wcmY JRXi Ybtu 8iQ3 t8Ez nRwK pUY0")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "'0'")
+		})
+		Convey("should reject keys of the wrong length.", func() {
+			_, err := DecodeRecoveryKey("EsSz ykH7 LCZx 7Cae cmKD wcmY JRXi Ybtu 8iQ3 t8Ez nRwK")
+			So(err, ShouldEqual, ErrRecoveryKeyLength)
+		})
+		Convey("should reject keys with the wrong prefix.", func() {
+			data := append([]byte{0x8B, 0x02}, createSequentialKey()...)
+			data = append(data, recoveryKeyParity(data))
+			_, err := DecodeRecoveryKey(encodeBase58(data))
+			So(err, ShouldEqual, ErrRecoveryKeyPrefix)
+		})
+		Convey("should reject empty keys.", func() {
+			_, err := DecodeRecoveryKey("  ")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBase58(t *testing.T) {
+	Convey("Base58 should keep leading zeros.", t, func() {
+		encoded := encodeBase58([]byte{0, 0, 1, 2})
+		So(encoded, ShouldStartWith, "11")
+
+		decoded, err := decodeBase58(encoded)
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, []byte{0, 0, 1, 2})
+	})
+}
+
+func TestPkDecryptionRecoveryKey(t *testing.T) {
+	Convey("A PkDecryption restored from its recovery key should have the same key.", t, func() {
+		d, _ := NewPkDecryption()
+		restored, err := NewPkDecryptionFromRecoveryKey(d.RecoveryKey())
+		So(err, ShouldBeNil)
+		So(restored.PublicKey(), ShouldEqual, d.PublicKey())
+	})
+	Convey("A PkDecryption should not be created from an invalid recovery key.", t, func() {
+		_, err := NewPkDecryptionFromRecoveryKey("EsSz")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,133 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// EventTypeForwardedRoomKey is the type of the to-device event forwarding
+// the key of a Megolm session created by another device.
+const EventTypeForwardedRoomKey = "m.forwarded_room_key"
+
+// ForwardedRoomKeyContent is the content of an m.forwarded_room_key event.
+type ForwardedRoomKeyContent struct {
+	Algorithm string `json:"algorithm"`
+	RoomID    string `json:"room_id"`
+	// SenderKey is the Curve25519 identity key of the device that created
+	// the session.
+	SenderKey  string `json:"sender_key"`
+	SessionID  string `json:"session_id"`
+	SessionKey string `json:"session_key"`
+	// SenderClaimedED25519Key is the ed25519 key the device that created
+	// the session claims to own.
+	SenderClaimedED25519Key string `json:"sender_claimed_ed25519_key"`
+	// ForwardingCurve25519KeyChain holds the Curve25519 identity keys of
+	// the devices that forwarded the session before the sender.
+	ForwardingCurve25519KeyChain []string `json:"forwarding_curve25519_key_chain"`
+}
+
+// InboundGroupSessionFromRoomKey creates an inbound group session from a
+// decrypted m.room_key event. senderKey is the Curve25519 identity key of
+// the device that sent the Olm encrypted event, as proven by the session
+// that decrypted it.
+func InboundGroupSessionFromRoomKey(senderKey string, payload *OlmPayload) (*InboundGroupSessionEntry, error) {
+	if senderKey == "" {
+		return nil, errors.New("senderKey must not be empty")
+	}
+	if payload == nil {
+		return nil, errors.New("payload must not be nil")
+	}
+	if payload.Type != EventTypeRoomKey {
+		return nil, fmt.Errorf("unexpected event type %q", payload.Type)
+	}
+
+	content := &RoomKeyContent{}
+	err := json.Unmarshal(payload.Content, content)
+	if err != nil {
+		return nil, err
+	}
+	if content.Algorithm != AlgorithmMegolmV1 {
+		return nil, fmt.Errorf("unexpected algorithm %q", content.Algorithm)
+	}
+	if content.RoomID == "" {
+		return nil, errors.New("room ID must not be empty")
+	}
+
+	sess, err := NewInboundGroupSession(content.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+	err = checkGroupSessionID(sess, content.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InboundGroupSessionEntry{
+		Session:    sess,
+		RoomID:     content.RoomID,
+		SenderKey:  senderKey,
+		SigningKey: payload.SenderED25519(),
+	}, nil
+}
+
+// InboundGroupSessionFromForwardedRoomKey creates an inbound group session
+// from a decrypted m.forwarded_room_key event. senderKey is the Curve25519
+// identity key of the device that forwarded the key, as proven by the
+// session that decrypted the event. It is appended to the forwarding chain.
+//
+// The keys of the creating device are only claimed by the forwarding
+// device; only forward requests to trusted devices should be accepted.
+func InboundGroupSessionFromForwardedRoomKey(senderKey string, payload *OlmPayload) (*InboundGroupSessionEntry, error) {
+	if senderKey == "" {
+		return nil, errors.New("senderKey must not be empty")
+	}
+	if payload == nil {
+		return nil, errors.New("payload must not be nil")
+	}
+	if payload.Type != EventTypeForwardedRoomKey {
+		return nil, fmt.Errorf("unexpected event type %q", payload.Type)
+	}
+
+	content := &ForwardedRoomKeyContent{}
+	err := json.Unmarshal(payload.Content, content)
+	if err != nil {
+		return nil, err
+	}
+	if content.Algorithm != AlgorithmMegolmV1 {
+		return nil, fmt.Errorf("unexpected algorithm %q", content.Algorithm)
+	}
+	if content.RoomID == "" || content.SenderKey == "" {
+		return nil, errors.New("room ID and sender key must not be empty")
+	}
+
+	sess, err := ImportInboundGroupSession(content.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+	err = checkGroupSessionID(sess, content.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([]string, 0, len(content.ForwardingCurve25519KeyChain)+1)
+	chain = append(chain, content.ForwardingCurve25519KeyChain...)
+	chain = append(chain, senderKey)
+
+	return &InboundGroupSessionEntry{
+		Session:         sess,
+		RoomID:          content.RoomID,
+		SenderKey:       content.SenderKey,
+		SigningKey:      content.SenderClaimedED25519Key,
+		ForwardingChain: chain,
+	}, nil
+}
+
+func checkGroupSessionID(sess *InboundGroupSession, sessionID string) error {
+	id := sess.ID()
+	if id != sessionID {
+		sess.Clear()
+		return fmt.Errorf("session key belongs to session %s, not %s", id, sessionID)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createRoomKeyPayload(eventType string, content interface{}) *OlmPayload {
+	contentJSON, _ := json.Marshal(content)
+	return &OlmPayload{
+		Type:    eventType,
+		Content: contentJSON,
+		Keys:    map[string]string{KeyAlgorithmED25519: "signing key"},
+	}
+}
+
+func TestInboundGroupSessionFromRoomKey(t *testing.T) {
+	const room = "!room:example.org"
+
+	Convey("An m.room_key event", t, func() {
+		out, _ := NewOutboundGroupSession()
+		content := &RoomKeyContent{
+			Algorithm:  AlgorithmMegolmV1,
+			RoomID:     room,
+			SessionID:  out.ID(),
+			SessionKey: out.Key(),
+		}
+
+		Convey("should create the session.", func() {
+			entry, err := InboundGroupSessionFromRoomKey("sender", createRoomKeyPayload(EventTypeRoomKey, content))
+			So(err, ShouldBeNil)
+			So(entry.Session.ID(), ShouldEqual, out.ID())
+			So(entry.RoomID, ShouldEqual, room)
+			So(entry.SenderKey, ShouldEqual, "sender")
+			So(entry.SigningKey, ShouldEqual, "signing key")
+			So(entry.Forwarded(), ShouldBeFalse)
+		})
+		Convey("should be rejected with another session ID.", func() {
+			other, _ := NewOutboundGroupSession()
+			content.SessionID = other.ID()
+			_, err := InboundGroupSessionFromRoomKey("sender", createRoomKeyPayload(EventTypeRoomKey, content))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected with another algorithm.", func() {
+			content.Algorithm = AlgorithmOlmV1
+			_, err := InboundGroupSessionFromRoomKey("sender", createRoomKeyPayload(EventTypeRoomKey, content))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected with another event type.", func() {
+			_, err := InboundGroupSessionFromRoomKey("sender", createRoomKeyPayload(EventTypeForwardedRoomKey, content))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestInboundGroupSessionFromForwardedRoomKey(t *testing.T) {
+	const room = "!room:example.org"
+
+	Convey("An m.forwarded_room_key event", t, func() {
+		acc, _ := NewAccount()
+		out, in := createOutAndInboundGroupSession()
+		exported, _ := in.Export(0)
+		content := &ForwardedRoomKeyContent{
+			Algorithm:                    AlgorithmMegolmV1,
+			RoomID:                       room,
+			SenderKey:                    acc.IdentityKeys().Curve25519,
+			SessionID:                    in.ID(),
+			SessionKey:                   exported,
+			SenderClaimedED25519Key:      acc.IdentityKeys().ED25519,
+			ForwardingCurve25519KeyChain: []string{"first forwarder"},
+		}
+
+		entry, err := InboundGroupSessionFromForwardedRoomKey("second forwarder", createRoomKeyPayload(EventTypeForwardedRoomKey, content))
+		So(err, ShouldBeNil)
+
+		Convey("should create the session.", func() {
+			So(entry.Session.ID(), ShouldEqual, in.ID())
+			So(entry.RoomID, ShouldEqual, room)
+			So(entry.SenderKey, ShouldEqual, acc.IdentityKeys().Curve25519)
+			So(entry.SigningKey, ShouldEqual, acc.IdentityKeys().ED25519)
+		})
+		Convey("should extend the forwarding chain.", func() {
+			So(entry.ForwardingChain, ShouldResemble, []string{"first forwarder", "second forwarder"})
+			So(entry.Forwarded(), ShouldBeTrue)
+		})
+		Convey("should mark decrypted events as forwarded.", func() {
+			event, _ := EncryptMegolmEvent(acc, "DEVICE", out, room, "m.room.message", map[string]string{"body": "hi"})
+			result, err := DecryptMegolmEvent(entry, room, event)
+			So(err, ShouldBeNil)
+			So(result.Forwarded, ShouldBeTrue)
+			So(result.SigningKey, ShouldEqual, acc.IdentityKeys().ED25519)
+		})
+		Convey("should be rejected with another session ID.", func() {
+			content.SessionID = "other"
+			_, err := InboundGroupSessionFromForwardedRoomKey("forwarder", createRoomKeyPayload(EventTypeForwardedRoomKey, content))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be rejected without a sender key.", func() {
+			content.SenderKey = ""
+			_, err := InboundGroupSessionFromForwardedRoomKey("forwarder", createRoomKeyPayload(EventTypeForwardedRoomKey, content))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
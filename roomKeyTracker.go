@@ -0,0 +1,223 @@
+package golm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// EventTypeRoomKey is the type of the to-device event sharing the key of a
+// Megolm session.
+const EventTypeRoomKey = "m.room_key"
+
+// RoomKeyShare records that the key of an outbound group session was sent
+// to a device.
+type RoomKeyShare struct {
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	// IdentityKey is the Curve25519 identity key of the device.
+	IdentityKey string `json:"identity_key"`
+	// MessageIndex is the first message index the device can decrypt.
+	MessageIndex uint32 `json:"message_index"`
+}
+
+func (s *RoomKeyShare) matches(device *DeviceKeys) bool {
+	return s.UserID == device.UserID && s.DeviceID == device.DeviceID && s.IdentityKey == device.Curve25519()
+}
+
+// RoomKeyContent is the content of an m.room_key event.
+type RoomKeyContent struct {
+	Algorithm  string `json:"algorithm"`
+	RoomID     string `json:"room_id"`
+	SessionID  string `json:"session_id"`
+	SessionKey string `json:"session_key"`
+}
+
+// RoomKeyPayload is an m.room_key event for a single device, ready to be
+// encrypted with SessionManager.EncryptEvent.
+type RoomKeyPayload struct {
+	Recipient OlmRecipient
+	DeviceID  string
+	Content   *RoomKeyContent
+	// MessageIndex is the message index the session key starts at.
+	MessageIndex uint32
+}
+
+// RoomKeyTracker records which devices received the key of the outbound
+// group session of a room. The records are kept in the Shares of the
+// stored session, so they are replaced along with the session. It is safe
+// for concurrent use.
+//
+// A tracker that shares its store with a GroupSessionRotator must be
+// created with GroupSessionRotator.RoomKeyTracker, so both update the
+// stored sessions under the same lock. Otherwise recording shares can undo
+// the invalidation of a session.
+//
+// A device is identified by its user ID, device ID and identity key; a
+// device that changed its identity key is considered a new device.
+type RoomKeyTracker struct {
+	mutex *sync.Mutex
+	store OutboundGroupSessionStore
+}
+
+// NewRoomKeyTracker creates a RoomKeyTracker for the sessions in the store.
+func NewRoomKeyTracker(store OutboundGroupSessionStore) *RoomKeyTracker {
+	return &RoomKeyTracker{mutex: new(sync.Mutex), store: store}
+}
+
+func (t *RoomKeyTracker) load(roomID string) (*OutboundGroupSessionEntry, error) {
+	entry, err := t.store.LoadOutboundGroupSession(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("there is no outbound group session for room %s", roomID)
+	}
+	return entry, nil
+}
+
+// Pending returns the devices out of the current devices of the room
+// members that did not receive the key of the session of the room yet.
+// Devices that are not passed are never returned, so departed members do
+// not get the key.
+func (t *RoomKeyTracker) Pending(roomID string, devices []*DeviceKeys) ([]*DeviceKeys, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, err := t.load(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return pendingDevices(entry, devices), nil
+}
+
+func pendingDevices(entry *OutboundGroupSessionEntry, devices []*DeviceKeys) []*DeviceKeys {
+	var pending []*DeviceKeys
+	for _, device := range devices {
+		shared := false
+		for i := range entry.Shares {
+			if entry.Shares[i].matches(device) {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			pending = append(pending, device)
+		}
+	}
+	return pending
+}
+
+// Departed returns the records of devices that received the key of the
+// session of the room but are not among the current devices anymore. If
+// there are any, the session should be rotated.
+func (t *RoomKeyTracker) Departed(roomID string, devices []*DeviceKeys) ([]RoomKeyShare, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, err := t.load(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var departed []RoomKeyShare
+	for _, share := range entry.Shares {
+		present := false
+		for _, device := range devices {
+			if share.matches(device) {
+				present = true
+				break
+			}
+		}
+		if !present {
+			departed = append(departed, share)
+		}
+	}
+	return departed, nil
+}
+
+// Payloads returns an m.room_key payload for every pending device. The
+// payloads carry the session key at the current message index. Once they
+// were sent, they must be recorded with MarkShared. A session that must be
+// rotated is not shared anymore.
+func (t *RoomKeyTracker) Payloads(roomID string, devices []*DeviceKeys) ([]*RoomKeyPayload, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, err := t.load(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Rotate != RotationNotNeeded {
+		return nil, fmt.Errorf("the outbound group session of room %s must be rotated: %s", roomID, entry.Rotate)
+	}
+
+	pending := pendingDevices(entry, devices)
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	content := &RoomKeyContent{
+		Algorithm:  AlgorithmMegolmV1,
+		RoomID:     roomID,
+		SessionID:  entry.Session.ID(),
+		SessionKey: entry.Session.Key(),
+	}
+	index := entry.Session.MessageIndex()
+
+	payloads := make([]*RoomKeyPayload, 0, len(pending))
+	for _, device := range pending {
+		payloads = append(payloads, &RoomKeyPayload{
+			Recipient: OlmRecipient{
+				UserID:     device.UserID,
+				Curve25519: device.Curve25519(),
+				ED25519:    device.ED25519(),
+			},
+			DeviceID:     device.DeviceID,
+			Content:      content,
+			MessageIndex: index,
+		})
+	}
+	return payloads, nil
+}
+
+// MarkShared records that the payloads were sent. Payloads for a session
+// that is not the current session of the room anymore are rejected.
+func (t *RoomKeyTracker) MarkShared(roomID string, payloads []*RoomKeyPayload) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, err := t.load(roomID)
+	if err != nil {
+		return err
+	}
+
+	for _, payload := range payloads {
+		if payload.Content.SessionID != entry.Session.ID() {
+			return errors.New("payload is for another session")
+		}
+
+		share := RoomKeyShare{
+			UserID:       payload.Recipient.UserID,
+			DeviceID:     payload.DeviceID,
+			IdentityKey:  payload.Recipient.Curve25519,
+			MessageIndex: payload.MessageIndex,
+		}
+		replaced := false
+		for i := range entry.Shares {
+			existing := &entry.Shares[i]
+			if existing.UserID == share.UserID && existing.DeviceID == share.DeviceID && existing.IdentityKey == share.IdentityKey {
+				if share.MessageIndex < existing.MessageIndex {
+					existing.MessageIndex = share.MessageIndex
+				}
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			entry.Shares = append(entry.Shares, share)
+		}
+	}
+
+	return t.store.SaveOutboundGroupSession(entry)
+}
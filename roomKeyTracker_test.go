@@ -0,0 +1,132 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createTestDevice(userID, deviceID, curve25519 string) *DeviceKeys {
+	return &DeviceKeys{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Keys: map[string]string{
+			KeyAlgorithmCurve25519 + ":" + deviceID: curve25519,
+			ED25519KeyID(deviceID):                  "ed25519 of " + deviceID,
+		},
+	}
+}
+
+func TestRoomKeyTracker(t *testing.T) {
+	const room = "!room:example.org"
+
+	Convey("A RoomKeyTracker", t, func() {
+		store := NewMemoryStore()
+		out, _ := createOutAndInboundGroupSession()
+		store.SaveOutboundGroupSession(&OutboundGroupSessionEntry{Session: out, RoomID: room})
+		tracker := NewRoomKeyTracker(store)
+
+		alice := createTestDevice("@alice:example.org", "ALICE", "alicekey")
+		bob := createTestDevice("@bob:example.org", "BOB", "bobkey")
+
+		payloads, err := tracker.Payloads(room, []*DeviceKeys{alice, bob})
+		So(err, ShouldBeNil)
+		So(payloads, ShouldHaveLength, 2)
+
+		Convey("should create payloads for the session.", func() {
+			payload := payloads[0]
+			So(payload.Recipient, ShouldResemble, OlmRecipient{
+				UserID:     "@alice:example.org",
+				Curve25519: "alicekey",
+				ED25519:    "ed25519 of ALICE",
+			})
+			So(payload.DeviceID, ShouldEqual, "ALICE")
+			So(payload.Content.Algorithm, ShouldEqual, AlgorithmMegolmV1)
+			So(payload.Content.RoomID, ShouldEqual, room)
+			So(payload.Content.SessionID, ShouldEqual, out.ID())
+			So(payload.Content.SessionKey, ShouldEqual, out.Key())
+			So(payload.MessageIndex, ShouldEqual, 0)
+		})
+		Convey("should not return devices that got the key.", func() {
+			So(tracker.MarkShared(room, payloads[:1]), ShouldBeNil)
+
+			pending, err := tracker.Pending(room, []*DeviceKeys{alice, bob})
+			So(err, ShouldBeNil)
+			So(pending, ShouldResemble, []*DeviceKeys{bob})
+		})
+		Convey("should persist the shares with the session.", func() {
+			out.Encrypt("message")
+			So(tracker.MarkShared(room, payloads), ShouldBeNil)
+
+			entry, _ := store.LoadOutboundGroupSession(room)
+			So(entry.Shares, ShouldHaveLength, 2)
+			So(entry.Shares[1], ShouldResemble, RoomKeyShare{
+				UserID:       "@bob:example.org",
+				DeviceID:     "BOB",
+				IdentityKey:  "bobkey",
+				MessageIndex: 0,
+			})
+		})
+		Convey("should only share with newly joined devices.", func() {
+			So(tracker.MarkShared(room, payloads), ShouldBeNil)
+			out.Encrypt("message")
+
+			carol := createTestDevice("@carol:example.org", "CAROL", "carolkey")
+			next, err := tracker.Payloads(room, []*DeviceKeys{alice, bob, carol})
+			So(err, ShouldBeNil)
+			So(next, ShouldHaveLength, 1)
+			So(next[0].DeviceID, ShouldEqual, "CAROL")
+			So(next[0].MessageIndex, ShouldEqual, 1)
+		})
+		Convey("should treat a device with a new identity key as new.", func() {
+			So(tracker.MarkShared(room, payloads), ShouldBeNil)
+
+			pending, _ := tracker.Pending(room, []*DeviceKeys{createTestDevice("@bob:example.org", "BOB", "newkey")})
+			So(pending, ShouldHaveLength, 1)
+		})
+		Convey("should report departed devices.", func() {
+			So(tracker.MarkShared(room, payloads), ShouldBeNil)
+
+			departed, err := tracker.Departed(room, []*DeviceKeys{alice})
+			So(err, ShouldBeNil)
+			So(departed, ShouldHaveLength, 1)
+			So(departed[0].DeviceID, ShouldEqual, "BOB")
+		})
+		Convey("should reject payloads of a replaced session.", func() {
+			next, _ := NewOutboundGroupSession()
+			store.SaveOutboundGroupSession(&OutboundGroupSessionEntry{Session: next, RoomID: room})
+
+			So(tracker.MarkShared(room, payloads), ShouldNotBeNil)
+		})
+	})
+	Convey("A RoomKeyTracker of a GroupSessionRotator", t, func() {
+		rotator := NewGroupSessionRotator(NewMemoryStore())
+		tracker := rotator.RoomKeyTracker()
+		rotator.Session(room)
+		alice := createTestDevice("@alice:example.org", "ALICE", "alicekey")
+
+		Convey("should share the lock of the rotator.", func() {
+			So(tracker.mutex, ShouldEqual, &rotator.mutex)
+		})
+		Convey("should not share a session that must be rotated.", func() {
+			So(rotator.MemberLeft(room), ShouldBeNil)
+
+			_, err := tracker.Payloads(room, []*DeviceKeys{alice})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should keep the rotation when recording shares.", func() {
+			payloads, _ := tracker.Payloads(room, []*DeviceKeys{alice})
+			So(rotator.MemberLeft(room), ShouldBeNil)
+			So(tracker.MarkShared(room, payloads), ShouldBeNil)
+
+			reason, _ := rotator.Check(room)
+			So(reason, ShouldEqual, RotationMemberLeft)
+			_, reason, _ = rotator.Session(room)
+			So(reason, ShouldEqual, RotationMemberLeft)
+		})
+	})
+	Convey("A room without a session should not work.", t, func() {
+		_, err := NewRoomKeyTracker(NewMemoryStore()).Pending(room, nil)
+		So(err, ShouldNotBeNil)
+	})
+}
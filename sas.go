@@ -0,0 +1,221 @@
+package golm
+
+//#include <olm/sas.h>
+import "C"
+import (
+	"crypto/rand"
+	"errors"
+	"unsafe"
+)
+
+// SAS represents an OlmSAS, used to calculate a short authentication
+// string from an ephemeral key agreement.
+type SAS struct {
+	memory    []byte
+	ptr       *C.OlmSAS
+	publicKey string
+}
+
+func newSAS() *SAS {
+	buf := make([]byte, C.olm_sas_size())
+	ptr := C.olm_sas(unsafe.Pointer(&buf[0]))
+
+	return &SAS{
+		memory: buf,
+		ptr:    ptr,
+	}
+}
+
+func (s *SAS) lastError() string {
+	return C.GoString(C.olm_sas_last_error(s.ptr))
+}
+
+// Clear clears the memory used to back this SAS.
+// Note that once this function was called using the object it
+// was called on will panic.
+//
+// C-Function: olm_clear_sas
+func (s *SAS) Clear() {
+	C.olm_clear_sas(s.ptr)
+}
+
+// NewSAS creates a SAS with a new random key pair.
+//
+// C-Function: olm_create_sas
+func NewSAS() (*SAS, error) {
+	s := newSAS()
+
+	randomBytes := make([]byte, C.olm_create_sas_random_length(s.ptr))
+
+	n, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := C.olm_create_sas(
+		s.ptr,
+		unsafe.Pointer(&randomBytes[0]), C.size_t(n),
+	)
+
+	err = getError(s, result)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyBytes := make([]byte, C.olm_sas_pubkey_length(s.ptr))
+
+	result = C.olm_sas_get_pubkey(
+		s.ptr,
+		unsafe.Pointer(&publicKeyBytes[0]), C.size_t(len(publicKeyBytes)),
+	)
+
+	err = getError(s, result)
+	panicOnError(err)
+
+	s.publicKey = string(publicKeyBytes)
+	return s, nil
+}
+
+// PublicKey returns the public key to send to the other side.
+func (s *SAS) PublicKey() string {
+	return s.publicKey
+}
+
+// SetTheirKey sets the public key of the other side.
+//
+// C-Function: olm_sas_set_their_key
+func (s *SAS) SetTheirKey(theirKey string) error {
+	if theirKey == "" {
+		return errors.New("theirKey must not be empty")
+	}
+
+	keyBytes := []byte(theirKey)
+
+	result := C.olm_sas_set_their_key(
+		s.ptr,
+		unsafe.Pointer(&keyBytes[0]), C.size_t(len(keyBytes)),
+	)
+
+	return getError(s, result)
+}
+
+// GenerateBytes generates length bytes to be shown as the short
+// authentication string. Both sides must use the same info.
+//
+// C-Function: olm_sas_generate_bytes
+func (s *SAS) GenerateBytes(info string, length int) ([]byte, error) {
+	if info == "" {
+		return nil, errors.New("info must not be empty")
+	}
+	if length <= 0 {
+		return nil, errors.New("length must be positive")
+	}
+
+	infoBytes := []byte(info)
+	output := make([]byte, length)
+
+	result := C.olm_sas_generate_bytes(
+		s.ptr,
+		unsafe.Pointer(&infoBytes[0]), C.size_t(len(infoBytes)),
+		unsafe.Pointer(&output[0]), C.size_t(len(output)),
+	)
+
+	err := getError(s, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// CalculateMAC calculates a MAC of the input using the shared secret, as
+// used by the "hkdf-hmac-sha256" method.
+//
+// C-Function: olm_sas_calculate_mac
+func (s *SAS) CalculateMAC(input, info string) (string, error) {
+	if input == "" || info == "" {
+		return "", errors.New("input and info must not be empty")
+	}
+
+	inputBytes := []byte(input)
+	infoBytes := []byte(info)
+	macBytes := make([]byte, C.olm_sas_mac_length(s.ptr))
+
+	result := C.olm_sas_calculate_mac(
+		s.ptr,
+		unsafe.Pointer(&inputBytes[0]), C.size_t(len(inputBytes)),
+		unsafe.Pointer(&infoBytes[0]), C.size_t(len(infoBytes)),
+		unsafe.Pointer(&macBytes[0]), C.size_t(len(macBytes)),
+	)
+
+	err := getError(s, result)
+	if err != nil {
+		return "", err
+	}
+
+	return string(macBytes), nil
+}
+
+// SASEmoji is an emoji of the emoji representation of a short
+// authentication string.
+type SASEmoji struct {
+	Emoji       string
+	Description string
+}
+
+var sasEmojis = [64]SASEmoji{
+	{"🐶", "Dog"}, {"🐱", "Cat"}, {"🦁", "Lion"}, {"🐎", "Horse"},
+	{"🦄", "Unicorn"}, {"🐷", "Pig"}, {"🐘", "Elephant"}, {"🐰", "Rabbit"},
+	{"🐼", "Panda"}, {"🐓", "Rooster"}, {"🐧", "Penguin"}, {"🐢", "Turtle"},
+	{"🐟", "Fish"}, {"🐙", "Octopus"}, {"🦋", "Butterfly"}, {"🌷", "Flower"},
+	{"🌳", "Tree"}, {"🌵", "Cactus"}, {"🍄", "Mushroom"}, {"🌏", "Globe"},
+	{"🌙", "Moon"}, {"☁️", "Cloud"}, {"🔥", "Fire"}, {"🍌", "Banana"},
+	{"🍎", "Apple"}, {"🍓", "Strawberry"}, {"🌽", "Corn"}, {"🍕", "Pizza"},
+	{"🎂", "Cake"}, {"❤️", "Heart"}, {"😀", "Smiley"}, {"🤖", "Robot"},
+	{"🎩", "Hat"}, {"👓", "Glasses"}, {"🔧", "Spanner"}, {"🎅", "Santa"},
+	{"👍", "Thumbs Up"}, {"☂️", "Umbrella"}, {"⌛", "Hourglass"}, {"⏰", "Clock"},
+	{"🎁", "Gift"}, {"💡", "Light Bulb"}, {"📕", "Book"}, {"✏️", "Pencil"},
+	{"📎", "Paperclip"}, {"✂️", "Scissors"}, {"🔒", "Lock"}, {"🔑", "Key"},
+	{"🔨", "Hammer"}, {"☎️", "Telephone"}, {"🏁", "Flag"}, {"🚂", "Train"},
+	{"🚲", "Bicycle"}, {"✈️", "Aeroplane"}, {"🚀", "Rocket"}, {"🏆", "Trophy"},
+	{"⚽", "Ball"}, {"🎸", "Guitar"}, {"🎺", "Trumpet"}, {"🔔", "Bell"},
+	{"⚓", "Anchor"}, {"🎧", "Headphones"}, {"📁", "Folder"}, {"📌", "Pin"},
+}
+
+// SASEmojis returns the seven emojis shown for the first six bytes of a
+// short authentication string.
+func SASEmojis(sasBytes []byte) ([]SASEmoji, error) {
+	if len(sasBytes) < 6 {
+		return nil, errors.New("sasBytes must be at least 6 bytes long")
+	}
+
+	var bits uint64
+	for _, b := range sasBytes[:6] {
+		bits = bits<<8 | uint64(b)
+	}
+
+	emojis := make([]SASEmoji, 7)
+	for i := range emojis {
+		emojis[i] = sasEmojis[(bits>>uint(42-6*i))&0x3F]
+	}
+	return emojis, nil
+}
+
+// SASDecimals returns the three numbers between 1000 and 9191 shown for
+// the first five bytes of a short authentication string.
+func SASDecimals(sasBytes []byte) ([3]int, error) {
+	if len(sasBytes) < 5 {
+		return [3]int{}, errors.New("sasBytes must be at least 5 bytes long")
+	}
+
+	var bits uint64
+	for _, b := range sasBytes[:5] {
+		bits = bits<<8 | uint64(b)
+	}
+
+	return [3]int{
+		int(bits>>27&0x1FFF) + 1000,
+		int(bits>>14&0x1FFF) + 1000,
+		int(bits>>1&0x1FFF) + 1000,
+	}, nil
+}
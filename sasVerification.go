@@ -0,0 +1,740 @@
+package golm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultVerificationTimeout is the default time a verification may be
+// idle before it is cancelled.
+const DefaultVerificationTimeout = 10 * time.Minute
+
+const (
+	sasKeyAgreement = "curve25519-hkdf-sha256"
+	sasHash         = "sha256"
+	sasMAC          = "hkdf-hmac-sha256"
+	sasDecimal      = "decimal"
+	sasEmoji        = "emoji"
+	sasLength       = 6
+
+	// Requests are ignored if they are older than this or too far in
+	// the future.
+	verificationRequestMaxAge    = 10 * time.Minute
+	verificationRequestMaxFuture = 5 * time.Minute
+)
+
+// VerificationState is the state of a SASVerification.
+type VerificationState int
+
+const (
+	// VerificationStateCreated means nothing was sent or received yet.
+	VerificationStateCreated VerificationState = iota
+	// VerificationStateRequested means a request was sent or received.
+	VerificationStateRequested
+	// VerificationStateReady means the request was accepted.
+	VerificationStateReady
+	// VerificationStateStarted means the SAS method was started.
+	VerificationStateStarted
+	// VerificationStateAccepted means the start was accepted and the keys
+	// are being exchanged.
+	VerificationStateAccepted
+	// VerificationStateKeysExchanged means the short authentication string
+	// can be shown and the user must confirm or reject it.
+	VerificationStateKeysExchanged
+	// VerificationStateDone means both sides verified each other.
+	VerificationStateDone
+	// VerificationStateCancelled means one side cancelled the
+	// verification.
+	VerificationStateCancelled
+)
+
+func (s VerificationState) String() string {
+	switch s {
+	case VerificationStateCreated:
+		return "created"
+	case VerificationStateRequested:
+		return "requested"
+	case VerificationStateReady:
+		return "ready"
+	case VerificationStateStarted:
+		return "started"
+	case VerificationStateAccepted:
+		return "accepted"
+	case VerificationStateKeysExchanged:
+		return "keys exchanged"
+	case VerificationStateDone:
+		return "done"
+	case VerificationStateCancelled:
+		return "cancelled"
+	}
+	return fmt.Sprintf("VerificationState(%d)", int(s))
+}
+
+// SASVerificationConfig describes both sides of a SAS verification.
+type SASVerificationConfig struct {
+	Account  *Account
+	UserID   string
+	DeviceID string
+	// MasterKey is our public cross-signing master key. If set it is
+	// verified by the other side as well.
+	MasterKey string
+
+	TheirDevice *DeviceKeys
+	// TheirMasterKey is the expected public cross-signing master key of
+	// the other user. If set and contained in their MAC it is verified.
+	TheirMasterKey string
+}
+
+// SASVerification is the state machine of an interactive SAS verification
+// with another device. It does not send anything itself: every method
+// returns the events to send to the other device, and received events are
+// passed to Receive. It is safe for concurrent use.
+//
+// The side sending the request starts the SAS method once the other side
+// is ready. Each side then confirms the short authentication string with
+// Confirm or rejects it with Reject, which sends the MAC of its keys or
+// cancels the verification.
+type SASVerification struct {
+	// Timeout is the time the verification may be idle before CheckTimeout
+	// cancels it.
+	Timeout time.Duration
+
+	mutex         sync.Mutex
+	config        SASVerificationConfig
+	transactionID string
+	state         VerificationState
+	requestedByUs bool
+	startedByUs   bool
+	start         string
+	commitment    string
+	sas           *SAS
+	sasBytes      []byte
+	macSent       bool
+	macVerified   bool
+	doneSent      bool
+	doneReceived  bool
+	masterKey     string
+	cancel        *VerificationCancel
+	lastActivity  time.Time
+	now           func() time.Time
+}
+
+// NewSASVerification creates a SASVerification with the device described
+// by the config.
+func NewSASVerification(config SASVerificationConfig) (*SASVerification, error) {
+	if config.Account == nil || config.TheirDevice == nil {
+		return nil, errors.New("Account and TheirDevice must not be nil")
+	}
+	if config.UserID == "" || config.DeviceID == "" {
+		return nil, errors.New("UserID and DeviceID must not be empty")
+	}
+
+	sas, err := NewSAS()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SASVerification{
+		Timeout: DefaultVerificationTimeout,
+		config:  config,
+		sas:     sas,
+		now:     time.Now,
+	}, nil
+}
+
+// TransactionID returns the ID of the verification, which is empty until
+// something was sent or received.
+func (v *SASVerification) TransactionID() string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return v.transactionID
+}
+
+// State returns the state of the verification.
+func (v *SASVerification) State() VerificationState {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return v.state
+}
+
+// Cancellation returns the cancel event that ended the verification or
+// nil if it was not cancelled.
+func (v *SASVerification) Cancellation() *VerificationCancel {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return v.cancel
+}
+
+// VerifiedMasterKey returns the master key of the other user if it was
+// verified along with their device.
+func (v *SASVerification) VerifiedMasterKey() string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.state != VerificationStateDone {
+		return ""
+	}
+	return v.masterKey
+}
+
+// Request starts the verification by requesting it from the other device.
+func (v *SASVerification) Request() ([]*VerificationEvent, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.state != VerificationStateCreated {
+		return nil, fmt.Errorf("can not request a verification that is %s", v.state)
+	}
+
+	transactionID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	v.transactionID = transactionID
+	v.requestedByUs = true
+	v.setState(VerificationStateRequested)
+
+	return v.events(EventTypeVerificationRequest, &VerificationRequest{
+		FromDevice:    v.config.DeviceID,
+		Methods:       []string{VerificationMethodSAS},
+		Timestamp:     v.now().UnixNano() / int64(time.Millisecond),
+		TransactionID: v.transactionID,
+	}), nil
+}
+
+// Ready accepts a received request.
+func (v *SASVerification) Ready() ([]*VerificationEvent, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.state != VerificationStateRequested || v.requestedByUs {
+		return nil, errors.New("there is no received request to accept")
+	}
+
+	v.setState(VerificationStateReady)
+	return v.events(EventTypeVerificationReady, &VerificationReady{
+		FromDevice:    v.config.DeviceID,
+		Methods:       []string{VerificationMethodSAS},
+		TransactionID: v.transactionID,
+	}), nil
+}
+
+// Start starts the SAS method, either after a request or without one. If
+// properties are added to the start event before it is sent, the sent
+// content must be passed to SentStart.
+func (v *SASVerification) Start() ([]*VerificationEvent, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.state != VerificationStateCreated && v.state != VerificationStateReady {
+		return nil, fmt.Errorf("can not start a verification that is %s", v.state)
+	}
+	if v.transactionID == "" {
+		transactionID, err := randomID()
+		if err != nil {
+			return nil, err
+		}
+		v.transactionID = transactionID
+	}
+
+	return v.startSAS()
+}
+
+func (v *SASVerification) startSAS() ([]*VerificationEvent, error) {
+	start := &VerificationStart{
+		FromDevice:                 v.config.DeviceID,
+		Method:                     VerificationMethodSAS,
+		TransactionID:              v.transactionID,
+		KeyAgreementProtocols:      []string{sasKeyAgreement},
+		Hashes:                     []string{sasHash},
+		MessageAuthenticationCodes: []string{sasMAC},
+		ShortAuthenticationString:  []string{sasDecimal, sasEmoji},
+	}
+	canonical, err := CanonicalJSON(start)
+	if err != nil {
+		return nil, err
+	}
+
+	v.start = string(canonical)
+	v.startedByUs = true
+	v.setState(VerificationStateStarted)
+	return v.events(EventTypeVerificationStart, start), nil
+}
+
+// SentStart records the content of our start event as it was sent. It must
+// be called before the accept arrives if properties were added to the
+// content, e.g. m.relates_to for a verification in a room, as the
+// commitment of the other side covers the content as sent.
+func (v *SASVerification) SentStart(content []byte) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.state != VerificationStateStarted || !v.startedByUs {
+		return fmt.Errorf("can not record the start of a verification that is %s", v.state)
+	}
+
+	var start VerificationStart
+	err := json.Unmarshal(content, &start)
+	if err != nil {
+		return err
+	}
+	if start.TransactionID != v.transactionID || start.Method != VerificationMethodSAS {
+		return errors.New("content is not the start of the verification")
+	}
+
+	canonical, err := CanonicalJSON(json.RawMessage(content))
+	if err != nil {
+		return err
+	}
+	v.start = string(canonical)
+	return nil
+}
+
+// Confirm confirms that the short authentication strings match and sends
+// the MAC of our keys.
+func (v *SASVerification) Confirm() ([]*VerificationEvent, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.state != VerificationStateKeysExchanged || v.macSent {
+		return nil, errors.New("there is no short authentication string to confirm")
+	}
+
+	mac, err := v.ourMAC()
+	if err != nil {
+		return nil, err
+	}
+	v.macSent = true
+	v.touch()
+
+	events := v.events(EventTypeVerificationMAC, mac)
+	return append(events, v.sendDone()...), nil
+}
+
+// Reject cancels the verification because the short authentication
+// strings do not match.
+func (v *SASVerification) Reject() []*VerificationEvent {
+	return v.Cancel(CancelMismatchedSAS, "The short authentication strings do not match")
+}
+
+// Cancel cancels the verification. It returns nothing if the verification
+// is already finished.
+func (v *SASVerification) Cancel(code, reason string) []*VerificationEvent {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return v.cancelWith(code, reason)
+}
+
+// CheckTimeout cancels the verification if it was idle for longer than
+// Timeout. It should be called periodically.
+func (v *SASVerification) CheckTimeout() []*VerificationEvent {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.state == VerificationStateCreated || v.Timeout <= 0 || v.now().Sub(v.lastActivity) < v.Timeout {
+		return nil
+	}
+	return v.cancelWith(CancelTimeout, "The verification timed out")
+}
+
+// Decimals returns the short authentication string as three numbers.
+func (v *SASVerification) Decimals() ([3]int, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.sasBytes == nil {
+		return [3]int{}, errors.New("the keys were not exchanged yet")
+	}
+	return SASDecimals(v.sasBytes)
+}
+
+// Emojis returns the short authentication string as seven emojis.
+func (v *SASVerification) Emojis() ([]SASEmoji, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.sasBytes == nil {
+		return nil, errors.New("the keys were not exchanged yet")
+	}
+	return SASEmojis(v.sasBytes)
+}
+
+// Receive processes an event received from the other device and returns
+// the events to send in response. Protocol violations cancel the
+// verification; the returned events contain the cancel event then. Expired
+// requests are ignored. An error is only returned for events that do not
+// belong to the verification.
+func (v *SASVerification) Receive(event *VerificationEvent) ([]*VerificationEvent, error) {
+	if event == nil {
+		return nil, errors.New("event must not be nil")
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	transactionID := event.TransactionID()
+	if transactionID == "" {
+		return nil, fmt.Errorf("unexpected content of %s", event.Type)
+	}
+	if v.transactionID != "" && transactionID != v.transactionID {
+		return nil, fmt.Errorf("unknown transaction %q", transactionID)
+	}
+	if v.state == VerificationStateDone || v.state == VerificationStateCancelled {
+		return nil, nil
+	}
+
+	switch content := event.Content.(type) {
+	case *VerificationRequest:
+		return v.receiveRequest(content)
+	case *VerificationReady:
+		return v.receiveReady(content)
+	case *VerificationStart:
+		return v.receiveStart(content, event.Raw)
+	case *VerificationAccept:
+		return v.receiveAccept(content)
+	case *VerificationKey:
+		return v.receiveKey(content)
+	case *VerificationMAC:
+		return v.receiveMAC(content)
+	case *VerificationDone:
+		return v.receiveDone()
+	case *VerificationCancel:
+		copied := *content
+		v.cancel = &copied
+		v.setState(VerificationStateCancelled)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected content of %s", event.Type)
+}
+
+func (v *SASVerification) receiveRequest(request *VerificationRequest) ([]*VerificationEvent, error) {
+	if v.state != VerificationStateCreated {
+		return v.unexpected()
+	}
+
+	sent := time.Unix(0, request.Timestamp*int64(time.Millisecond))
+	age := v.now().Sub(sent)
+	if age > verificationRequestMaxAge || age < -verificationRequestMaxFuture {
+		// Expired requests are ignored.
+		return nil, nil
+	}
+	if !containsString(request.Methods, VerificationMethodSAS) {
+		v.transactionID = request.TransactionID
+		return v.cancelWith(CancelUnknownMethod, "Only "+VerificationMethodSAS+" is supported"), nil
+	}
+
+	v.transactionID = request.TransactionID
+	v.setState(VerificationStateRequested)
+	return nil, nil
+}
+
+func (v *SASVerification) receiveReady(ready *VerificationReady) ([]*VerificationEvent, error) {
+	if v.state != VerificationStateRequested || !v.requestedByUs {
+		return v.unexpected()
+	}
+	if !containsString(ready.Methods, VerificationMethodSAS) {
+		return v.cancelWith(CancelUnknownMethod, "Only "+VerificationMethodSAS+" is supported"), nil
+	}
+
+	v.setState(VerificationStateReady)
+	return v.startSAS()
+}
+
+func (v *SASVerification) receiveStart(start *VerificationStart, raw []byte) ([]*VerificationEvent, error) {
+	switch {
+	case v.state == VerificationStateCreated, v.state == VerificationStateReady:
+	case v.state == VerificationStateStarted && v.startedByUs:
+		// Both sides started; the start of the side with the lower user
+		// ID, then device ID, wins.
+		their := v.config.TheirDevice
+		if their.UserID > v.config.UserID || (their.UserID == v.config.UserID && their.DeviceID > v.config.DeviceID) {
+			return nil, nil
+		}
+		v.startedByUs = false
+	default:
+		return v.unexpected()
+	}
+
+	if start.Method != VerificationMethodSAS ||
+		!containsString(start.KeyAgreementProtocols, sasKeyAgreement) ||
+		!containsString(start.Hashes, sasHash) ||
+		!containsString(start.MessageAuthenticationCodes, sasMAC) ||
+		!containsString(start.ShortAuthenticationString, sasDecimal) {
+		v.transactionID = start.TransactionID
+		return v.cancelWith(CancelUnknownMethod, "No supported SAS parameters"), nil
+	}
+
+	// The commitment covers the start as it was sent, including properties
+	// VerificationStart does not know.
+	var original interface{} = start
+	if raw != nil {
+		original = raw
+	}
+	canonical, err := CanonicalJSON(original)
+	if err != nil {
+		return v.cancelWith(CancelInvalidMessage, err.Error()), nil
+	}
+
+	v.transactionID = start.TransactionID
+	v.start = string(canonical)
+	v.startedByUs = false
+
+	methods := []string{sasDecimal}
+	if containsString(start.ShortAuthenticationString, sasEmoji) {
+		methods = append(methods, sasEmoji)
+	}
+
+	v.setState(VerificationStateAccepted)
+	return v.events(EventTypeVerificationAccept, &VerificationAccept{
+		TransactionID:             v.transactionID,
+		Method:                    VerificationMethodSAS,
+		KeyAgreementProtocol:      sasKeyAgreement,
+		Hash:                      sasHash,
+		MessageAuthenticationCode: sasMAC,
+		ShortAuthenticationString: methods,
+		Commitment:                sasCommitment(v.sas.PublicKey(), v.start),
+	}), nil
+}
+
+func (v *SASVerification) receiveAccept(accept *VerificationAccept) ([]*VerificationEvent, error) {
+	if v.state != VerificationStateStarted || !v.startedByUs {
+		return v.unexpected()
+	}
+	if accept.KeyAgreementProtocol != sasKeyAgreement || accept.Hash != sasHash ||
+		accept.MessageAuthenticationCode != sasMAC || !containsString(accept.ShortAuthenticationString, sasDecimal) {
+		return v.cancelWith(CancelUnknownMethod, "No supported SAS parameters"), nil
+	}
+	if accept.Commitment == "" {
+		return v.cancelWith(CancelInvalidMessage, "The commitment is missing"), nil
+	}
+
+	v.commitment = accept.Commitment
+	v.setState(VerificationStateAccepted)
+	return v.events(EventTypeVerificationKey, &VerificationKey{
+		TransactionID: v.transactionID,
+		Key:           v.sas.PublicKey(),
+	}), nil
+}
+
+func (v *SASVerification) receiveKey(key *VerificationKey) ([]*VerificationEvent, error) {
+	if v.state != VerificationStateAccepted || v.sasBytes != nil {
+		return v.unexpected()
+	}
+	if key.Key == "" {
+		return v.cancelWith(CancelInvalidMessage, "The key is missing"), nil
+	}
+	if v.startedByUs && sasCommitment(key.Key, v.start) != v.commitment {
+		return v.cancelWith(CancelMismatchedCommitment, "The key does not match the commitment"), nil
+	}
+
+	err := v.sas.SetTheirKey(key.Key)
+	if err != nil {
+		return v.cancelWith(CancelInvalidMessage, err.Error()), nil
+	}
+
+	ourKey, theirKey := v.sas.PublicKey(), key.Key
+	starting := []string{v.config.UserID, v.config.DeviceID, ourKey}
+	accepting := []string{v.config.TheirDevice.UserID, v.config.TheirDevice.DeviceID, theirKey}
+	if !v.startedByUs {
+		starting, accepting = accepting, starting
+	}
+	info := "MATRIX_KEY_VERIFICATION_SAS|" + strings.Join(starting, "|") + "|" + strings.Join(accepting, "|") + "|" + v.transactionID
+
+	v.sasBytes, err = v.sas.GenerateBytes(info, sasLength)
+	if err != nil {
+		return v.cancelWith(CancelInvalidMessage, err.Error()), nil
+	}
+	v.setState(VerificationStateKeysExchanged)
+
+	if v.startedByUs {
+		return nil, nil
+	}
+	return v.events(EventTypeVerificationKey, &VerificationKey{
+		TransactionID: v.transactionID,
+		Key:           ourKey,
+	}), nil
+}
+
+func (v *SASVerification) receiveMAC(mac *VerificationMAC) ([]*VerificationEvent, error) {
+	if v.state != VerificationStateKeysExchanged || v.macVerified {
+		return v.unexpected()
+	}
+
+	their := v.config.TheirDevice
+	if their.ED25519() == "" {
+		return v.cancelWith(CancelKeyMismatch, "The device key is unknown"), nil
+	}
+	deviceKeyID := ED25519KeyID(their.DeviceID)
+	if _, ok := mac.MAC[deviceKeyID]; !ok {
+		return v.cancelWith(CancelKeyMismatch, "The device key was not verified"), nil
+	}
+
+	info := "MATRIX_KEY_VERIFICATION_MAC" + their.UserID + their.DeviceID +
+		v.config.UserID + v.config.DeviceID + v.transactionID
+
+	keyIDs := make([]string, 0, len(mac.MAC))
+	for keyID := range mac.MAC {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	expected, err := v.sas.CalculateMAC(strings.Join(keyIDs, ","), info+"KEY_IDS")
+	if err != nil {
+		return v.cancelWith(CancelKeyMismatch, err.Error()), nil
+	}
+	if expected != mac.Keys {
+		return v.cancelWith(CancelKeyMismatch, "The MAC of the key IDs does not match"), nil
+	}
+
+	masterKey := ""
+	for _, keyID := range keyIDs {
+		var key string
+		switch {
+		case keyID == deviceKeyID:
+			key = their.ED25519()
+		case v.config.TheirMasterKey != "" && keyID == ED25519KeyID(v.config.TheirMasterKey):
+			key = v.config.TheirMasterKey
+			masterKey = key
+		default:
+			continue
+		}
+
+		expected, err := v.sas.CalculateMAC(key, info+keyID)
+		if err != nil {
+			return v.cancelWith(CancelKeyMismatch, err.Error()), nil
+		}
+		if expected != mac.MAC[keyID] {
+			return v.cancelWith(CancelKeyMismatch, "The MAC of "+keyID+" does not match"), nil
+		}
+	}
+
+	v.macVerified = true
+	v.masterKey = masterKey
+	v.touch()
+	return v.sendDone(), nil
+}
+
+func (v *SASVerification) receiveDone() ([]*VerificationEvent, error) {
+	if !v.macVerified || v.doneReceived {
+		return v.unexpected()
+	}
+
+	v.doneReceived = true
+	v.touch()
+	if v.doneSent {
+		v.setState(VerificationStateDone)
+	}
+	return nil, nil
+}
+
+// sendDone returns the done event once both MACs were exchanged.
+func (v *SASVerification) sendDone() []*VerificationEvent {
+	if !v.macSent || !v.macVerified || v.doneSent {
+		return nil
+	}
+
+	v.doneSent = true
+	if v.doneReceived {
+		v.setState(VerificationStateDone)
+	}
+	return v.events(EventTypeVerificationDone, &VerificationDone{TransactionID: v.transactionID})
+}
+
+func (v *SASVerification) ourMAC() (*VerificationMAC, error) {
+	their := v.config.TheirDevice
+	info := "MATRIX_KEY_VERIFICATION_MAC" + v.config.UserID + v.config.DeviceID +
+		their.UserID + their.DeviceID + v.transactionID
+
+	keys := map[string]string{
+		ED25519KeyID(v.config.DeviceID): v.config.Account.IdentityKeys().ED25519,
+	}
+	if v.config.MasterKey != "" {
+		keys[ED25519KeyID(v.config.MasterKey)] = v.config.MasterKey
+	}
+
+	mac := &VerificationMAC{
+		TransactionID: v.transactionID,
+		MAC:           make(map[string]string, len(keys)),
+	}
+	keyIDs := make([]string, 0, len(keys))
+	for keyID, key := range keys {
+		keyMAC, err := v.sas.CalculateMAC(key, info+keyID)
+		if err != nil {
+			return nil, err
+		}
+		mac.MAC[keyID] = keyMAC
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	var err error
+	mac.Keys, err = v.sas.CalculateMAC(strings.Join(keyIDs, ","), info+"KEY_IDS")
+	if err != nil {
+		return nil, err
+	}
+	return mac, nil
+}
+
+func (v *SASVerification) unexpected() ([]*VerificationEvent, error) {
+	return v.cancelWith(CancelUnexpectedMessage, "Unexpected message"), nil
+}
+
+func (v *SASVerification) cancelWith(code, reason string) []*VerificationEvent {
+	if v.state == VerificationStateDone || v.state == VerificationStateCancelled {
+		return nil
+	}
+
+	v.cancel = &VerificationCancel{
+		TransactionID: v.transactionID,
+		Code:          code,
+		Reason:        reason,
+	}
+	v.setState(VerificationStateCancelled)
+	if v.transactionID == "" {
+		return nil
+	}
+
+	copied := *v.cancel
+	return v.events(EventTypeVerificationCancel, &copied)
+}
+
+func (v *SASVerification) setState(state VerificationState) {
+	v.state = state
+	v.touch()
+
+	// The private key is not needed anymore once the verification ended.
+	if state == VerificationStateDone || state == VerificationStateCancelled {
+		v.sas.Clear()
+	}
+}
+
+func (v *SASVerification) touch() {
+	v.lastActivity = v.now()
+}
+
+func (v *SASVerification) events(eventType string, content interface{}) []*VerificationEvent {
+	return []*VerificationEvent{{Type: eventType, Content: content}}
+}
+
+// sasCommitment is the commitment to the public key of the accepting side.
+func sasCommitment(publicKey, start string) string {
+	return NewUtility().SHA256(publicKey + start)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,369 @@
+package golm
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type verificationSide struct {
+	account      *Account
+	device       *DeviceKeys
+	verification *SASVerification
+}
+
+// createVerificationPair creates a verification between the devices of
+// @alice and @bob, both with a cross-signing master key.
+func createVerificationPair() (*verificationSide, *verificationSide, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+
+	aliceAccount, _ := NewAccount()
+	aliceDevice, _ := NewDeviceKeys(aliceAccount, "@alice:example.org", "ALICE")
+	bobAccount, _ := NewAccount()
+	bobDevice, _ := NewDeviceKeys(bobAccount, "@bob:example.org", "BOB")
+
+	aliceMaster, _ := NewPkSigning()
+	bobMaster, _ := NewPkSigning()
+
+	alice, _ := NewSASVerification(SASVerificationConfig{
+		Account:        aliceAccount,
+		UserID:         "@alice:example.org",
+		DeviceID:       "ALICE",
+		MasterKey:      aliceMaster.PublicKey(),
+		TheirDevice:    bobDevice,
+		TheirMasterKey: bobMaster.PublicKey(),
+	})
+	bob, _ := NewSASVerification(SASVerificationConfig{
+		Account:        bobAccount,
+		UserID:         "@bob:example.org",
+		DeviceID:       "BOB",
+		MasterKey:      bobMaster.PublicKey(),
+		TheirDevice:    aliceDevice,
+		TheirMasterKey: aliceMaster.PublicKey(),
+	})
+	alice.now = clock.Now
+	bob.now = clock.Now
+
+	return &verificationSide{aliceAccount, aliceDevice, alice},
+		&verificationSide{bobAccount, bobDevice, bob},
+		clock
+}
+
+// transmit sends the event through JSON like a transport would.
+func transmit(event *VerificationEvent) *VerificationEvent {
+	content, _ := json.Marshal(event.Content)
+	received, err := ParseVerificationEvent(event.Type, content)
+	So(err, ShouldBeNil)
+	return received
+}
+
+// deliver passes the events of from to to and the responses back and forth
+// until neither side has anything left to send.
+func deliver(from, to *SASVerification, events []*VerificationEvent) {
+	for len(events) > 0 {
+		var responses []*VerificationEvent
+		for _, event := range events {
+			response, err := to.Receive(transmit(event))
+			So(err, ShouldBeNil)
+			responses = append(responses, response...)
+		}
+		events = responses
+		from, to = to, from
+	}
+}
+
+// exchangeKeys runs the verification up to the comparison of the short
+// authentication strings.
+func exchangeKeys(alice, bob *SASVerification) {
+	events, err := alice.Request()
+	So(err, ShouldBeNil)
+	deliver(alice, bob, events)
+	So(bob.State(), ShouldEqual, VerificationStateRequested)
+
+	events, err = bob.Ready()
+	So(err, ShouldBeNil)
+	deliver(bob, alice, events)
+}
+
+func TestSASVerification(t *testing.T) {
+	Convey("A SAS verification", t, func() {
+		alice, bob, clock := createVerificationPair()
+		exchangeKeys(alice.verification, bob.verification)
+
+		Convey("should exchange the keys after the request was accepted.", func() {
+			So(alice.verification.State(), ShouldEqual, VerificationStateKeysExchanged)
+			So(bob.verification.State(), ShouldEqual, VerificationStateKeysExchanged)
+			So(bob.verification.TransactionID(), ShouldEqual, alice.verification.TransactionID())
+		})
+		Convey("should show the same short authentication string on both sides.", func() {
+			aliceDecimals, err := alice.verification.Decimals()
+			So(err, ShouldBeNil)
+			bobDecimals, _ := bob.verification.Decimals()
+			So(aliceDecimals, ShouldResemble, bobDecimals)
+
+			aliceEmojis, err := alice.verification.Emojis()
+			So(err, ShouldBeNil)
+			bobEmojis, _ := bob.verification.Emojis()
+			So(aliceEmojis, ShouldResemble, bobEmojis)
+		})
+		Convey("should be done once both sides confirmed.", func() {
+			events, err := alice.verification.Confirm()
+			So(err, ShouldBeNil)
+			deliver(alice.verification, bob.verification, events)
+			So(bob.verification.State(), ShouldEqual, VerificationStateKeysExchanged)
+
+			events, err = bob.verification.Confirm()
+			So(err, ShouldBeNil)
+			deliver(bob.verification, alice.verification, events)
+
+			So(alice.verification.State(), ShouldEqual, VerificationStateDone)
+			So(bob.verification.State(), ShouldEqual, VerificationStateDone)
+			So(alice.verification.VerifiedMasterKey(), ShouldEqual, bob.verification.config.MasterKey)
+			So(bob.verification.VerifiedMasterKey(), ShouldEqual, alice.verification.config.MasterKey)
+		})
+		Convey("should not confirm twice.", func() {
+			alice.verification.Confirm()
+			_, err := alice.verification.Confirm()
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should be cancelled on both sides if rejected.", func() {
+			deliver(bob.verification, alice.verification, bob.verification.Reject())
+
+			So(bob.verification.State(), ShouldEqual, VerificationStateCancelled)
+			So(alice.verification.State(), ShouldEqual, VerificationStateCancelled)
+			So(alice.verification.Cancellation().Code, ShouldEqual, CancelMismatchedSAS)
+		})
+		Convey("should be cancelled after the timeout.", func() {
+			clock.now = clock.now.Add(5 * time.Minute)
+			So(alice.verification.CheckTimeout(), ShouldBeEmpty)
+
+			clock.now = clock.now.Add(DefaultVerificationTimeout)
+			events := alice.verification.CheckTimeout()
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Content.(*VerificationCancel).Code, ShouldEqual, CancelTimeout)
+			So(alice.verification.State(), ShouldEqual, VerificationStateCancelled)
+		})
+		Convey("should ignore events after it was cancelled.", func() {
+			alice.verification.Cancel(CancelUser, "Cancelled by the user")
+			events, _ := bob.verification.Confirm()
+			responses, err := alice.verification.Receive(transmit(events[0]))
+			So(err, ShouldBeNil)
+			So(responses, ShouldBeEmpty)
+		})
+		Convey("should reject events of other transactions.", func() {
+			_, err := alice.verification.Receive(&VerificationEvent{
+				Type:    EventTypeVerificationDone,
+				Content: &VerificationDone{TransactionID: "other"},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSASVerificationFailures(t *testing.T) {
+	Convey("A SAS verification", t, func() {
+		alice, bob, clock := createVerificationPair()
+
+		Convey("should ignore expired requests.", func() {
+			events, _ := alice.verification.Request()
+			clock.now = clock.now.Add(20 * time.Minute)
+			responses, err := bob.verification.Receive(transmit(events[0]))
+			So(err, ShouldBeNil)
+			So(responses, ShouldBeEmpty)
+			So(bob.verification.State(), ShouldEqual, VerificationStateCreated)
+		})
+		Convey("should cancel on unexpected messages.", func() {
+			events, _ := alice.verification.Request()
+			deliver(alice.verification, bob.verification, events)
+
+			responses, err := bob.verification.Receive(&VerificationEvent{
+				Type:    EventTypeVerificationKey,
+				Content: &VerificationKey{TransactionID: alice.verification.TransactionID(), Key: "key"},
+			})
+			So(err, ShouldBeNil)
+			So(responses, ShouldHaveLength, 1)
+			So(responses[0].Content.(*VerificationCancel).Code, ShouldEqual, CancelUnexpectedMessage)
+			So(bob.verification.State(), ShouldEqual, VerificationStateCancelled)
+		})
+		Convey("should cancel unsupported methods.", func() {
+			responses, err := bob.verification.Receive(&VerificationEvent{
+				Type: EventTypeVerificationStart,
+				Content: &VerificationStart{
+					FromDevice:    "ALICE",
+					Method:        VerificationMethodReciprocate,
+					TransactionID: "txn",
+				},
+			})
+			So(err, ShouldBeNil)
+			So(responses[0].Content.(*VerificationCancel).Code, ShouldEqual, CancelUnknownMethod)
+		})
+		Convey("should cancel if the key does not match the commitment.", func() {
+			events, _ := alice.verification.Start()
+			accept, _ := bob.verification.Receive(transmit(events[0]))
+			aliceKey, _ := alice.verification.Receive(transmit(accept[0]))
+			bobKey, _ := bob.verification.Receive(transmit(aliceKey[0]))
+
+			other, _ := NewSAS()
+			bobKey[0].Content.(*VerificationKey).Key = other.PublicKey()
+			responses, err := alice.verification.Receive(transmit(bobKey[0]))
+			So(err, ShouldBeNil)
+			So(responses[0].Content.(*VerificationCancel).Code, ShouldEqual, CancelMismatchedCommitment)
+		})
+		Convey("should cancel if the device key does not match.", func() {
+			otherAccount, _ := NewAccount()
+			otherDevice, _ := NewDeviceKeys(otherAccount, "@alice:example.org", "ALICE")
+			bob.verification.config.TheirDevice = otherDevice
+
+			exchangeKeys(alice.verification, bob.verification)
+			events, _ := alice.verification.Confirm()
+			deliver(alice.verification, bob.verification, events)
+
+			So(bob.verification.State(), ShouldEqual, VerificationStateCancelled)
+			So(bob.verification.Cancellation().Code, ShouldEqual, CancelKeyMismatch)
+			So(alice.verification.State(), ShouldEqual, VerificationStateCancelled)
+		})
+		Convey("should cancel if the device key is unknown.", func() {
+			device := *bob.verification.config.TheirDevice
+			device.Keys = map[string]string{KeyAlgorithmCurve25519 + ":ALICE": device.Curve25519()}
+			bob.verification.config.TheirDevice = &device
+
+			exchangeKeys(alice.verification, bob.verification)
+			events, _ := alice.verification.Confirm()
+			deliver(alice.verification, bob.verification, events)
+
+			So(bob.verification.State(), ShouldEqual, VerificationStateCancelled)
+			So(bob.verification.Cancellation().Code, ShouldEqual, CancelKeyMismatch)
+			So(alice.verification.State(), ShouldEqual, VerificationStateCancelled)
+		})
+		Convey("should not verify an unexpected master key.", func() {
+			other, _ := NewPkSigning()
+			bob.verification.config.TheirMasterKey = other.PublicKey()
+
+			exchangeKeys(alice.verification, bob.verification)
+			events, _ := alice.verification.Confirm()
+			deliver(alice.verification, bob.verification, events)
+			events, _ = bob.verification.Confirm()
+			deliver(bob.verification, alice.verification, events)
+
+			So(bob.verification.State(), ShouldEqual, VerificationStateDone)
+			So(bob.verification.VerifiedMasterKey(), ShouldBeEmpty)
+		})
+	})
+}
+
+// relateVerificationEvent returns the content of the event with an
+// m.relates_to property, as sent for a verification in a room.
+func relateVerificationEvent(event *VerificationEvent) []byte {
+	content, _ := json.Marshal(event.Content)
+	properties := map[string]interface{}{}
+	json.Unmarshal(content, &properties)
+	properties["m.relates_to"] = map[string]string{"rel_type": "m.reference", "event_id": "$event"}
+	content, _ = json.Marshal(properties)
+	return content
+}
+
+// startInRoom starts the verification with a start carrying m.relates_to
+// and exchanges the keys.
+func startInRoom(starter, accepter *SASVerification) {
+	events, err := starter.Start()
+	So(err, ShouldBeNil)
+	content := relateVerificationEvent(events[0])
+	So(starter.SentStart(content), ShouldBeNil)
+
+	start, err := ParseVerificationEvent(EventTypeVerificationStart, content)
+	So(err, ShouldBeNil)
+	accept, err := accepter.Receive(start)
+	So(err, ShouldBeNil)
+	deliver(accepter, starter, accept)
+
+	So(starter.State(), ShouldEqual, VerificationStateKeysExchanged)
+	So(accepter.State(), ShouldEqual, VerificationStateKeysExchanged)
+	starterDecimals, _ := starter.Decimals()
+	accepterDecimals, _ := accepter.Decimals()
+	So(starterDecimals, ShouldResemble, accepterDecimals)
+}
+
+func TestSASVerificationWithoutRequest(t *testing.T) {
+	Convey("A SAS verification started without a request should work.", t, func() {
+		alice, bob, _ := createVerificationPair()
+
+		events, err := alice.verification.Start()
+		So(err, ShouldBeNil)
+		deliver(alice.verification, bob.verification, events)
+
+		aliceDecimals, _ := alice.verification.Decimals()
+		bobDecimals, _ := bob.verification.Decimals()
+		So(aliceDecimals, ShouldResemble, bobDecimals)
+	})
+	Convey("The commitment should cover properties of the start we do not know.", t, func() {
+		alice, bob, _ := createVerificationPair()
+
+		events, _ := alice.verification.Start()
+		content := relateVerificationEvent(events[0])
+		start, _ := ParseVerificationEvent(EventTypeVerificationStart, content)
+
+		accept, err := bob.verification.Receive(start)
+		So(err, ShouldBeNil)
+		canonical, _ := CanonicalJSON(json.RawMessage(content))
+		So(accept[0].Content.(*VerificationAccept).Commitment, ShouldEqual,
+			sasCommitment(bob.verification.sas.PublicKey(), string(canonical)))
+	})
+	Convey("A start sent with m.relates_to should work", t, func() {
+		alice, bob, _ := createVerificationPair()
+
+		Convey("if we start.", func() {
+			startInRoom(alice.verification, bob.verification)
+		})
+		Convey("if they start.", func() {
+			startInRoom(bob.verification, alice.verification)
+		})
+	})
+	Convey("A start sent with m.relates_to should not match the commitment if it is not recorded.", t, func() {
+		alice, bob, _ := createVerificationPair()
+
+		events, _ := alice.verification.Start()
+		start, _ := ParseVerificationEvent(EventTypeVerificationStart, relateVerificationEvent(events[0]))
+		accept, _ := bob.verification.Receive(start)
+		deliver(bob.verification, alice.verification, accept)
+
+		So(alice.verification.State(), ShouldEqual, VerificationStateCancelled)
+		So(alice.verification.Cancellation().Code, ShouldEqual, CancelMismatchedCommitment)
+	})
+	Convey("A recorded start should belong to the verification.", t, func() {
+		alice, _, _ := createVerificationPair()
+
+		So(alice.verification.SentStart([]byte(`{}`)), ShouldNotBeNil)
+		alice.verification.Start()
+		So(alice.verification.SentStart([]byte(`{"transaction_id":"other","method":"m.sas.v1"}`)), ShouldNotBeNil)
+	})
+	Convey("If both sides start, the start of the lower user ID should win.", t, func() {
+		alice, bob, _ := createVerificationPair()
+
+		events, _ := alice.verification.Request()
+		deliver(alice.verification, bob.verification, events)
+		ready, _ := bob.verification.Ready()
+		bobStart, err := bob.verification.Start()
+		So(err, ShouldBeNil)
+		aliceStart, _ := alice.verification.Receive(transmit(ready[0]))
+
+		ignored, err := alice.verification.Receive(transmit(bobStart[0]))
+		So(err, ShouldBeNil)
+		So(ignored, ShouldBeEmpty)
+		deliver(alice.verification, bob.verification, aliceStart)
+
+		So(alice.verification.State(), ShouldEqual, VerificationStateKeysExchanged)
+		So(bob.verification.State(), ShouldEqual, VerificationStateKeysExchanged)
+		So(alice.verification.startedByUs, ShouldBeTrue)
+		So(bob.verification.startedByUs, ShouldBeFalse)
+	})
+}
+
+func TestVerificationStateString(t *testing.T) {
+	Convey("Verification states should have names.", t, func() {
+		So(VerificationStateKeysExchanged.String(), ShouldEqual, "keys exchanged")
+		So(VerificationStateCancelled.String(), ShouldEqual, "cancelled")
+		So(VerificationState(42).String(), ShouldEqual, "VerificationState(42)")
+	})
+}
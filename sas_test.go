@@ -0,0 +1,100 @@
+package golm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createSASPair() (*SAS, *SAS) {
+	alice, _ := NewSAS()
+	bob, _ := NewSAS()
+	alice.SetTheirKey(bob.PublicKey())
+	bob.SetTheirKey(alice.PublicKey())
+	return alice, bob
+}
+
+func TestNewSAS(t *testing.T) {
+	Convey("Creating a SAS should work.", t, func() {
+		s, err := NewSAS()
+		So(err, ShouldBeNil)
+		So(s.PublicKey(), ShouldNotBeEmpty)
+	})
+	Convey("Creating a SAS with the random source faulty should error.", t, func() {
+		ctrl := gomock.NewController(t)
+		mock := NewMockReader(ctrl)
+
+		mock.EXPECT().Read(gomock.Any()).Return(0, errors.New("some error"))
+
+		sw := switchRandSource(mock)
+		defer sw.Revert()
+
+		s, err := NewSAS()
+		So(err, ShouldNotBeNil)
+		So(s, ShouldBeNil)
+	})
+	Convey("Setting an invalid key should fail.", t, func() {
+		s, _ := NewSAS()
+		So(s.SetTheirKey(""), ShouldNotBeNil)
+		So(s.SetTheirKey("invalid"), ShouldNotBeNil)
+	})
+}
+
+func TestSASAgreement(t *testing.T) {
+	Convey("Both sides of a SAS", t, func() {
+		alice, bob := createSASPair()
+
+		Convey("should generate the same bytes.", func() {
+			aliceBytes, err := alice.GenerateBytes("info", 6)
+			So(err, ShouldBeNil)
+			bobBytes, _ := bob.GenerateBytes("info", 6)
+			So(aliceBytes, ShouldResemble, bobBytes)
+
+			otherBytes, _ := bob.GenerateBytes("other", 6)
+			So(otherBytes, ShouldNotResemble, aliceBytes)
+		})
+		Convey("should calculate the same MAC.", func() {
+			aliceMAC, err := alice.CalculateMAC("input", "info")
+			So(err, ShouldBeNil)
+			bobMAC, _ := bob.CalculateMAC("input", "info")
+			So(aliceMAC, ShouldEqual, bobMAC)
+		})
+		Convey("should not calculate anything from empty input.", func() {
+			_, err := alice.GenerateBytes("", 6)
+			So(err, ShouldNotBeNil)
+			_, err = alice.GenerateBytes("info", 0)
+			So(err, ShouldNotBeNil)
+			_, err = alice.CalculateMAC("", "info")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSASRepresentations(t *testing.T) {
+	Convey("Emojis should match known vectors.", t, func() {
+		emojis, err := SASEmojis([]byte{0, 1, 2, 3, 4, 5})
+		So(err, ShouldBeNil)
+
+		descriptions := make([]string, len(emojis))
+		for i, emoji := range emojis {
+			descriptions[i] = emoji.Description
+		}
+		So(descriptions, ShouldResemble, []string{"Dog", "Dog", "Unicorn", "Lion", "Dog", "Hammer", "Tree"})
+	})
+	Convey("Decimals should match known vectors.", t, func() {
+		decimals, err := SASDecimals([]byte{0x12, 0x34, 0x56, 0x78, 0x9A})
+		So(err, ShouldBeNil)
+		So(decimals, ShouldResemble, [3]int{1582, 5441, 8245})
+
+		decimals, _ = SASDecimals([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+		So(decimals, ShouldResemble, [3]int{9191, 9191, 9191})
+	})
+	Convey("Too few bytes should be rejected.", t, func() {
+		_, err := SASEmojis([]byte{1, 2, 3, 4, 5})
+		So(err, ShouldNotBeNil)
+		_, err = SASDecimals([]byte{1, 2, 3, 4})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,406 @@
+package golm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Names of the secrets kept in secret storage.
+const (
+	// SecretCrossSigningMaster is the private master cross-signing key.
+	SecretCrossSigningMaster = "m.cross_signing.master"
+	// SecretCrossSigningSelfSigning is the private self-signing key.
+	SecretCrossSigningSelfSigning = "m.cross_signing.self_signing"
+	// SecretCrossSigningUserSigning is the private user-signing key.
+	SecretCrossSigningUserSigning = "m.cross_signing.user_signing"
+	// SecretMegolmBackupV1 is the private key of the key backup.
+	SecretMegolmBackupV1 = "m.megolm_backup.v1"
+)
+
+// DefaultSecretStorageRounds is the default number of PBKDF2 rounds of a
+// secret storage key derived from a passphrase.
+const DefaultSecretStorageRounds = 500000
+
+// MaxSecretStorageRounds is the highest number of PBKDF2 rounds accepted
+// from a key description, so a crafted description can not lock up the
+// client.
+const MaxSecretStorageRounds = 10 * DefaultSecretStorageRounds
+
+const secretStorageKeyLength = 32
+
+var (
+	// ErrSecretCorrupted is returned if a secret is malformed or was
+	// encrypted with another key.
+	ErrSecretCorrupted = errors.New("secret is corrupted or the key is wrong")
+	// ErrWrongSecretStorageKey is returned if a key does not match the key
+	// description.
+	ErrWrongSecretStorageKey = errors.New("key does not match the secret storage key")
+)
+
+// SecretStoragePassphrase describes how a secret storage key is derived
+// from a passphrase.
+type SecretStoragePassphrase struct {
+	Algorithm  string `json:"algorithm"`
+	Salt       string `json:"salt"`
+	Iterations int    `json:"iterations"`
+	// Bits is the length of the key; zero means 256. Other lengths are
+	// not supported.
+	Bits int `json:"bits,omitempty"`
+}
+
+// SecretStorageKeyDescription describes a secret storage key. IV and MAC
+// are the encryption of 32 zero bytes and allow checking a key without
+// decrypting a secret.
+type SecretStorageKeyDescription struct {
+	Name       string                   `json:"name,omitempty"`
+	Algorithm  string                   `json:"algorithm"`
+	Passphrase *SecretStoragePassphrase `json:"passphrase,omitempty"`
+	IV         string                   `json:"iv,omitempty"`
+	MAC        string                   `json:"mac,omitempty"`
+}
+
+// EncryptedSecret is a secret encrypted with a secret storage key.
+type EncryptedSecret struct {
+	IV         string `json:"iv"`
+	Ciphertext string `json:"ciphertext"`
+	MAC        string `json:"mac"`
+}
+
+// NewSecretStorageKeyDescription describes the key. passphrase may be nil
+// if the key was not derived from a passphrase.
+func NewSecretStorageKeyDescription(name string, key []byte, passphrase *SecretStoragePassphrase) (*SecretStorageKeyDescription, error) {
+	check, err := EncryptSecret(key, "", string(make([]byte, secretStorageKeyLength)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretStorageKeyDescription{
+		Name:       name,
+		Algorithm:  AlgorithmSecretStorageV1,
+		Passphrase: passphrase,
+		IV:         check.IV,
+		MAC:        check.MAC,
+	}, nil
+}
+
+// Check returns ErrWrongSecretStorageKey if the key does not match the
+// description. Descriptions without IV and MAC accept every key.
+func (d *SecretStorageKeyDescription) Check(key []byte) error {
+	if d.Algorithm != AlgorithmSecretStorageV1 {
+		return fmt.Errorf("unexpected algorithm %q", d.Algorithm)
+	}
+	if d.IV == "" && d.MAC == "" {
+		return nil
+	}
+
+	iv, err := base64.StdEncoding.DecodeString(d.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return ErrWrongSecretStorageKey
+	}
+	check, err := encryptSecret(key, "", make([]byte, secretStorageKeyLength), iv)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(check.MAC), []byte(d.MAC)) {
+		return ErrWrongSecretStorageKey
+	}
+	return nil
+}
+
+// KeyFromPassphrase derives the key from the passphrase and checks it.
+func (d *SecretStorageKeyDescription) KeyFromPassphrase(passphrase string) ([]byte, error) {
+	if d.Passphrase == nil {
+		return nil, errors.New("key was not derived from a passphrase")
+	}
+	if d.Passphrase.Algorithm != AlgorithmPBKDF2 {
+		return nil, fmt.Errorf("unexpected passphrase algorithm %q", d.Passphrase.Algorithm)
+	}
+	if d.Passphrase.Iterations <= 0 || d.Passphrase.Iterations > MaxSecretStorageRounds {
+		return nil, fmt.Errorf("iterations must be between 1 and %d", MaxSecretStorageRounds)
+	}
+	if d.Passphrase.Bits != 0 && d.Passphrase.Bits != secretStorageKeyLength*8 {
+		return nil, fmt.Errorf("unsupported key length of %d bits", d.Passphrase.Bits)
+	}
+
+	key := pbkdf2.Key([]byte(passphrase), []byte(d.Passphrase.Salt), d.Passphrase.Iterations, secretStorageKeyLength, sha512.New)
+
+	err := d.Check(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeyFromRecoveryKey decodes the recovery key and checks it.
+func (d *SecretStorageKeyDescription) KeyFromRecoveryKey(recoveryKey string) ([]byte, error) {
+	key, err := DecodeRecoveryKey(recoveryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Check(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncryptSecret encrypts the secret with the key. name is the name of the
+// secret, which is bound to the ciphertext.
+//
+// The AES-256-CTR and HMAC-SHA256 keys are derived from the key with
+// HKDF-SHA256, using 32 zero bytes as salt and the name as info.
+func EncryptSecret(key []byte, name, secret string) (*EncryptedSecret, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	// Some implementations use a 64 bit counter; clearing its top bit
+	// keeps them from overflowing.
+	iv[8] &= 0x7F
+
+	return encryptSecret(key, name, []byte(secret), iv)
+}
+
+// DecryptSecret decrypts the secret with the key. name must be the name
+// the secret was encrypted with.
+func DecryptSecret(key []byte, name string, encrypted *EncryptedSecret) (string, error) {
+	if encrypted == nil {
+		return "", errors.New("encrypted must not be nil")
+	}
+
+	iv, err := base64.StdEncoding.DecodeString(encrypted.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return "", ErrSecretCorrupted
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted.Ciphertext)
+	if err != nil {
+		return "", ErrSecretCorrupted
+	}
+	mac, err := base64.StdEncoding.DecodeString(encrypted.MAC)
+	if err != nil {
+		return "", ErrSecretCorrupted
+	}
+
+	aesKey, macKey, err := secretStorageKeys(key, name)
+	if err != nil {
+		return "", err
+	}
+
+	hash := hmac.New(sha256.New, macKey)
+	hash.Write(ciphertext)
+	if !hmac.Equal(hash.Sum(nil), mac) {
+		return "", ErrSecretCorrupted
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+
+	return string(plaintext), nil
+}
+
+func encryptSecret(key []byte, name string, plaintext, iv []byte) (*EncryptedSecret, error) {
+	aesKey, macKey, err := secretStorageKeys(key, name)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+
+	hash := hmac.New(sha256.New, macKey)
+	hash.Write(ciphertext)
+
+	return &EncryptedSecret{
+		IV:         base64.StdEncoding.EncodeToString(iv),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+		MAC:        base64.StdEncoding.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+func secretStorageKeys(key []byte, name string) (aesKey, macKey []byte, err error) {
+	if len(key) == 0 {
+		return nil, nil, errors.New("key must not be empty")
+	}
+
+	keys := make([]byte, 64)
+	_, err = io.ReadFull(hkdf.New(sha256.New, key, make([]byte, 32), []byte(name)), keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys[:32], keys[32:], nil
+}
+
+// SecretStorage stores secrets encrypted with secret storage keys in a
+// SecretStore.
+type SecretStorage struct {
+	store SecretStore
+}
+
+// NewSecretStorage creates a SecretStorage using the store.
+func NewSecretStorage(store SecretStore) *SecretStorage {
+	return &SecretStorage{store: store}
+}
+
+// CreateKey generates a new random key and makes it the default key. The
+// key should be shown to the user as a recovery key, see
+// EncodeRecoveryKey.
+func (s *SecretStorage) CreateKey(name string) (string, []byte, error) {
+	key := make([]byte, secretStorageKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+
+	keyID, err := s.addKey(name, key, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, key, nil
+}
+
+// CreateKeyFromPassphrase derives a new key from the passphrase with
+// PBKDF2-HMAC-SHA512 and a random salt and makes it the default key.
+func (s *SecretStorage) CreateKeyFromPassphrase(name, passphrase string, rounds int) (string, []byte, error) {
+	if passphrase == "" {
+		return "", nil, errors.New("passphrase must not be empty")
+	}
+	if rounds <= 0 || rounds > MaxSecretStorageRounds {
+		return "", nil, fmt.Errorf("rounds must be between 1 and %d", MaxSecretStorageRounds)
+	}
+
+	salt, err := randomID()
+	if err != nil {
+		return "", nil, err
+	}
+	params := &SecretStoragePassphrase{
+		Algorithm:  AlgorithmPBKDF2,
+		Salt:       salt,
+		Iterations: rounds,
+	}
+	key := pbkdf2.Key([]byte(passphrase), []byte(salt), rounds, secretStorageKeyLength, sha512.New)
+
+	keyID, err := s.addKey(name, key, params)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, key, nil
+}
+
+func (s *SecretStorage) addKey(name string, key []byte, passphrase *SecretStoragePassphrase) (string, error) {
+	keyID, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	description, err := NewSecretStorageKeyDescription(name, key, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.store.SaveSecretStorageKey(keyID, description)
+	if err != nil {
+		return "", err
+	}
+	err = s.store.SetDefaultSecretStorageKey(keyID)
+	if err != nil {
+		return "", err
+	}
+	return keyID, nil
+}
+
+// DefaultKey returns the ID and description of the default key. The ID is
+// empty if there is no default key.
+func (s *SecretStorage) DefaultKey() (string, *SecretStorageKeyDescription, error) {
+	keyID, err := s.store.DefaultSecretStorageKey()
+	if err != nil || keyID == "" {
+		return "", nil, err
+	}
+
+	description, err := s.Key(keyID)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, description, nil
+}
+
+// Key returns the description of the key.
+func (s *SecretStorage) Key(keyID string) (*SecretStorageKeyDescription, error) {
+	description, err := s.store.LoadSecretStorageKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if description == nil {
+		return nil, fmt.Errorf("unknown secret storage key %q", keyID)
+	}
+	return description, nil
+}
+
+// Store encrypts the secret with each of the keys, given by key ID, and
+// stores it, replacing all previously stored encryptions of it.
+func (s *SecretStorage) Store(name, secret string, keys map[string][]byte) error {
+	if name == "" {
+		return errors.New("name must not be empty")
+	}
+	if len(keys) == 0 {
+		return errors.New("keys must not be empty")
+	}
+
+	encrypted := make(map[string]*EncryptedSecret, len(keys))
+	for keyID, key := range keys {
+		description, err := s.Key(keyID)
+		if err != nil {
+			return err
+		}
+		err = description.Check(key)
+		if err != nil {
+			return err
+		}
+
+		encrypted[keyID], err = EncryptSecret(key, name, secret)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.store.SaveSecret(name, encrypted)
+}
+
+// Retrieve decrypts the secret with the key.
+func (s *SecretStorage) Retrieve(name, keyID string, key []byte) (string, error) {
+	description, err := s.Key(keyID)
+	if err != nil {
+		return "", err
+	}
+	err = description.Check(key)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := s.store.LoadSecret(name)
+	if err != nil {
+		return "", err
+	}
+	if encrypted[keyID] == nil {
+		return "", fmt.Errorf("secret %q is not encrypted with key %q", name, keyID)
+	}
+
+	return DecryptSecret(key, name, encrypted[keyID])
+}
@@ -0,0 +1,205 @@
+package golm
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	Convey("Encrypting a secret should match known vectors.", t, func() {
+		encrypted, err := encryptSecret(createSequentialKey(), "m.test", []byte("secret"), make([]byte, 16))
+		So(err, ShouldBeNil)
+		So(encrypted.IV, ShouldEqual, "AAAAAAAAAAAAAAAAAAAAAA==")
+		So(encrypted.Ciphertext, ShouldEqual, "/psF/h1u")
+		So(encrypted.MAC, ShouldEqual, "a3Ng5RnJABEMziNGdNxz4BZMbb7N/5Mgdd0yY/E75f4=")
+	})
+	Convey("An encrypted secret", t, func() {
+		key := createSequentialKey()
+		encrypted, err := EncryptSecret(key, "m.test", "secret")
+		So(err, ShouldBeNil)
+
+		Convey("should have an IV that does not overflow a 64 bit counter.", func() {
+			iv, _ := base64.StdEncoding.DecodeString(encrypted.IV)
+			So(iv[8]&0x80, ShouldEqual, 0)
+		})
+		Convey("should be decrypted with the key.", func() {
+			secret, err := DecryptSecret(key, "m.test", encrypted)
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "secret")
+		})
+		Convey("should not be decrypted with another key.", func() {
+			_, err := DecryptSecret(make([]byte, 32), "m.test", encrypted)
+			So(err, ShouldEqual, ErrSecretCorrupted)
+		})
+		Convey("should not be decrypted under another name.", func() {
+			_, err := DecryptSecret(key, "m.other", encrypted)
+			So(err, ShouldEqual, ErrSecretCorrupted)
+		})
+		Convey("should not be decrypted if tampered with.", func() {
+			encrypted.Ciphertext = base64.StdEncoding.EncodeToString([]byte("public"))
+			_, err := DecryptSecret(key, "m.test", encrypted)
+			So(err, ShouldEqual, ErrSecretCorrupted)
+		})
+	})
+	Convey("Encrypting with a faulty rand source should not work.", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mock := NewMockReader(ctrl)
+		mock.EXPECT().Read(gomock.Any()).Return(0, errors.New("some error"))
+
+		sw := switchRandSource(mock)
+		defer sw.Revert()
+
+		_, err := EncryptSecret(createSequentialKey(), "m.test", "secret")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestSecretStorageKeyDescription(t *testing.T) {
+	Convey("A key description", t, func() {
+		key := createSequentialKey()
+		description, err := NewSecretStorageKeyDescription("key", key, nil)
+		So(err, ShouldBeNil)
+		So(description.Algorithm, ShouldEqual, AlgorithmSecretStorageV1)
+
+		Convey("should accept its key.", func() {
+			So(description.Check(key), ShouldBeNil)
+		})
+		Convey("should reject other keys.", func() {
+			So(description.Check(make([]byte, 32)), ShouldEqual, ErrWrongSecretStorageKey)
+		})
+		Convey("should accept its recovery key.", func() {
+			recoveryKey, _ := EncodeRecoveryKey(key)
+			decoded, err := description.KeyFromRecoveryKey(recoveryKey)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, key)
+		})
+		Convey("should reject other recovery keys.", func() {
+			recoveryKey, _ := EncodeRecoveryKey(make([]byte, 32))
+			_, err := description.KeyFromRecoveryKey(recoveryKey)
+			So(err, ShouldEqual, ErrWrongSecretStorageKey)
+		})
+		Convey("should not derive keys without passphrase parameters.", func() {
+			_, err := description.KeyFromPassphrase("passphrase")
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("A key description with a passphrase", t, func() {
+		key, _ := hex.DecodeString("94797bba727db1f80b8a6bd7fd0f71390897765472887c5eaf8e897f884e2bfd")
+		description, _ := NewSecretStorageKeyDescription("key", key, &SecretStoragePassphrase{
+			Algorithm:  AlgorithmPBKDF2,
+			Salt:       "salt",
+			Iterations: 10,
+		})
+
+		Convey("should derive the key from the passphrase.", func() {
+			derived, err := description.KeyFromPassphrase("passphrase")
+			So(err, ShouldBeNil)
+			So(derived, ShouldResemble, key)
+		})
+		Convey("should reject a wrong passphrase.", func() {
+			_, err := description.KeyFromPassphrase("wrong")
+			So(err, ShouldEqual, ErrWrongSecretStorageKey)
+		})
+		Convey("should reject unknown passphrase algorithms.", func() {
+			description.Passphrase.Algorithm = "m.unknown"
+			_, err := description.KeyFromPassphrase("passphrase")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should accept a key length of 256 bits.", func() {
+			description.Passphrase.Bits = 256
+			derived, err := description.KeyFromPassphrase("passphrase")
+			So(err, ShouldBeNil)
+			So(derived, ShouldResemble, key)
+		})
+		Convey("should reject other key lengths without panicking.", func() {
+			for _, bits := range []int{4, 7, -8, 128, 512} {
+				description.Passphrase.Bits = bits
+				So(func() {
+					_, err := description.KeyFromPassphrase("passphrase")
+					So(err, ShouldNotBeNil)
+				}, ShouldNotPanic)
+			}
+		})
+		Convey("should reject too many iterations.", func() {
+			description.Passphrase.Iterations = MaxSecretStorageRounds + 1
+			_, err := description.KeyFromPassphrase("passphrase")
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("A key description of another algorithm should reject every key.", t, func() {
+		description := &SecretStorageKeyDescription{Algorithm: "m.unknown"}
+		So(description.Check(createSequentialKey()), ShouldNotBeNil)
+	})
+}
+
+func TestSecretStorage(t *testing.T) {
+	Convey("A SecretStorage", t, func() {
+		store := NewMemorySecretStore()
+		storage := NewSecretStorage(store)
+
+		keyID, key, err := storage.CreateKey("key")
+		So(err, ShouldBeNil)
+		So(key, ShouldHaveLength, 32)
+
+		Convey("should make new keys the default.", func() {
+			defaultID, description, err := storage.DefaultKey()
+			So(err, ShouldBeNil)
+			So(defaultID, ShouldEqual, keyID)
+			So(description.Name, ShouldEqual, "key")
+
+			otherID, _, _ := storage.CreateKeyFromPassphrase("other", "passphrase", 10)
+			defaultID, _, _ = storage.DefaultKey()
+			So(defaultID, ShouldEqual, otherID)
+		})
+		Convey("should retrieve stored secrets.", func() {
+			So(storage.Store(SecretMegolmBackupV1, "backup key", map[string][]byte{keyID: key}), ShouldBeNil)
+
+			secret, err := storage.Retrieve(SecretMegolmBackupV1, keyID, key)
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "backup key")
+		})
+		Convey("should store secrets for several keys.", func() {
+			otherID, _, _ := storage.CreateKeyFromPassphrase("other", "passphrase", 10)
+			description, _ := storage.Key(otherID)
+			otherKey, _ := description.KeyFromPassphrase("passphrase")
+
+			err := storage.Store(SecretCrossSigningMaster, "master", map[string][]byte{keyID: key, otherID: otherKey})
+			So(err, ShouldBeNil)
+
+			secret, _ := storage.Retrieve(SecretCrossSigningMaster, keyID, key)
+			So(secret, ShouldEqual, "master")
+			secret, _ = storage.Retrieve(SecretCrossSigningMaster, otherID, otherKey)
+			So(secret, ShouldEqual, "master")
+		})
+		Convey("should not store secrets with a wrong key.", func() {
+			err := storage.Store(SecretMegolmBackupV1, "backup key", map[string][]byte{keyID: make([]byte, 32)})
+			So(err, ShouldEqual, ErrWrongSecretStorageKey)
+		})
+		Convey("should not store secrets for unknown keys.", func() {
+			err := storage.Store(SecretMegolmBackupV1, "backup key", map[string][]byte{"unknown": key})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not retrieve secrets with a wrong key.", func() {
+			storage.Store(SecretMegolmBackupV1, "backup key", map[string][]byte{keyID: key})
+			_, err := storage.Retrieve(SecretMegolmBackupV1, keyID, make([]byte, 32))
+			So(err, ShouldEqual, ErrWrongSecretStorageKey)
+		})
+		Convey("should not retrieve missing secrets.", func() {
+			_, err := storage.Retrieve(SecretMegolmBackupV1, keyID, key)
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("A SecretStorage without keys should have no default key.", t, func() {
+		keyID, description, err := NewSecretStorage(NewMemorySecretStore()).DefaultKey()
+		So(err, ShouldBeNil)
+		So(keyID, ShouldBeEmpty)
+		So(description, ShouldBeNil)
+	})
+}
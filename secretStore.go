@@ -0,0 +1,139 @@
+package golm
+
+import (
+	"errors"
+	"sync"
+)
+
+// SecretStore is where secret storage keeps key descriptions and encrypted
+// secrets. On Matrix this is the account data of the user.
+type SecretStore interface {
+	// LoadSecretStorageKey returns the description of the key or nil if
+	// there is none.
+	LoadSecretStorageKey(keyID string) (*SecretStorageKeyDescription, error)
+	// SaveSecretStorageKey stores the description of the key.
+	SaveSecretStorageKey(keyID string, description *SecretStorageKeyDescription) error
+	// DefaultSecretStorageKey returns the ID of the default key or an empty
+	// string if there is none.
+	DefaultSecretStorageKey() (string, error)
+	// SetDefaultSecretStorageKey makes the key the default key.
+	SetDefaultSecretStorageKey(keyID string) error
+	// LoadSecret returns the secret encrypted for each key by key ID or nil
+	// if there is none.
+	LoadSecret(name string) (map[string]*EncryptedSecret, error)
+	// SaveSecret stores the secret, replacing all previously stored
+	// encryptions of it.
+	SaveSecret(name string, encrypted map[string]*EncryptedSecret) error
+}
+
+// MemorySecretStore is a SecretStore keeping everything in memory. It is
+// safe for concurrent use.
+type MemorySecretStore struct {
+	mutex      sync.Mutex
+	keys       map[string]*SecretStorageKeyDescription
+	defaultKey string
+	secrets    map[string]map[string]*EncryptedSecret
+}
+
+// NewMemorySecretStore creates an empty MemorySecretStore.
+func NewMemorySecretStore() *MemorySecretStore {
+	return &MemorySecretStore{
+		keys:    make(map[string]*SecretStorageKeyDescription),
+		secrets: make(map[string]map[string]*EncryptedSecret),
+	}
+}
+
+// LoadSecretStorageKey returns the description of the key or nil if there
+// is none.
+func (s *MemorySecretStore) LoadSecretStorageKey(keyID string) (*SecretStorageKeyDescription, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	description, ok := s.keys[keyID]
+	if !ok {
+		return nil, nil
+	}
+	return copySecretStorageKeyDescription(description), nil
+}
+
+// SaveSecretStorageKey stores the description of the key.
+func (s *MemorySecretStore) SaveSecretStorageKey(keyID string, description *SecretStorageKeyDescription) error {
+	if keyID == "" {
+		return errors.New("keyID must not be empty")
+	}
+	if description == nil {
+		return errors.New("description must not be nil")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.keys[keyID] = copySecretStorageKeyDescription(description)
+	return nil
+}
+
+// DefaultSecretStorageKey returns the ID of the default key or an empty
+// string if there is none.
+func (s *MemorySecretStore) DefaultSecretStorageKey() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.defaultKey, nil
+}
+
+// SetDefaultSecretStorageKey makes the key the default key.
+func (s *MemorySecretStore) SetDefaultSecretStorageKey(keyID string) error {
+	if keyID == "" {
+		return errors.New("keyID must not be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.defaultKey = keyID
+	return nil
+}
+
+// LoadSecret returns the secret encrypted for each key by key ID or nil if
+// there is none.
+func (s *MemorySecretStore) LoadSecret(name string) (map[string]*EncryptedSecret, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return copyEncryptedSecrets(s.secrets[name]), nil
+}
+
+// SaveSecret stores the secret, replacing all previously stored
+// encryptions of it.
+func (s *MemorySecretStore) SaveSecret(name string, encrypted map[string]*EncryptedSecret) error {
+	if name == "" {
+		return errors.New("name must not be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.secrets[name] = copyEncryptedSecrets(encrypted)
+	return nil
+}
+
+func copySecretStorageKeyDescription(description *SecretStorageKeyDescription) *SecretStorageKeyDescription {
+	copied := *description
+	if description.Passphrase != nil {
+		passphrase := *description.Passphrase
+		copied.Passphrase = &passphrase
+	}
+	return &copied
+}
+
+func copyEncryptedSecrets(encrypted map[string]*EncryptedSecret) map[string]*EncryptedSecret {
+	if encrypted == nil {
+		return nil
+	}
+	copied := make(map[string]*EncryptedSecret, len(encrypted))
+	for keyID, secret := range encrypted {
+		secretCopy := *secret
+		copied[keyID] = &secretCopy
+	}
+	return copied
+}
@@ -0,0 +1,57 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemorySecretStore(t *testing.T) {
+	Convey("A MemorySecretStore", t, func() {
+		store := NewMemorySecretStore()
+
+		Convey("should return nil for unknown keys and secrets.", func() {
+			description, err := store.LoadSecretStorageKey("unknown")
+			So(err, ShouldBeNil)
+			So(description, ShouldBeNil)
+
+			secret, err := store.LoadSecret("unknown")
+			So(err, ShouldBeNil)
+			So(secret, ShouldBeNil)
+		})
+		Convey("should return copies of key descriptions.", func() {
+			description := &SecretStorageKeyDescription{
+				Algorithm:  AlgorithmSecretStorageV1,
+				Passphrase: &SecretStoragePassphrase{Algorithm: AlgorithmPBKDF2, Iterations: 10},
+			}
+			So(store.SaveSecretStorageKey("key", description), ShouldBeNil)
+			description.Passphrase.Iterations = 20
+
+			loaded, _ := store.LoadSecretStorageKey("key")
+			So(loaded.Passphrase.Iterations, ShouldEqual, 10)
+			loaded.Passphrase.Iterations = 30
+
+			loaded, _ = store.LoadSecretStorageKey("key")
+			So(loaded.Passphrase.Iterations, ShouldEqual, 10)
+		})
+		Convey("should replace stored secrets.", func() {
+			store.SaveSecret("secret", map[string]*EncryptedSecret{"a": {Ciphertext: "a"}, "b": {Ciphertext: "b"}})
+			store.SaveSecret("secret", map[string]*EncryptedSecret{"b": {Ciphertext: "c"}})
+
+			loaded, _ := store.LoadSecret("secret")
+			So(loaded, ShouldHaveLength, 1)
+			So(loaded["b"].Ciphertext, ShouldEqual, "c")
+		})
+		Convey("should remember the default key.", func() {
+			So(store.SetDefaultSecretStorageKey("key"), ShouldBeNil)
+			keyID, _ := store.DefaultSecretStorageKey()
+			So(keyID, ShouldEqual, "key")
+		})
+		Convey("should reject empty arguments.", func() {
+			So(store.SaveSecretStorageKey("", &SecretStorageKeyDescription{}), ShouldNotBeNil)
+			So(store.SaveSecretStorageKey("key", nil), ShouldNotBeNil)
+			So(store.SetDefaultSecretStorageKey(""), ShouldNotBeNil)
+			So(store.SaveSecret("", nil), ShouldNotBeNil)
+		})
+	})
+}
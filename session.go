@@ -331,8 +331,11 @@ func (s *Session) Decrypt(typ MessageType, message string) (string, error) {
 		unsafe.Pointer(&plaintextBytes[0]), C.size_t(len(plaintextBytes)),
 	)
 
+	// Messages for another session fail here with BAD_MESSAGE_MAC.
 	err = getError(s, result)
-	panicOnError(err)
+	if err != nil {
+		return "", err
+	}
 
 	return string(plaintextBytes[:result]), nil
 }
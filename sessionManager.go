@@ -0,0 +1,292 @@
+package golm
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoSession is returned if there is no session shared with a peer.
+var ErrNoSession = errors.New("no session shared with the peer")
+
+// SessionManager routes Olm messages to the right session out of all
+// sessions shared with a peer. Sessions are kept in the store ordered by
+// their last use and the most recently used session is used for encryption.
+// It is safe for concurrent use.
+//
+// If both sides create an outbound session at the same time, each of them
+// ends up with two sessions. The manager detects this when a pre-key
+// message of the peer arrives while its own outbound session has not
+// received anything yet, and keeps the session created by the side with
+// the lower identity key for encryption. As both sides apply the same rule
+// they converge on the same session.
+//
+// Messages that were decrypted before and pre-key messages for one time
+// keys that were already used are rejected with ErrReplay.
+type SessionManager struct {
+	mutex   sync.Mutex
+	account *Account
+	store   Store
+	// demoted holds the IDs of sessions that lost a race. They are still
+	// used for decryption but never chosen for encryption.
+	demoted map[string]bool
+	replay  *OlmReplayGuard
+}
+
+// NewSessionManager creates a SessionManager for the given account. Sessions
+// and the account are persisted in the store whenever they change.
+func NewSessionManager(account *Account, store Store) *SessionManager {
+	return &SessionManager{
+		account: account,
+		store:   store,
+		demoted: make(map[string]bool),
+		replay:  NewOlmReplayGuard(account),
+	}
+}
+
+// Account returns the account of the manager.
+func (m *SessionManager) Account() *Account {
+	return m.account
+}
+
+// Sessions returns the sessions shared with the given peer, the most
+// recently used first.
+func (m *SessionManager) Sessions(theirIdentityKey string) ([]*Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.store.LoadSessions(theirIdentityKey)
+}
+
+// PreferredSession returns the session that is used to encrypt messages
+// for the peer, or nil if there is none.
+func (m *SessionManager) PreferredSession(theirIdentityKey string) (*Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sessions, err := m.store.LoadSessions(theirIdentityKey)
+	if err != nil {
+		return nil, err
+	}
+	return m.preferred(sessions), nil
+}
+
+// preferred returns the most recently used session that did not lose
+// a race.
+func (m *SessionManager) preferred(sessions []*Session) *Session {
+	for _, sess := range sessions {
+		if !m.demoted[sess.ID()] {
+			return sess
+		}
+	}
+	if len(sessions) > 0 {
+		return sessions[0]
+	}
+	return nil
+}
+
+// saveUsed stores a session after it was used. If the session lost a race
+// the winner is stored again, so it stays the most recently used one.
+func (m *SessionManager) saveUsed(theirIdentityKey string, sess *Session, sessions []*Session) error {
+	err := m.store.SaveSession(theirIdentityKey, sess)
+	if err != nil || !m.demoted[sess.ID()] {
+		return err
+	}
+
+	preferred := m.preferred(sessions)
+	if preferred == nil || preferred.ID() == sess.ID() {
+		return nil
+	}
+	return m.store.SaveSession(theirIdentityKey, preferred)
+}
+
+// NewOutboundSession creates a new session with the peer and stores it as
+// the most recently used one.
+func (m *SessionManager) NewOutboundSession(theirIdentityKey, theirOneTimeKey string) (*Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sess, err := NewOutboundSession(m.account, theirIdentityKey, theirOneTimeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.store.SaveSession(theirIdentityKey, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// Encrypt encrypts a message for the peer using the most recently used
+// session. Returns ErrNoSession if no session is shared with the peer.
+func (m *SessionManager) Encrypt(theirIdentityKey, plaintext string) (string, MessageType, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sessions, err := m.store.LoadSessions(theirIdentityKey)
+	if err != nil {
+		return "", -1, err
+	}
+	sess := m.preferred(sessions)
+	if sess == nil {
+		return "", -1, ErrNoSession
+	}
+
+	message, typ, err := sess.Encrypt(plaintext)
+	if err != nil {
+		return "", -1, err
+	}
+
+	err = m.store.SaveSession(theirIdentityKey, sess)
+	if err != nil {
+		return "", -1, err
+	}
+
+	return message, typ, nil
+}
+
+// Decrypt decrypts a message from the peer.
+//
+// Pre-key messages are decrypted with the session they were sent on. If
+// there is no such session a new inbound session is created and the one
+// time key it used is removed from the account. Other messages are tried
+// with every session shared with the peer, the most recently used first.
+//
+// The session that decrypted the message becomes the most recently used.
+func (m *SessionManager) Decrypt(theirIdentityKey string, typ MessageType, message string) (string, error) {
+	if theirIdentityKey == "" {
+		return "", errors.New("theirIdentityKey must not be empty")
+	}
+	if message == "" {
+		return "", errors.New("message must not be empty")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	err := m.replay.Check(message)
+	if err != nil {
+		return "", err
+	}
+
+	sessions, err := m.store.LoadSessions(theirIdentityKey)
+	if err != nil {
+		return "", err
+	}
+
+	if typ == MessageTypePreKey {
+		for _, sess := range sessions {
+			matches, err := sess.MatchesInboundSessionFrom(theirIdentityKey, message)
+			if err != nil {
+				return "", err
+			}
+			if matches {
+				return m.decryptWith(theirIdentityKey, sess, sessions, typ, message)
+			}
+		}
+		return m.decryptNewInbound(theirIdentityKey, sessions, message)
+	}
+
+	if len(sessions) == 0 {
+		return "", ErrNoSession
+	}
+
+	var lastErr error
+	for _, sess := range sessions {
+		plaintext, err := sess.Decrypt(typ, message)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		err = m.saveUsed(theirIdentityKey, sess, sessions)
+		if err != nil {
+			return "", err
+		}
+		m.replay.Remember(message)
+		return plaintext, nil
+	}
+
+	return "", lastErr
+}
+
+func (m *SessionManager) decryptWith(theirIdentityKey string, sess *Session, sessions []*Session, typ MessageType, message string) (string, error) {
+	plaintext, err := sess.Decrypt(typ, message)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.saveUsed(theirIdentityKey, sess, sessions)
+	if err != nil {
+		return "", err
+	}
+	m.replay.Remember(message)
+	return plaintext, nil
+}
+
+func (m *SessionManager) decryptNewInbound(theirIdentityKey string, sessions []*Session, message string) (string, error) {
+	sess, err := m.replay.NewInboundSessionFrom(theirIdentityKey, message)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := sess.Decrypt(MessageTypePreKey, message)
+	if err != nil {
+		return "", err
+	}
+	// Only now the message is authenticated and its one time key may be
+	// consumed.
+	err = m.replay.Consume(message)
+	if err != nil {
+		return "", err
+	}
+
+	// The session is saved before the one time key is gone from the
+	// stored account, so a crash in between can not lose the session.
+	err = m.store.SaveSession(theirIdentityKey, sess)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.resolveRace(theirIdentityKey, sess, sessions)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.account.RemoveOneTimeKeys(sess)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.store.SaveAccount(m.account)
+	if err != nil {
+		return "", err
+	}
+	m.replay.Remember(message)
+	return plaintext, nil
+}
+
+// resolveRace checks if the new inbound session raced with an outbound
+// session of ours. Our outbound sessions are the only ones that have not
+// received a message yet. The session created by the side with the lower
+// identity key wins.
+func (m *SessionManager) resolveRace(theirIdentityKey string, inbound *Session, sessions []*Session) error {
+	var outbound *Session
+	for _, sess := range sessions {
+		if !sess.HasReceivedMessage() && !m.demoted[sess.ID()] {
+			outbound = sess
+			break
+		}
+	}
+	if outbound == nil {
+		return nil
+	}
+
+	if m.account.IdentityKeys().Curve25519 < theirIdentityKey {
+		m.demoted[inbound.ID()] = true
+		return m.store.SaveSession(theirIdentityKey, outbound)
+	}
+	m.demoted[outbound.ID()] = true
+	return nil
+}
@@ -0,0 +1,162 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createSessionManager() *SessionManager {
+	acc, _ := NewAccount()
+	acc.GenerateOneTimeKeys(4)
+
+	store := NewMemoryStore()
+	store.SaveAccount(acc)
+
+	return NewSessionManager(acc, store)
+}
+
+func TestSessionManagerRoundTrip(t *testing.T) {
+	Convey("Messages between two managers", t, func() {
+		alice := createSessionManager()
+		bob := createSessionManager()
+		aliceKey := alice.Account().IdentityKeys().Curve25519
+		bobKey := bob.Account().IdentityKeys().Curve25519
+
+		_, err := alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+		So(err, ShouldBeNil)
+
+		message, typ, err := alice.Encrypt(bobKey, "hello bob")
+		So(err, ShouldBeNil)
+		So(typ, ShouldEqual, MessageTypePreKey)
+
+		Convey("should create an inbound session on the first pre key message.", func() {
+			keysBefore := bob.Account().OneTimeKeys().Size()
+
+			plaintext, err := bob.Decrypt(aliceKey, typ, message)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "hello bob")
+
+			sessions, _ := bob.Sessions(aliceKey)
+			So(sessions, ShouldHaveLength, 1)
+			So(bob.Account().OneTimeKeys().Size(), ShouldEqual, keysBefore-1)
+
+			Convey("and reuse it for further pre key messages.", func() {
+				message, typ, _ := alice.Encrypt(bobKey, "hello again")
+				plaintext, err := bob.Decrypt(aliceKey, typ, message)
+				So(err, ShouldBeNil)
+				So(plaintext, ShouldEqual, "hello again")
+
+				sessions, _ := bob.Sessions(aliceKey)
+				So(sessions, ShouldHaveLength, 1)
+			})
+			Convey("and route replies back.", func() {
+				reply, typ, err := bob.Encrypt(aliceKey, "hello alice")
+				So(err, ShouldBeNil)
+
+				plaintext, err := alice.Decrypt(bobKey, typ, reply)
+				So(err, ShouldBeNil)
+				So(plaintext, ShouldEqual, "hello alice")
+			})
+		})
+	})
+}
+
+func TestSessionManagerOrdering(t *testing.T) {
+	alice := createSessionManager()
+	bob := createSessionManager()
+	bobKey := bob.Account().IdentityKeys().Curve25519
+
+	Convey("Encrypting should use the most recently used session.", t, func() {
+		first, _ := alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+		second, _ := alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(1))
+
+		sessions, _ := alice.Sessions(bobKey)
+		So(sessions[0].ID(), ShouldEqual, second.ID())
+		So(sessions[1].ID(), ShouldEqual, first.ID())
+	})
+}
+
+func TestSessionManagerErrors(t *testing.T) {
+	manager := createSessionManager()
+
+	Convey("Encrypting without a session should return ErrNoSession.", t, func() {
+		_, _, err := manager.Encrypt("unknown", "plaintext")
+		So(err, ShouldEqual, ErrNoSession)
+	})
+	Convey("Decrypting a message without a session should return ErrNoSession.", t, func() {
+		_, err := manager.Decrypt("unknown", MessageTypeMessage, "message")
+		So(err, ShouldEqual, ErrNoSession)
+	})
+	Convey("Decrypting an invalid pre key message should not work.", t, func() {
+		_, err := manager.Decrypt("unknown", MessageTypePreKey, "message")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Decrypting empty input should not panic.", t, func() {
+		So(func() {
+			manager.Decrypt("", MessageTypePreKey, "")
+		}, ShouldNotPanic)
+	})
+}
+
+func TestSessionManagerRace(t *testing.T) {
+	Convey("When both sides create a session at the same time", t, func() {
+		alice := createSessionManager()
+		bob := createSessionManager()
+		aliceKey := alice.Account().IdentityKeys().Curve25519
+		bobKey := bob.Account().IdentityKeys().Curve25519
+
+		alice.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+		bob.NewOutboundSession(aliceKey, alice.Account().OneTimeKeys().Curve(0))
+
+		toBob, toBobType, _ := alice.Encrypt(bobKey, "hello bob")
+		toAlice, toAliceType, _ := bob.Encrypt(aliceKey, "hello alice")
+
+		Convey("and the messages cross", func() {
+			_, err := bob.Decrypt(aliceKey, toBobType, toBob)
+			So(err, ShouldBeNil)
+			_, err = alice.Decrypt(bobKey, toAliceType, toAlice)
+			So(err, ShouldBeNil)
+
+			Convey("both should prefer the same session.", func() {
+				aliceSess, _ := alice.PreferredSession(bobKey)
+				bobSess, _ := bob.PreferredSession(aliceKey)
+				So(aliceSess.ID(), ShouldEqual, bobSess.ID())
+			})
+			Convey("both should keep it while talking.", func() {
+				for i := 0; i < 3; i++ {
+					message, typ, err := alice.Encrypt(bobKey, "ping")
+					So(err, ShouldBeNil)
+					_, err = bob.Decrypt(aliceKey, typ, message)
+					So(err, ShouldBeNil)
+
+					message, typ, err = bob.Encrypt(aliceKey, "pong")
+					So(err, ShouldBeNil)
+					_, err = alice.Decrypt(bobKey, typ, message)
+					So(err, ShouldBeNil)
+				}
+
+				aliceSess, _ := alice.PreferredSession(bobKey)
+				bobSess, _ := bob.PreferredSession(aliceKey)
+				So(aliceSess.ID(), ShouldEqual, bobSess.ID())
+			})
+		})
+		Convey("and one side keeps sending before it sees the other message", func() {
+			_, err := alice.Decrypt(bobKey, toAliceType, toAlice)
+			So(err, ShouldBeNil)
+
+			again, againType, _ := bob.Encrypt(aliceKey, "still there?")
+			_, err = alice.Decrypt(bobKey, againType, again)
+			So(err, ShouldBeNil)
+
+			_, err = bob.Decrypt(aliceKey, toBobType, toBob)
+			So(err, ShouldBeNil)
+
+			Convey("both should still prefer the same session.", func() {
+				aliceSess, _ := alice.PreferredSession(bobKey)
+				bobSess, _ := bob.PreferredSession(aliceKey)
+				So(aliceSess.ID(), ShouldEqual, bobSess.ID())
+			})
+		})
+	})
+}
@@ -0,0 +1,182 @@
+package golm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureThreshold is the default number of consecutive
+	// decryption failures after which the sessions with a peer are
+	// considered wedged.
+	DefaultFailureThreshold = 1
+	// DefaultRecoveryInterval is the default minimum time between two
+	// recovery attempts for the same peer.
+	DefaultRecoveryInterval = time.Hour
+)
+
+// OneTimeKeyFunc returns a fresh one time key of the peer with the given
+// identity key, usually by claiming it from the server.
+type OneTimeKeyFunc func(theirIdentityKey string) (string, error)
+
+// SessionReplacement reports a session that was created to recover from
+// wedged sessions.
+type SessionReplacement struct {
+	TheirIdentityKey string
+	// OldSessionID is the ID of the session that was used for encryption
+	// before, empty if there was none.
+	OldSessionID string
+	// NewSession is the new session. It is the most recently used session
+	// now, so the next message to the peer is sent on it. A message (e.g.
+	// an m.dummy event) should be sent right away, so the peer learns
+	// about the new session.
+	NewSession *Session
+}
+
+// SessionRecovery tracks decryption failures per peer and creates a new
+// outbound session once the sessions with a peer seem to be wedged.
+// It is safe for concurrent use.
+type SessionRecovery struct {
+	// FailureThreshold is the number of consecutive decryption failures
+	// after which a new session is created.
+	FailureThreshold int
+	// Interval is the minimum time between two recovery attempts for the
+	// same peer.
+	Interval time.Duration
+
+	manager  *SessionManager
+	claimKey OneTimeKeyFunc
+	now      func() time.Time
+
+	mutex       sync.Mutex
+	failures    map[string]int
+	lastAttempt map[string]time.Time
+}
+
+// NewSessionRecovery creates a SessionRecovery for the sessions of the
+// manager, using claimKey to get fresh one time keys.
+func NewSessionRecovery(manager *SessionManager, claimKey OneTimeKeyFunc) *SessionRecovery {
+	return &SessionRecovery{
+		FailureThreshold: DefaultFailureThreshold,
+		Interval:         DefaultRecoveryInterval,
+		manager:          manager,
+		claimKey:         claimKey,
+		now:              time.Now,
+		failures:         make(map[string]int),
+		lastAttempt:      make(map[string]time.Time),
+	}
+}
+
+// Failures returns the number of consecutive decryption failures of the peer.
+func (r *SessionRecovery) Failures(theirIdentityKey string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.failures[theirIdentityKey]
+}
+
+// ReportSuccess resets the failure count of the peer.
+func (r *SessionRecovery) ReportSuccess(theirIdentityKey string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.failures, theirIdentityKey)
+}
+
+// ReportFailure records a decryption failure of a message from the peer.
+// If the failure threshold is reached and the last attempt was long enough
+// ago a new session is created and returned. Otherwise nil is returned.
+func (r *SessionRecovery) ReportFailure(theirIdentityKey string) (*SessionReplacement, error) {
+	if theirIdentityKey == "" {
+		return nil, errors.New("theirIdentityKey must not be empty")
+	}
+
+	r.mutex.Lock()
+	r.failures[theirIdentityKey]++
+	if r.failures[theirIdentityKey] < r.FailureThreshold {
+		r.mutex.Unlock()
+		return nil, nil
+	}
+	now := r.now()
+	if last, ok := r.lastAttempt[theirIdentityKey]; ok && now.Sub(last) < r.Interval {
+		r.mutex.Unlock()
+		return nil, nil
+	}
+	// The attempt counts even if it fails, so an unreachable peer is
+	// not asked for keys over and over again.
+	r.lastAttempt[theirIdentityKey] = now
+	r.mutex.Unlock()
+
+	replacement, err := r.recover(theirIdentityKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	delete(r.failures, theirIdentityKey)
+	r.mutex.Unlock()
+
+	return replacement, nil
+}
+
+func (r *SessionRecovery) recover(theirIdentityKey string) (*SessionReplacement, error) {
+	old, err := r.manager.PreferredSession(theirIdentityKey)
+	if err != nil {
+		return nil, err
+	}
+
+	oneTimeKey, err := r.claimKey(theirIdentityKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := r.manager.NewOutboundSession(theirIdentityKey, oneTimeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement := &SessionReplacement{
+		TheirIdentityKey: theirIdentityKey,
+		NewSession:       sess,
+	}
+	if old != nil {
+		replacement.OldSessionID = old.ID()
+	}
+	return replacement, nil
+}
+
+// isSessionFailure tells whether err was returned by libolm because the
+// sessions could not decrypt a message, as opposed to e.g. a store error,
+// a malformed message or a missing session.
+func isSessionFailure(err error) bool {
+	switch err.Error() {
+	case "BAD_MESSAGE_MAC", "BAD_MESSAGE_KEY_ID":
+		return true
+	}
+	return false
+}
+
+// Decrypt decrypts a message from the peer using the manager and reports
+// the outcome. If the sessions fail to decrypt the message and are
+// considered wedged, a replacement session is returned along with the
+// decryption error. Other errors are returned without counting as failure.
+func (r *SessionRecovery) Decrypt(theirIdentityKey string, typ MessageType, message string) (string, *SessionReplacement, error) {
+	plaintext, err := r.manager.Decrypt(theirIdentityKey, typ, message)
+	if err == nil {
+		r.ReportSuccess(theirIdentityKey)
+		return plaintext, nil, nil
+	}
+	// Replayed messages, store errors and the like say nothing about the
+	// state of the sessions.
+	if !isSessionFailure(err) {
+		return "", nil, err
+	}
+
+	replacement, recoveryErr := r.ReportFailure(theirIdentityKey)
+	if recoveryErr != nil {
+		return "", nil, fmt.Errorf("%v (recovery failed: %v)", err, recoveryErr)
+	}
+	return "", replacement, err
+}
@@ -0,0 +1,160 @@
+package golm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func createSessionRecovery(peer *SessionManager) (*SessionRecovery, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	recovery := NewSessionRecovery(createSessionManager(), func(theirIdentityKey string) (string, error) {
+		return peer.Account().OneTimeKeys().Curve(0), nil
+	})
+	recovery.now = clock.Now
+	return recovery, clock
+}
+
+func TestSessionRecoveryThreshold(t *testing.T) {
+	Convey("With a failure threshold of 2", t, func() {
+		bob := createSessionManager()
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		recovery, _ := createSessionRecovery(bob)
+		recovery.FailureThreshold = 2
+
+		Convey("the first failure should not recover.", func() {
+			replacement, err := recovery.ReportFailure(bobKey)
+			So(err, ShouldBeNil)
+			So(replacement, ShouldBeNil)
+			So(recovery.Failures(bobKey), ShouldEqual, 1)
+		})
+		Convey("the second failure should create a new session.", func() {
+			recovery.ReportFailure(bobKey)
+			replacement, err := recovery.ReportFailure(bobKey)
+			So(err, ShouldBeNil)
+			So(replacement, ShouldNotBeNil)
+			So(replacement.OldSessionID, ShouldBeEmpty)
+			So(recovery.Failures(bobKey), ShouldEqual, 0)
+
+			sessions, _ := recovery.manager.Sessions(bobKey)
+			So(sessions[0].ID(), ShouldEqual, replacement.NewSession.ID())
+		})
+		Convey("a success in between should reset the count.", func() {
+			recovery.ReportFailure(bobKey)
+			recovery.ReportSuccess(bobKey)
+			replacement, _ := recovery.ReportFailure(bobKey)
+			So(replacement, ShouldBeNil)
+		})
+	})
+}
+
+func TestSessionRecoveryRateLimit(t *testing.T) {
+	Convey("Recovering twice", t, func() {
+		bob := createSessionManager()
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		recovery, clock := createSessionRecovery(bob)
+
+		first, _ := recovery.ReportFailure(bobKey)
+		So(first, ShouldNotBeNil)
+
+		Convey("within the interval should not create another session.", func() {
+			clock.now = clock.now.Add(recovery.Interval / 2)
+			replacement, err := recovery.ReportFailure(bobKey)
+			So(err, ShouldBeNil)
+			So(replacement, ShouldBeNil)
+		})
+		Convey("after the interval should replace the previous session.", func() {
+			clock.now = clock.now.Add(recovery.Interval)
+			replacement, err := recovery.ReportFailure(bobKey)
+			So(err, ShouldBeNil)
+			So(replacement, ShouldNotBeNil)
+			So(replacement.OldSessionID, ShouldEqual, first.NewSession.ID())
+		})
+	})
+}
+
+func TestSessionRecoveryClaimFailure(t *testing.T) {
+	Convey("A failing key claim should be reported and rate limited.", t, func() {
+		recovery := NewSessionRecovery(createSessionManager(), func(string) (string, error) {
+			return "", errors.New("unreachable")
+		})
+
+		replacement, err := recovery.ReportFailure("peer")
+		So(err, ShouldNotBeNil)
+		So(replacement, ShouldBeNil)
+
+		replacement, err = recovery.ReportFailure("peer")
+		So(err, ShouldBeNil)
+		So(replacement, ShouldBeNil)
+	})
+}
+
+func TestSessionRecoveryDecrypt(t *testing.T) {
+	Convey("Decrypting a message the session can not decrypt", t, func() {
+		bob := createSessionManager()
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		recovery, _ := createSessionRecovery(bob)
+		aliceKey := recovery.manager.Account().IdentityKeys().Curve25519
+
+		recovery.manager.NewOutboundSession(bobKey, bob.Account().OneTimeKeys().Curve(0))
+		message, typ, _ := recovery.manager.Encrypt(bobKey, "hello bob")
+		bob.Decrypt(aliceKey, typ, message)
+		reply, typ, _ := bob.Encrypt(aliceKey, "hello alice")
+
+		// Altering the MAC at the end of the message makes it fail with
+		// BAD_MESSAGE_MAC.
+		altered := []byte(reply)
+		if altered[len(altered)-2] == 'A' {
+			altered[len(altered)-2] = 'B'
+		} else {
+			altered[len(altered)-2] = 'A'
+		}
+
+		_, replacement, err := recovery.Decrypt(bobKey, typ, string(altered))
+
+		Convey("should return the decryption error and a replacement.", func() {
+			So(err, ShouldNotBeNil)
+			So(replacement, ShouldNotBeNil)
+		})
+		Convey("should lead to a session the peer can decrypt.", func() {
+			message, typ, err := recovery.manager.Encrypt(bobKey, "m.dummy")
+			So(err, ShouldBeNil)
+			So(typ, ShouldEqual, MessageTypePreKey)
+
+			plaintext, err := bob.Decrypt(aliceKey, typ, message)
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "m.dummy")
+		})
+	})
+	Convey("Decrypting without a shared session should not recover.", t, func() {
+		bob := createSessionManager()
+		bobKey := bob.Account().IdentityKeys().Curve25519
+		recovery, _ := createSessionRecovery(bob)
+
+		_, replacement, err := recovery.Decrypt(bobKey, MessageTypeMessage, "garbage")
+		So(err, ShouldEqual, ErrNoSession)
+		So(replacement, ShouldBeNil)
+		So(recovery.Failures(bobKey), ShouldEqual, 0)
+	})
+}
+
+func TestIsSessionFailure(t *testing.T) {
+	Convey("Only decryption failures of the sessions should count.", t, func() {
+		So(isSessionFailure(errors.New("BAD_MESSAGE_MAC")), ShouldBeTrue)
+		So(isSessionFailure(errors.New("BAD_MESSAGE_KEY_ID")), ShouldBeTrue)
+		So(isSessionFailure(errors.New("BAD_MESSAGE_FORMAT")), ShouldBeFalse)
+		So(isSessionFailure(ErrNoSession), ShouldBeFalse)
+		So(isSessionFailure(ErrReplay), ShouldBeFalse)
+		So(isSessionFailure(errors.New("disk full")), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,118 @@
+package golm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Signatures maps user IDs to key IDs to signatures, as found in the
+// signatures property of signed JSON objects.
+type Signatures map[string]map[string]string
+
+// set adds a signature, allocating the maps as needed.
+func (s *Signatures) set(userID, keyID, signature string) {
+	if *s == nil {
+		*s = make(Signatures)
+	}
+	if (*s)[userID] == nil {
+		(*s)[userID] = make(map[string]string)
+	}
+	(*s)[userID][keyID] = signature
+}
+
+// ErrSignatureMissing is returned if a signed JSON object does not carry
+// the signature that was asked for.
+var ErrSignatureMissing = errors.New("signature missing")
+
+// ED25519KeyID returns the key ID of an ed25519 key, e.g. "ed25519:DEVICE".
+func ED25519KeyID(id string) string {
+	return KeyAlgorithmED25519 + ":" + id
+}
+
+// SignJSON signs the JSON object obj with the ed25519 key of the account.
+// The signature is calculated over the canonical JSON of obj without its
+// signatures and unsigned properties and added to the returned copy of obj
+// as signatures[userID]["ed25519:"+deviceID]. Signatures already present
+// in obj are kept.
+func SignJSON(account *Account, userID, deviceID string, obj interface{}) (map[string]interface{}, error) {
+	if userID == "" || deviceID == "" {
+		return nil, errors.New("userID and deviceID must not be empty")
+	}
+	return signJSON(obj, userID, ED25519KeyID(deviceID), account.Sign)
+}
+
+func signJSON(obj interface{}, userID, keyID string, sign func(message string) (string, error)) (map[string]interface{}, error) {
+	object, err := jsonObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures, _ := object["signatures"].(map[string]interface{})
+	if signatures == nil {
+		signatures = make(map[string]interface{})
+	}
+	unsigned, hasUnsigned := object["unsigned"]
+	delete(object, "signatures")
+	delete(object, "unsigned")
+
+	canonical, err := CanonicalJSON(object)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := sign(string(canonical))
+	if err != nil {
+		return nil, err
+	}
+
+	userSignatures, _ := signatures[userID].(map[string]interface{})
+	if userSignatures == nil {
+		userSignatures = make(map[string]interface{})
+		signatures[userID] = userSignatures
+	}
+	userSignatures[keyID] = signature
+
+	object["signatures"] = signatures
+	if hasUnsigned {
+		object["unsigned"] = unsigned
+	}
+	return object, nil
+}
+
+// VerifySignedJSON verifies the signature signatures[userID][keyID] of the
+// JSON object obj against the given ed25519 key. keyID is the full key ID,
+// e.g. "ed25519:DEVICE". Returns ErrSignatureMissing if there is no such
+// signature.
+func VerifySignedJSON(obj interface{}, userID, keyID, ed25519Key string) error {
+	object, err := jsonObject(obj)
+	if err != nil {
+		return err
+	}
+
+	signature := signatureOf(object, userID, keyID)
+	if signature == "" {
+		return ErrSignatureMissing
+	}
+
+	delete(object, "signatures")
+	delete(object, "unsigned")
+
+	canonical, err := CanonicalJSON(object)
+	if err != nil {
+		return err
+	}
+
+	err = NewUtility().ED25519Verify(ed25519Key, string(canonical), signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature by %s of %s: %v", keyID, userID, err)
+	}
+	return nil
+}
+
+// signatureOf returns the signature signatures[userID][keyID] of a decoded
+// JSON object or an empty string if there is none.
+func signatureOf(object map[string]interface{}, userID, keyID string) string {
+	signatures, _ := object["signatures"].(map[string]interface{})
+	userSignatures, _ := signatures[userID].(map[string]interface{})
+	signature, _ := userSignatures[keyID].(string)
+	return signature
+}
@@ -0,0 +1,66 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSignJSON(t *testing.T) {
+	acc, _ := NewAccount()
+	key := acc.IdentityKeys().ED25519
+	obj := map[string]interface{}{
+		"device_id": "DEVICE",
+		"unsigned":  map[string]interface{}{"device_display_name": "phone"},
+		"signatures": map[string]interface{}{
+			"@other:example.org": map[string]interface{}{"ed25519:OTHER": "sig"},
+		},
+	}
+
+	Convey("Signing a JSON object", t, func() {
+		signed, err := SignJSON(acc, "@user:example.org", "DEVICE", obj)
+
+		Convey("should work.", func() {
+			So(err, ShouldBeNil)
+		})
+		Convey("should add the signature and keep everything else.", func() {
+			signatures := signed["signatures"].(map[string]interface{})
+			So(signatures["@user:example.org"], ShouldContainKey, "ed25519:DEVICE")
+			So(signatures["@other:example.org"], ShouldContainKey, "ed25519:OTHER")
+			So(signed["unsigned"], ShouldNotBeNil)
+		})
+		Convey("should not modify the original object.", func() {
+			So(obj["signatures"], ShouldNotContainKey, "@user:example.org")
+		})
+		Convey("should be verifiable.", func() {
+			So(VerifySignedJSON(signed, "@user:example.org", "ed25519:DEVICE", key), ShouldBeNil)
+		})
+		Convey("should be verifiable after changing unsigned.", func() {
+			signed["unsigned"] = "changed"
+			So(VerifySignedJSON(signed, "@user:example.org", "ed25519:DEVICE", key), ShouldBeNil)
+		})
+		Convey("should not be verifiable after changing the content.", func() {
+			signed["device_id"] = "OTHER"
+			So(VerifySignedJSON(signed, "@user:example.org", "ed25519:DEVICE", key), ShouldNotBeNil)
+		})
+		Convey("should not be verifiable with another key.", func() {
+			other, _ := NewAccount()
+			So(VerifySignedJSON(signed, "@user:example.org", "ed25519:DEVICE", other.IdentityKeys().ED25519), ShouldNotBeNil)
+		})
+	})
+	Convey("Signing with empty IDs should not work.", t, func() {
+		_, err := SignJSON(acc, "", "", obj)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Signing something that is not an object should not work.", t, func() {
+		_, err := SignJSON(acc, "@user:example.org", "DEVICE", []string{"a"})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestVerifySignedJSON(t *testing.T) {
+	Convey("Verifying an object without the signature should return ErrSignatureMissing.", t, func() {
+		err := VerifySignedJSON([]byte(`{"a":1}`), "@user:example.org", "ed25519:DEVICE", "key")
+		So(err, ShouldEqual, ErrSignatureMissing)
+	})
+}
@@ -0,0 +1,121 @@
+package golm
+
+import "time"
+
+// AccountStore persists the Account of a device.
+type AccountStore interface {
+	// LoadAccount returns the stored account or nil if no account
+	// was stored yet.
+	LoadAccount() (*Account, error)
+	// SaveAccount stores the account, replacing any previously stored account.
+	SaveAccount(account *Account) error
+}
+
+// SessionStore persists Olm sessions grouped by the Curve25519 identity
+// key of the peer they are shared with.
+type SessionStore interface {
+	// SessionPeers returns the identity keys of all peers that sessions
+	// are stored for.
+	SessionPeers() ([]string, error)
+	// LoadSessions returns the sessions shared with the given peer. The
+	// most recently saved session comes first.
+	LoadSessions(theirIdentityKey string) ([]*Session, error)
+	// SaveSession stores the session, replacing a stored session with the
+	// same ID.
+	SaveSession(theirIdentityKey string, sess *Session) error
+}
+
+// InboundGroupSessionEntry is an inbound group session together with
+// the information about where it came from.
+type InboundGroupSessionEntry struct {
+	Session *InboundGroupSession
+	// RoomID is the room the session is used in.
+	RoomID string
+	// SenderKey is the Curve25519 identity key of the device that created
+	// the session.
+	SenderKey string
+	// SigningKey is the ed25519 key the device that created the session
+	// claims to own.
+	SigningKey string
+	// ForwardingChain holds the Curve25519 identity keys of the devices
+	// that forwarded the session, the last one being the device it was
+	// received from. It is empty if the session was received from the
+	// device that created it.
+	ForwardingChain []string
+}
+
+// Forwarded returns whether the session was forwarded by another device
+// than the one that created it.
+func (e *InboundGroupSessionEntry) Forwarded() bool {
+	return len(e.ForwardingChain) > 0
+}
+
+// InboundGroupSessionStore persists inbound group sessions by their ID.
+type InboundGroupSessionStore interface {
+	// InboundGroupSessionIDs returns the IDs of all stored sessions.
+	InboundGroupSessionIDs() ([]string, error)
+	// LoadInboundGroupSession returns the session with the given ID or nil
+	// if there is no such session.
+	LoadInboundGroupSession(sessionID string) (*InboundGroupSessionEntry, error)
+	// SaveInboundGroupSession stores the session, replacing a stored session
+	// with the same ID.
+	SaveInboundGroupSession(entry *InboundGroupSessionEntry) error
+}
+
+// OutboundGroupSessionEntry is an outbound group session together with
+// the room it is used in.
+type OutboundGroupSessionEntry struct {
+	Session *OutboundGroupSession
+	// RoomID is the room the session is used in.
+	RoomID string
+	// CreatedAt is the time the session was created.
+	CreatedAt time.Time
+	// Rotate is set if the session must be replaced before it is used
+	// again.
+	Rotate RotationReason
+	// Shares are the devices the key of the session was sent to.
+	Shares []RoomKeyShare
+}
+
+// OutboundGroupSessionStore persists the outbound group session of each room.
+type OutboundGroupSessionStore interface {
+	// OutboundGroupSessionRooms returns the IDs of all rooms a session is
+	// stored for.
+	OutboundGroupSessionRooms() ([]string, error)
+	// LoadOutboundGroupSession returns the session of the given room or nil
+	// if there is no such session.
+	LoadOutboundGroupSession(roomID string) (*OutboundGroupSessionEntry, error)
+	// SaveOutboundGroupSession stores the session, replacing the stored
+	// session of the same room.
+	SaveOutboundGroupSession(entry *OutboundGroupSessionEntry) error
+}
+
+// MegolmIndexRecord identifies the event a Megolm message index was first
+// seen in.
+type MegolmIndexRecord struct {
+	EventID string
+	// Timestamp is the origin_server_ts of the event in milliseconds.
+	Timestamp int64
+}
+
+// MegolmIndexStore persists which event each message index of an inbound
+// group session was decrypted from.
+type MegolmIndexStore interface {
+	// LoadMegolmIndex returns the record of the message index of the session
+	// or nil if the index was not seen yet.
+	LoadMegolmIndex(sessionID string, index uint32) (*MegolmIndexRecord, error)
+	// SaveMegolmIndex stores the record of the message index of the session.
+	SaveMegolmIndex(sessionID string, index uint32, record MegolmIndexRecord) error
+	// MegolmIndices returns the records of all message indices of the
+	// session that were seen.
+	MegolmIndices(sessionID string) (map[uint32]MegolmIndexRecord, error)
+}
+
+// Store persists the complete cryptographic state of a device.
+type Store interface {
+	AccountStore
+	SessionStore
+	InboundGroupSessionStore
+	OutboundGroupSessionStore
+	MegolmIndexStore
+}
@@ -0,0 +1,766 @@
+package golm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// A vault is a single encrypted archive of everything a device owns.
+//
+// The file starts with an unencrypted preamble:
+//
+//     magic "GOLMVLT" | format version (1 byte) | salt (16 bytes) |
+//     PBKDF2 rounds (4 bytes, big endian) | IV (16 bytes)
+//
+// The key is derived from the passphrase with PBKDF2-HMAC-SHA512 and split
+// into an AES-256 key and an HMAC-SHA256 key. Vaults with more than ten
+// times the default rounds are rejected. The rest of the file is a
+// sequence of frames, each of them
+//
+//     flags (1 byte) | length (4 bytes, big endian) | ciphertext | MAC (32 bytes)
+//
+// The ciphertexts of all frames form one AES-CTR stream. The MAC of each
+// frame covers the MAC of the previous frame (or the preamble for the first
+// frame) as well as flags, length and ciphertext of the frame itself, so
+// frames can neither be altered nor reordered. The last frame carries the
+// final flag, which makes truncation detectable.
+//
+// The decrypted stream is a sequence of JSON values: a header followed by
+// one record per account, session or list of seen Megolm message indices.
+
+const (
+	// VaultVersion is the version of the vault format written by this package.
+	VaultVersion = 1
+
+	vaultMagic      = "GOLMVLT"
+	vaultSaltSize   = 16
+	vaultRounds     = 100000
+	vaultMaxRounds  = 10 * vaultRounds
+	vaultFrameSize  = 64 * 1024
+	vaultFinalFrame = 0x01
+
+	vaultRecordAccount              = "account"
+	vaultRecordSession              = "session"
+	vaultRecordInboundGroupSession  = "inbound_group_session"
+	vaultRecordOutboundGroupSession = "outbound_group_session"
+	vaultRecordMegolmIndices        = "megolm_indices"
+)
+
+// ErrVaultCorrupted is returned if a vault was altered, truncated or the
+// passphrase is wrong.
+var ErrVaultCorrupted = errors.New("vault is corrupted or the passphrase is wrong")
+
+// ErrVaultAccountMismatch is returned when importing a vault of an account
+// that differs from the account already present.
+var ErrVaultAccountMismatch = errors.New("vault contains a different account")
+
+// VaultHeader describes a vault.
+type VaultHeader struct {
+	// Version is the version of the vault format.
+	Version int `json:"version"`
+	// Created is the time the vault was created.
+	Created time.Time `json:"created"`
+	// Metadata holds arbitrary application data.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type vaultHeaderRecord struct {
+	VaultHeader
+	PickleKey string `json:"pickle_key"`
+}
+
+type vaultRecord struct {
+	Type             string             `json:"type"`
+	Pickle           string             `json:"pickle"`
+	TheirIdentityKey string             `json:"their_identity_key,omitempty"`
+	RoomID           string             `json:"room_id,omitempty"`
+	SenderKey        string             `json:"sender_key,omitempty"`
+	SigningKey       string             `json:"signing_key,omitempty"`
+	ForwardingChain  []string           `json:"forwarding_chain,omitempty"`
+	CreatedAt        *time.Time         `json:"created_at,omitempty"`
+	Rotate           RotationReason     `json:"rotate,omitempty"`
+	Shares           []RoomKeyShare     `json:"shares,omitempty"`
+	SessionID        string             `json:"session_id,omitempty"`
+	Indices          []vaultMegolmIndex `json:"indices,omitempty"`
+}
+
+type vaultMegolmIndex struct {
+	Index     uint32 `json:"index"`
+	EventID   string `json:"event_id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// VaultRecord is a single item read from a vault. Exactly one of
+// Account, Session, InboundGroupSession, OutboundGroupSession and
+// MegolmIndices is set.
+type VaultRecord struct {
+	Account *Account
+	// TheirIdentityKey is the identity key of the peer Session is shared with.
+	TheirIdentityKey     string
+	Session              *Session
+	InboundGroupSession  *InboundGroupSessionEntry
+	OutboundGroupSession *OutboundGroupSessionEntry
+	// SessionID is the ID of the inbound group session MegolmIndices
+	// belong to.
+	SessionID     string
+	MegolmIndices map[uint32]MegolmIndexRecord
+}
+
+func vaultKeys(passphrase string, salt []byte, rounds uint32) (aesKey, macKey []byte) {
+	key := pbkdf2.Key([]byte(passphrase), salt, int(rounds), 64, sha512.New)
+	return key[:32], key[32:]
+}
+
+// vaultFrameWriter encrypts and authenticates everything written to it.
+type vaultFrameWriter struct {
+	w      io.Writer
+	stream cipher.Stream
+	macKey []byte
+	mac    []byte
+	buf    []byte
+}
+
+func (fw *vaultFrameWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		free := vaultFrameSize - len(fw.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		fw.buf = append(fw.buf, p[:free]...)
+		p = p[free:]
+
+		if len(fw.buf) == vaultFrameSize {
+			if err := fw.flush(0); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (fw *vaultFrameWriter) flush(flags byte) error {
+	frameHeader := make([]byte, 5)
+	frameHeader[0] = flags
+	binary.BigEndian.PutUint32(frameHeader[1:], uint32(len(fw.buf)))
+
+	ciphertext := make([]byte, len(fw.buf))
+	fw.stream.XORKeyStream(ciphertext, fw.buf)
+	fw.buf = fw.buf[:0]
+
+	mac := hmac.New(sha256.New, fw.macKey)
+	mac.Write(fw.mac)
+	mac.Write(frameHeader)
+	mac.Write(ciphertext)
+	fw.mac = mac.Sum(nil)
+
+	for _, part := range [][]byte{frameHeader, ciphertext, fw.mac} {
+		if _, err := fw.w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the final frame.
+func (fw *vaultFrameWriter) Close() error {
+	return fw.flush(vaultFinalFrame)
+}
+
+// vaultFrameReader verifies and decrypts frames written by vaultFrameWriter.
+type vaultFrameReader struct {
+	r      io.Reader
+	stream cipher.Stream
+	macKey []byte
+	mac    []byte
+	buf    []byte
+	final  bool
+}
+
+func (fr *vaultFrameReader) Read(p []byte) (int, error) {
+	for len(fr.buf) == 0 {
+		if fr.final {
+			return 0, io.EOF
+		}
+		if err := fr.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[n:]
+	return n, nil
+}
+
+func (fr *vaultFrameReader) next() error {
+	frameHeader := make([]byte, 5)
+	if _, err := io.ReadFull(fr.r, frameHeader); err != nil {
+		return ErrVaultCorrupted
+	}
+	length := binary.BigEndian.Uint32(frameHeader[1:])
+	if length > vaultFrameSize {
+		return ErrVaultCorrupted
+	}
+
+	ciphertext := make([]byte, length)
+	frameMAC := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(fr.r, ciphertext); err != nil {
+		return ErrVaultCorrupted
+	}
+	if _, err := io.ReadFull(fr.r, frameMAC); err != nil {
+		return ErrVaultCorrupted
+	}
+
+	mac := hmac.New(sha256.New, fr.macKey)
+	mac.Write(fr.mac)
+	mac.Write(frameHeader)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), frameMAC) {
+		return ErrVaultCorrupted
+	}
+	fr.mac = frameMAC
+
+	fr.buf = make([]byte, length)
+	fr.stream.XORKeyStream(fr.buf, ciphertext)
+	fr.final = frameHeader[0]&vaultFinalFrame != 0
+	return nil
+}
+
+// VaultWriter writes a vault. Records are encrypted as they are written,
+// so a vault of any size can be written without holding it in memory.
+type VaultWriter struct {
+	frames    *vaultFrameWriter
+	encoder   *json.Encoder
+	pickleKey string
+}
+
+// NewVaultWriter starts a new vault on w, encrypted with the given
+// passphrase. The metadata is stored in the header of the vault.
+func NewVaultWriter(w io.Writer, passphrase string, metadata map[string]string) (*VaultWriter, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	random := make([]byte, vaultSaltSize+aes.BlockSize+32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	salt := random[:vaultSaltSize]
+	iv := random[vaultSaltSize : vaultSaltSize+aes.BlockSize]
+	pickleKey := base64.RawStdEncoding.EncodeToString(random[vaultSaltSize+aes.BlockSize:])
+
+	preamble := bytes.NewBufferString(vaultMagic)
+	preamble.WriteByte(VaultVersion)
+	preamble.Write(salt)
+	binary.Write(preamble, binary.BigEndian, uint32(vaultRounds))
+	preamble.Write(iv)
+
+	aesKey, macKey := vaultKeys(passphrase, salt, vaultRounds)
+	block, err := aes.NewCipher(aesKey)
+	panicOnError(err)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(preamble.Bytes())
+
+	if _, err := w.Write(preamble.Bytes()); err != nil {
+		return nil, err
+	}
+
+	frames := &vaultFrameWriter{
+		w:      w,
+		stream: cipher.NewCTR(block, iv),
+		macKey: macKey,
+		mac:    mac.Sum(nil),
+	}
+	vw := &VaultWriter{
+		frames:    frames,
+		encoder:   json.NewEncoder(frames),
+		pickleKey: pickleKey,
+	}
+
+	err = vw.encoder.Encode(&vaultHeaderRecord{
+		VaultHeader: VaultHeader{
+			Version:  VaultVersion,
+			Created:  time.Now().UTC(),
+			Metadata: metadata,
+		},
+		PickleKey: pickleKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vw, nil
+}
+
+// WriteAccount adds the account to the vault.
+func (vw *VaultWriter) WriteAccount(account *Account) error {
+	if account == nil {
+		return errors.New("account must not be nil")
+	}
+
+	pickle, err := account.Pickle(vw.pickleKey)
+	if err != nil {
+		return err
+	}
+	return vw.encoder.Encode(&vaultRecord{
+		Type:   vaultRecordAccount,
+		Pickle: pickle,
+	})
+}
+
+// WriteSession adds a session shared with the given peer to the vault.
+func (vw *VaultWriter) WriteSession(theirIdentityKey string, sess *Session) error {
+	if theirIdentityKey == "" {
+		return errors.New("theirIdentityKey must not be empty")
+	}
+	if sess == nil {
+		return errors.New("session must not be nil")
+	}
+
+	pickle, err := sess.Pickle(vw.pickleKey)
+	if err != nil {
+		return err
+	}
+	return vw.encoder.Encode(&vaultRecord{
+		Type:             vaultRecordSession,
+		Pickle:           pickle,
+		TheirIdentityKey: theirIdentityKey,
+	})
+}
+
+// WriteInboundGroupSession adds an inbound group session to the vault.
+func (vw *VaultWriter) WriteInboundGroupSession(entry *InboundGroupSessionEntry) error {
+	if entry == nil || entry.Session == nil {
+		return errors.New("session must not be nil")
+	}
+
+	pickle, err := entry.Session.Pickle(vw.pickleKey)
+	if err != nil {
+		return err
+	}
+	return vw.encoder.Encode(&vaultRecord{
+		Type:            vaultRecordInboundGroupSession,
+		Pickle:          pickle,
+		RoomID:          entry.RoomID,
+		SenderKey:       entry.SenderKey,
+		SigningKey:      entry.SigningKey,
+		ForwardingChain: entry.ForwardingChain,
+	})
+}
+
+// WriteOutboundGroupSession adds an outbound group session to the vault.
+func (vw *VaultWriter) WriteOutboundGroupSession(entry *OutboundGroupSessionEntry) error {
+	if entry == nil || entry.Session == nil {
+		return errors.New("session must not be nil")
+	}
+
+	pickle, err := entry.Session.Pickle(vw.pickleKey)
+	if err != nil {
+		return err
+	}
+	record := &vaultRecord{
+		Type:   vaultRecordOutboundGroupSession,
+		Pickle: pickle,
+		RoomID: entry.RoomID,
+		Rotate: entry.Rotate,
+		Shares: entry.Shares,
+	}
+	if !entry.CreatedAt.IsZero() {
+		record.CreatedAt = &entry.CreatedAt
+	}
+	return vw.encoder.Encode(record)
+}
+
+// WriteMegolmIndices adds the seen message indices of an inbound group
+// session to the vault.
+func (vw *VaultWriter) WriteMegolmIndices(sessionID string, indices map[uint32]MegolmIndexRecord) error {
+	if sessionID == "" {
+		return errors.New("sessionID must not be empty")
+	}
+
+	sorted := make([]int, 0, len(indices))
+	for index := range indices {
+		sorted = append(sorted, int(index))
+	}
+	sort.Ints(sorted)
+
+	record := &vaultRecord{
+		Type:      vaultRecordMegolmIndices,
+		SessionID: sessionID,
+		Indices:   make([]vaultMegolmIndex, 0, len(indices)),
+	}
+	for _, index := range sorted {
+		indexRecord := indices[uint32(index)]
+		record.Indices = append(record.Indices, vaultMegolmIndex{
+			Index:     uint32(index),
+			EventID:   indexRecord.EventID,
+			Timestamp: indexRecord.Timestamp,
+		})
+	}
+	return vw.encoder.Encode(record)
+}
+
+// Close finishes the vault. It does not close the underlying writer.
+// A vault that was not closed can not be read.
+func (vw *VaultWriter) Close() error {
+	return vw.frames.Close()
+}
+
+// VaultReader reads a vault record by record, verifying the integrity
+// of the data before it is returned.
+type VaultReader struct {
+	// Header is the header of the vault.
+	Header VaultHeader
+
+	decoder   *json.Decoder
+	pickleKey string
+}
+
+// NewVaultReader opens the vault in r, decrypting it with the given passphrase.
+func NewVaultReader(r io.Reader, passphrase string) (*VaultReader, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	preamble := make([]byte, len(vaultMagic)+1+vaultSaltSize+4+aes.BlockSize)
+	if _, err := io.ReadFull(r, preamble); err != nil {
+		return nil, errors.New("not a vault")
+	}
+	if string(preamble[:len(vaultMagic)]) != vaultMagic {
+		return nil, errors.New("not a vault")
+	}
+	version := preamble[len(vaultMagic)]
+	if version != VaultVersion {
+		return nil, fmt.Errorf("unsupported vault version %d", version)
+	}
+
+	rest := preamble[len(vaultMagic)+1:]
+	salt := rest[:vaultSaltSize]
+	rounds := binary.BigEndian.Uint32(rest[vaultSaltSize:])
+	iv := rest[vaultSaltSize+4:]
+	if rounds == 0 || rounds > vaultMaxRounds {
+		return nil, ErrVaultCorrupted
+	}
+
+	aesKey, macKey := vaultKeys(passphrase, salt, rounds)
+	block, err := aes.NewCipher(aesKey)
+	panicOnError(err)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(preamble)
+
+	decoder := json.NewDecoder(&vaultFrameReader{
+		r:      r,
+		stream: cipher.NewCTR(block, iv),
+		macKey: macKey,
+		mac:    mac.Sum(nil),
+	})
+
+	header := vaultHeaderRecord{}
+	if err := decoder.Decode(&header); err != nil {
+		return nil, vaultDecodeError(err)
+	}
+	if header.PickleKey == "" {
+		return nil, ErrVaultCorrupted
+	}
+
+	return &VaultReader{
+		Header:    header.VaultHeader,
+		decoder:   decoder,
+		pickleKey: header.PickleKey,
+	}, nil
+}
+
+func vaultDecodeError(err error) error {
+	if err == ErrVaultCorrupted {
+		return err
+	}
+	return fmt.Errorf("invalid vault record: %v", err)
+}
+
+// Next returns the next record of the vault. Once all records have been
+// read it returns io.EOF.
+func (vr *VaultReader) Next() (*VaultRecord, error) {
+	record := vaultRecord{}
+	if err := vr.decoder.Decode(&record); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, vaultDecodeError(err)
+	}
+
+	switch record.Type {
+	case vaultRecordAccount:
+		account, err := UnpickleAccount(vr.pickleKey, record.Pickle)
+		if err != nil {
+			return nil, err
+		}
+		return &VaultRecord{Account: account}, nil
+
+	case vaultRecordSession:
+		sess, err := UnpickleSession(vr.pickleKey, record.Pickle)
+		if err != nil {
+			return nil, err
+		}
+		return &VaultRecord{
+			TheirIdentityKey: record.TheirIdentityKey,
+			Session:          sess,
+		}, nil
+
+	case vaultRecordInboundGroupSession:
+		sess, err := UnpickleInboundGroupSession(vr.pickleKey, record.Pickle)
+		if err != nil {
+			return nil, err
+		}
+		return &VaultRecord{
+			InboundGroupSession: &InboundGroupSessionEntry{
+				Session:         sess,
+				RoomID:          record.RoomID,
+				SenderKey:       record.SenderKey,
+				SigningKey:      record.SigningKey,
+				ForwardingChain: record.ForwardingChain,
+			},
+		}, nil
+
+	case vaultRecordOutboundGroupSession:
+		sess, err := UnpickleOutboundGroupSession(vr.pickleKey, record.Pickle)
+		if err != nil {
+			return nil, err
+		}
+		entry := &OutboundGroupSessionEntry{
+			Session: sess,
+			RoomID:  record.RoomID,
+			Rotate:  record.Rotate,
+			Shares:  record.Shares,
+		}
+		if record.CreatedAt != nil {
+			entry.CreatedAt = *record.CreatedAt
+		}
+		return &VaultRecord{OutboundGroupSession: entry}, nil
+
+	case vaultRecordMegolmIndices:
+		if record.SessionID == "" {
+			return nil, ErrVaultCorrupted
+		}
+		indices := make(map[uint32]MegolmIndexRecord, len(record.Indices))
+		for _, index := range record.Indices {
+			indices[index.Index] = MegolmIndexRecord{
+				EventID:   index.EventID,
+				Timestamp: index.Timestamp,
+			}
+		}
+		return &VaultRecord{
+			SessionID:     record.SessionID,
+			MegolmIndices: indices,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown vault record type %q", record.Type)
+}
+
+// ExportVault writes everything held by the store into a vault on w,
+// encrypted with the given passphrase.
+func ExportVault(w io.Writer, passphrase string, store Store, metadata map[string]string) error {
+	vw, err := NewVaultWriter(w, passphrase, metadata)
+	if err != nil {
+		return err
+	}
+
+	account, err := store.LoadAccount()
+	if err != nil {
+		return err
+	}
+	if account != nil {
+		if err := vw.WriteAccount(account); err != nil {
+			return err
+		}
+	}
+
+	peers, err := store.SessionPeers()
+	if err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		sessions, err := store.LoadSessions(peer)
+		if err != nil {
+			return err
+		}
+		// Oldest first, so that importing restores the order.
+		for i := len(sessions) - 1; i >= 0; i-- {
+			if err := vw.WriteSession(peer, sessions[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	ids, err := store.InboundGroupSessionIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		entry, err := store.LoadInboundGroupSession(id)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := vw.WriteInboundGroupSession(entry); err != nil {
+			return err
+		}
+
+		indices, err := store.MegolmIndices(id)
+		if err != nil {
+			return err
+		}
+		if len(indices) == 0 {
+			continue
+		}
+		if err := vw.WriteMegolmIndices(id, indices); err != nil {
+			return err
+		}
+	}
+
+	rooms, err := store.OutboundGroupSessionRooms()
+	if err != nil {
+		return err
+	}
+	for _, roomID := range rooms {
+		entry, err := store.LoadOutboundGroupSession(roomID)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := vw.WriteOutboundGroupSession(entry); err != nil {
+			return err
+		}
+	}
+
+	return vw.Close()
+}
+
+// ImportVault reads the vault in r and merges its contents into the store.
+// State already present in the store is never replaced: sessions are only
+// added if the store does not know them yet and the account is only
+// imported if the store has none. Importing a vault of another account
+// fails with ErrVaultAccountMismatch. Inbound group sessions the store
+// already has are merged with MergeInboundGroupSession, keeping the stored
+// copy if the two conflict. Seen Megolm message indices are added unless
+// the store has a record of the same index.
+//
+// Records are merged as soon as they have been verified. If the vault
+// turns out to be truncated, the records before the damage stay imported.
+func ImportVault(r io.Reader, passphrase string, store Store) (*VaultHeader, error) {
+	vr, err := NewVaultReader(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		record, err := vr.Next()
+		if err == io.EOF {
+			return &vr.Header, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case record.Account != nil:
+			err = importVaultAccount(store, record.Account)
+		case record.Session != nil:
+			err = importVaultSession(store, record.TheirIdentityKey, record.Session)
+		case record.InboundGroupSession != nil:
+			err = importVaultInboundGroupSession(store, record.InboundGroupSession)
+		case record.OutboundGroupSession != nil:
+			err = importVaultOutboundGroupSession(store, record.OutboundGroupSession)
+		case record.MegolmIndices != nil:
+			err = importVaultMegolmIndices(store, record.SessionID, record.MegolmIndices)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func importVaultAccount(store AccountStore, account *Account) error {
+	existing, err := store.LoadAccount()
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return store.SaveAccount(account)
+	}
+	if *existing.IdentityKeys() != *account.IdentityKeys() {
+		return ErrVaultAccountMismatch
+	}
+	return nil
+}
+
+func importVaultSession(store SessionStore, theirIdentityKey string, sess *Session) error {
+	existing, err := store.LoadSessions(theirIdentityKey)
+	if err != nil {
+		return err
+	}
+	id := sess.ID()
+	for _, s := range existing {
+		if s.ID() == id {
+			return nil
+		}
+	}
+	return store.SaveSession(theirIdentityKey, sess)
+}
+
+func importVaultInboundGroupSession(store InboundGroupSessionStore, entry *InboundGroupSessionEntry) error {
+	_, err := MergeInboundGroupSession(store, entry)
+	if err == ErrGroupSessionConflict {
+		return nil
+	}
+	return err
+}
+
+func importVaultOutboundGroupSession(store OutboundGroupSessionStore, entry *OutboundGroupSessionEntry) error {
+	existing, err := store.LoadOutboundGroupSession(entry.RoomID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	return store.SaveOutboundGroupSession(entry)
+}
+
+func importVaultMegolmIndices(store MegolmIndexStore, sessionID string, indices map[uint32]MegolmIndexRecord) error {
+	for index, record := range indices {
+		existing, err := store.LoadMegolmIndex(sessionID, index)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		err = store.SaveMegolmIndex(sessionID, index, record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package golm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createFilledStore() *MemoryStore {
+	store := NewMemoryStore()
+
+	sess, from, to := createOutboundSession()
+	store.SaveAccount(from)
+	store.SaveSession(to.IdentityKeys().Curve25519, sess)
+
+	out, in := createOutAndInboundGroupSession()
+	store.SaveInboundGroupSession(&InboundGroupSessionEntry{
+		Session:   in,
+		RoomID:    "!room:example.org",
+		SenderKey: from.IdentityKeys().Curve25519,
+	})
+	store.SaveMegolmIndex(in.ID(), 0, MegolmIndexRecord{EventID: "$event", Timestamp: 1500000000000})
+	store.SaveOutboundGroupSession(&OutboundGroupSessionEntry{
+		Session:   out,
+		RoomID:    "!room:example.org",
+		CreatedAt: time.Unix(1500000000, 0).UTC(),
+		Rotate:    RotationMemberLeft,
+	})
+
+	return store
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	store := createFilledStore()
+	buf := &bytes.Buffer{}
+	err := ExportVault(buf, "passphrase", store, map[string]string{"device_id": "DEVICE"})
+
+	Convey("Exporting a vault should work.", t, func() {
+		So(err, ShouldBeNil)
+		So(buf.Len(), ShouldBeGreaterThan, 0)
+	})
+	Convey("Importing a vault into an empty store", t, func() {
+		restored := NewMemoryStore()
+		header, err := ImportVault(bytes.NewReader(buf.Bytes()), "passphrase", restored)
+
+		Convey("should work.", func() {
+			So(err, ShouldBeNil)
+			So(header.Version, ShouldEqual, VaultVersion)
+			So(header.Metadata["device_id"], ShouldEqual, "DEVICE")
+		})
+		Convey("should restore the account.", func() {
+			orig, _ := store.LoadAccount()
+			acc, _ := restored.LoadAccount()
+			So(acc, ShouldNotBeNil)
+			So(*acc.IdentityKeys(), ShouldResemble, *orig.IdentityKeys())
+		})
+		Convey("should restore the sessions.", func() {
+			peers, _ := store.SessionPeers()
+			origSessions, _ := store.LoadSessions(peers[0])
+			sessions, _ := restored.LoadSessions(peers[0])
+			So(sessions, ShouldHaveLength, 1)
+			So(sessions[0].ID(), ShouldEqual, origSessions[0].ID())
+		})
+		Convey("should restore the group sessions.", func() {
+			ids, _ := restored.InboundGroupSessionIDs()
+			So(ids, ShouldHaveLength, 1)
+			entry, _ := restored.LoadInboundGroupSession(ids[0])
+			So(entry.RoomID, ShouldEqual, "!room:example.org")
+
+			outbound, _ := restored.LoadOutboundGroupSession("!room:example.org")
+			So(outbound, ShouldNotBeNil)
+			So(outbound.CreatedAt.Equal(time.Unix(1500000000, 0)), ShouldBeTrue)
+			So(outbound.Rotate, ShouldEqual, RotationMemberLeft)
+		})
+		Convey("should restore the seen message indices.", func() {
+			ids, _ := restored.InboundGroupSessionIDs()
+			record, err := restored.LoadMegolmIndex(ids[0], 0)
+			So(err, ShouldBeNil)
+			So(record, ShouldNotBeNil)
+			So(*record, ShouldResemble, MegolmIndexRecord{EventID: "$event", Timestamp: 1500000000000})
+		})
+	})
+}
+
+func TestVaultImportMerges(t *testing.T) {
+	store := createFilledStore()
+	buf := &bytes.Buffer{}
+	ExportVault(buf, "passphrase", store, nil)
+
+	Convey("Importing a vault", t, func() {
+		Convey("into a store of the same account should keep the existing state.", func() {
+			target := NewMemoryStore()
+			acc, _ := store.LoadAccount()
+			target.SaveAccount(acc)
+			existing, _ := createOutAndInboundGroupSession()
+			target.SaveOutboundGroupSession(&OutboundGroupSessionEntry{Session: existing, RoomID: "!room:example.org"})
+
+			_, err := ImportVault(bytes.NewReader(buf.Bytes()), "passphrase", target)
+			So(err, ShouldBeNil)
+
+			loaded, _ := target.LoadAccount()
+			So(loaded, ShouldEqual, acc)
+			outbound, _ := target.LoadOutboundGroupSession("!room:example.org")
+			So(outbound.Session, ShouldEqual, existing)
+			ids, _ := target.InboundGroupSessionIDs()
+			So(ids, ShouldHaveLength, 1)
+		})
+		Convey("should keep message indices the store already saw.", func() {
+			target := NewMemoryStore()
+			ids, _ := store.InboundGroupSessionIDs()
+			target.SaveMegolmIndex(ids[0], 0, MegolmIndexRecord{EventID: "$other"})
+
+			_, err := ImportVault(bytes.NewReader(buf.Bytes()), "passphrase", target)
+			So(err, ShouldBeNil)
+			record, _ := target.LoadMegolmIndex(ids[0], 0)
+			So(record.EventID, ShouldEqual, "$other")
+		})
+		Convey("into a store of another account should not work.", func() {
+			target := NewMemoryStore()
+			other, _ := NewAccount()
+			target.SaveAccount(other)
+
+			_, err := ImportVault(bytes.NewReader(buf.Bytes()), "passphrase", target)
+			So(err, ShouldEqual, ErrVaultAccountMismatch)
+		})
+	})
+}
+
+func TestVaultIntegrity(t *testing.T) {
+	store := createFilledStore()
+	buf := &bytes.Buffer{}
+	ExportVault(buf, "passphrase", store, nil)
+	data := buf.Bytes()
+
+	Convey("Reading a vault", t, func() {
+		Convey("with the wrong passphrase should not work.", func() {
+			_, err := ImportVault(bytes.NewReader(data), "wrong", NewMemoryStore())
+			So(err, ShouldEqual, ErrVaultCorrupted)
+		})
+		Convey("that was altered should not work.", func() {
+			altered := make([]byte, len(data))
+			copy(altered, data)
+			altered[len(altered)-40] ^= 0x01
+
+			_, err := ImportVault(bytes.NewReader(altered), "passphrase", NewMemoryStore())
+			So(err, ShouldEqual, ErrVaultCorrupted)
+		})
+		Convey("that was truncated should not work.", func() {
+			_, err := ImportVault(bytes.NewReader(data[:len(data)-1]), "passphrase", NewMemoryStore())
+			So(err, ShouldEqual, ErrVaultCorrupted)
+		})
+		Convey("with too many rounds should not work.", func() {
+			altered := make([]byte, len(data))
+			copy(altered, data)
+			binary.BigEndian.PutUint32(altered[len(vaultMagic)+1+vaultSaltSize:], 0xFFFFFFFF)
+
+			_, err := ImportVault(bytes.NewReader(altered), "passphrase", NewMemoryStore())
+			So(err, ShouldEqual, ErrVaultCorrupted)
+		})
+		Convey("that is no vault should not work.", func() {
+			_, err := NewVaultReader(bytes.NewReader([]byte("garbage")), "passphrase")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("with an empty passphrase should not panic.", func() {
+			So(func() {
+				NewVaultReader(bytes.NewReader(data), "")
+			}, ShouldNotPanic)
+		})
+	})
+}
+
+func TestVaultFrames(t *testing.T) {
+	Convey("Data larger than a frame should survive a round trip.", t, func() {
+		metadata := map[string]string{"large": string(bytes.Repeat([]byte("a"), 3*vaultFrameSize))}
+		buf := &bytes.Buffer{}
+
+		vw, err := NewVaultWriter(buf, "passphrase", metadata)
+		So(err, ShouldBeNil)
+		So(vw.Close(), ShouldBeNil)
+
+		vr, err := NewVaultReader(bytes.NewReader(buf.Bytes()), "passphrase")
+		So(err, ShouldBeNil)
+		So(vr.Header.Metadata["large"], ShouldEqual, metadata["large"])
+	})
+}
@@ -0,0 +1,180 @@
+package golm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event types of interactive key verification.
+const (
+	EventTypeVerificationRequest = "m.key.verification.request"
+	EventTypeVerificationReady   = "m.key.verification.ready"
+	EventTypeVerificationStart   = "m.key.verification.start"
+	EventTypeVerificationAccept  = "m.key.verification.accept"
+	EventTypeVerificationKey     = "m.key.verification.key"
+	EventTypeVerificationMAC     = "m.key.verification.mac"
+	EventTypeVerificationDone    = "m.key.verification.done"
+	EventTypeVerificationCancel  = "m.key.verification.cancel"
+)
+
+const (
+	// VerificationMethodSAS is the name of the SAS verification method.
+	VerificationMethodSAS = "m.sas.v1"
+	// VerificationMethodReciprocate is the method of the start event sent
+	// after scanning a QR code.
+	VerificationMethodReciprocate = "m.reciprocate.v1"
+)
+
+// Codes of m.key.verification.cancel events.
+const (
+	CancelUser                 = "m.user"
+	CancelTimeout              = "m.timeout"
+	CancelUnknownTransaction   = "m.unknown_transaction"
+	CancelUnknownMethod        = "m.unknown_method"
+	CancelUnexpectedMessage    = "m.unexpected_message"
+	CancelKeyMismatch          = "m.key_mismatch"
+	CancelUserMismatch         = "m.user_mismatch"
+	CancelInvalidMessage       = "m.invalid_message"
+	CancelAccepted             = "m.accepted"
+	CancelMismatchedCommitment = "m.mismatched_commitment"
+	CancelMismatchedSAS        = "m.mismatched_sas"
+)
+
+// VerificationRequest is the content of an m.key.verification.request
+// event.
+type VerificationRequest struct {
+	FromDevice    string   `json:"from_device"`
+	Methods       []string `json:"methods"`
+	Timestamp     int64    `json:"timestamp"`
+	TransactionID string   `json:"transaction_id"`
+}
+
+// VerificationReady is the content of an m.key.verification.ready event.
+type VerificationReady struct {
+	FromDevice    string   `json:"from_device"`
+	Methods       []string `json:"methods"`
+	TransactionID string   `json:"transaction_id"`
+}
+
+// VerificationStart is the content of an m.key.verification.start event.
+// Secret is only set by the reciprocate method, the other properties
+// except FromDevice, Method and TransactionID only by the SAS method.
+type VerificationStart struct {
+	FromDevice                 string   `json:"from_device"`
+	Method                     string   `json:"method"`
+	TransactionID              string   `json:"transaction_id"`
+	KeyAgreementProtocols      []string `json:"key_agreement_protocols,omitempty"`
+	Hashes                     []string `json:"hashes,omitempty"`
+	MessageAuthenticationCodes []string `json:"message_authentication_codes,omitempty"`
+	ShortAuthenticationString  []string `json:"short_authentication_string,omitempty"`
+	Secret                     string   `json:"secret,omitempty"`
+}
+
+// VerificationAccept is the content of an m.key.verification.accept
+// event.
+type VerificationAccept struct {
+	TransactionID             string   `json:"transaction_id"`
+	Method                    string   `json:"method"`
+	KeyAgreementProtocol      string   `json:"key_agreement_protocol"`
+	Hash                      string   `json:"hash"`
+	MessageAuthenticationCode string   `json:"message_authentication_code"`
+	ShortAuthenticationString []string `json:"short_authentication_string"`
+	Commitment                string   `json:"commitment"`
+}
+
+// VerificationKey is the content of an m.key.verification.key event.
+type VerificationKey struct {
+	TransactionID string `json:"transaction_id"`
+	Key           string `json:"key"`
+}
+
+// VerificationMAC is the content of an m.key.verification.mac event.
+type VerificationMAC struct {
+	TransactionID string            `json:"transaction_id"`
+	MAC           map[string]string `json:"mac"`
+	Keys          string            `json:"keys"`
+}
+
+// VerificationDone is the content of an m.key.verification.done event.
+type VerificationDone struct {
+	TransactionID string `json:"transaction_id"`
+}
+
+// VerificationCancel is the content of an m.key.verification.cancel
+// event.
+type VerificationCancel struct {
+	TransactionID string `json:"transaction_id"`
+	Code          string `json:"code"`
+	Reason        string `json:"reason"`
+}
+
+// VerificationEvent is an event of an interactive verification. Content
+// is a pointer to the struct matching Type, e.g. *VerificationStart for
+// EventTypeVerificationStart.
+type VerificationEvent struct {
+	Type    string
+	Content interface{}
+	// Raw is the content as received. It is set by ParseVerificationEvent
+	// and keeps properties Content does not know, e.g. m.relates_to.
+	Raw json.RawMessage
+}
+
+// ParseVerificationEvent parses the content of a verification event of the
+// given type.
+func ParseVerificationEvent(eventType string, content []byte) (*VerificationEvent, error) {
+	var parsed interface{}
+	switch eventType {
+	case EventTypeVerificationRequest:
+		parsed = &VerificationRequest{}
+	case EventTypeVerificationReady:
+		parsed = &VerificationReady{}
+	case EventTypeVerificationStart:
+		parsed = &VerificationStart{}
+	case EventTypeVerificationAccept:
+		parsed = &VerificationAccept{}
+	case EventTypeVerificationKey:
+		parsed = &VerificationKey{}
+	case EventTypeVerificationMAC:
+		parsed = &VerificationMAC{}
+	case EventTypeVerificationDone:
+		parsed = &VerificationDone{}
+	case EventTypeVerificationCancel:
+		parsed = &VerificationCancel{}
+	default:
+		return nil, fmt.Errorf("unknown verification event type %q", eventType)
+	}
+
+	err := json.Unmarshal(content, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationEvent{
+		Type:    eventType,
+		Content: parsed,
+		Raw:     append(json.RawMessage(nil), content...),
+	}, nil
+}
+
+// TransactionID returns the transaction ID of the event or an empty string
+// if Content is of an unknown type.
+func (e *VerificationEvent) TransactionID() string {
+	switch content := e.Content.(type) {
+	case *VerificationRequest:
+		return content.TransactionID
+	case *VerificationReady:
+		return content.TransactionID
+	case *VerificationStart:
+		return content.TransactionID
+	case *VerificationAccept:
+		return content.TransactionID
+	case *VerificationKey:
+		return content.TransactionID
+	case *VerificationMAC:
+		return content.TransactionID
+	case *VerificationDone:
+		return content.TransactionID
+	case *VerificationCancel:
+		return content.TransactionID
+	}
+	return ""
+}
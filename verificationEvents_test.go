@@ -0,0 +1,53 @@
+package golm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseVerificationEvent(t *testing.T) {
+	Convey("Parsing a verification event", t, func() {
+		Convey("should return the matching content.", func() {
+			event, err := ParseVerificationEvent(EventTypeVerificationStart,
+				[]byte(`{"from_device":"BOB","method":"m.sas.v1","transaction_id":"txn","hashes":["sha256"]}`))
+			So(err, ShouldBeNil)
+			So(event.Type, ShouldEqual, EventTypeVerificationStart)
+			So(event.TransactionID(), ShouldEqual, "txn")
+
+			start, ok := event.Content.(*VerificationStart)
+			So(ok, ShouldBeTrue)
+			So(start.FromDevice, ShouldEqual, "BOB")
+			So(start.Hashes, ShouldResemble, []string{"sha256"})
+		})
+		Convey("should keep the raw content.", func() {
+			content := []byte(`{"transaction_id":"txn","m.relates_to":{"event_id":"$event"}}`)
+			event, err := ParseVerificationEvent(EventTypeVerificationStart, content)
+			So(err, ShouldBeNil)
+			So(string(event.Raw), ShouldEqual, string(content))
+		})
+		Convey("should work for every event type.", func() {
+			for _, eventType := range []string{
+				EventTypeVerificationRequest, EventTypeVerificationReady, EventTypeVerificationStart,
+				EventTypeVerificationAccept, EventTypeVerificationKey, EventTypeVerificationMAC,
+				EventTypeVerificationDone, EventTypeVerificationCancel,
+			} {
+				event, err := ParseVerificationEvent(eventType, []byte(`{"transaction_id":"txn"}`))
+				So(err, ShouldBeNil)
+				So(event.TransactionID(), ShouldEqual, "txn")
+			}
+		})
+		Convey("should fail for unknown types.", func() {
+			_, err := ParseVerificationEvent("m.key.verification.unknown", []byte(`{}`))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail for invalid JSON.", func() {
+			_, err := ParseVerificationEvent(EventTypeVerificationKey, []byte(`{`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("Events with unknown content should have no transaction ID.", t, func() {
+		event := &VerificationEvent{Type: EventTypeVerificationKey, Content: "content"}
+		So(event.TransactionID(), ShouldBeEmpty)
+	})
+}